@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crony/admin/internal/handler"
+	"crony/admin/internal/service"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/server"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jessevdk/go-flags"
+)
+
+// ServerName 是管理服务的名称, 配置文件位于 admin/conf/<env>/ 下
+const ServerName = "admin"
+
+// 命令行参数
+var opts struct {
+	ConfigFile string `short:"c" long:"config" default:"main" description:"配置文件名(不含扩展名)"`
+}
+
+func main() {
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+	// 加载配置并初始化各个基础组件
+	conf, err := server.Init(ServerName, opts.ConfigFile)
+	if err != nil {
+		fmt.Printf("init %s server err: %s\n", ServerName, err.Error())
+		os.Exit(1)
+	}
+	defer logger.Shutdown()
+
+	// 创建或更新数据库表结构
+	if err = service.AutoMigrate(); err != nil {
+		logger.GetLogger().Error(fmt.Sprintf("auto migrate err: %s", err.Error()))
+		os.Exit(1)
+	}
+
+	if conf.System.Env == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	engine := gin.New()
+	engine.Use(gin.Logger(), gin.Recovery())
+	handler.RegisterRouters(engine)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", conf.System.Addr),
+		Handler: engine,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.GetLogger().Error(fmt.Sprintf("admin server listen err: %s", err.Error()))
+			os.Exit(1)
+		}
+	}()
+	logger.GetLogger().Info(fmt.Sprintf("admin server listen on %s", srv.Addr))
+
+	// 以下后台任务在集群中只由当选的 admin 实例执行
+	stop := make(chan struct{})
+	// 为未分配的自动分配任务选择节点
+	go service.RunAsLeader(service.LeaderAllocation, stop, service.RunAllocationLoop)
+	// 节点下线时转移任务
+	go service.RunAsLeader(service.LeaderFailover, stop, service.RunFailover)
+	// 清理过期的任务日志
+	go service.RunAsLeader(service.LeaderLogClean, stop, service.RunLogClean)
+	// 调度工作流并处理步骤结果
+	go service.RunAsLeader(service.LeaderWorkflow, stop, service.RunWorkflows)
+
+	// 等待退出信号, 然后优雅关闭 HTTP 服务
+	sig := server.WaitForSignal()
+	logger.GetLogger().Info(fmt.Sprintf("admin server received signal %s, stopping", sig.String()))
+	close(stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("admin server shutdown err: %s", err.Error()))
+	}
+}
@@ -0,0 +1,40 @@
+// spec 是校验定时表达式并预览触发时间的命令行工具, 不需要连接 MySQL 和 etcd
+//
+//	go run ./admin/cmd/spec -s "0 0 9 * * 1-5" -z Asia/Tokyo -n 5
+package main
+
+import (
+	"crony/common/pkg/schedule"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// 命令行参数
+var opts struct {
+	Spec     string `short:"s" long:"spec" required:"true" description:"定时表达式, 例如 \"0 0 9 * * 1-5\" 或 \"@every 5m\""`
+	TimeZone string `short:"z" long:"time-zone" description:"IANA 时区, 为空时使用本机时区"`
+	N        int    `short:"n" long:"count" default:"10" description:"预览的触发次数"`
+}
+
+func main() {
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+	runs, err := schedule.NextRuns(opts.Spec, opts.TimeZone, opts.N)
+	if err != nil {
+		// 在表达式下方用 ^ 标出出错的位置
+		var specErr *schedule.SpecError
+		if errors.As(err, &specErr) {
+			fmt.Fprintf(os.Stderr, "%s\n%s^\n", specErr.Spec, strings.Repeat(" ", specErr.Pos))
+		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	for _, t := range runs {
+		fmt.Printf("%s %s\n", t.Format("2006-01-02 15:04:05 -0700 MST"), t.Weekday().String()[:3])
+	}
+}
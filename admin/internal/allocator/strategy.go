@@ -0,0 +1,135 @@
+package allocator
+
+import (
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// 支持的分配策略名称, 对应配置项 system.allocation-strategy
+const (
+	StrategyLeastJobs     = "least-jobs"     // 分配给任务数最少的节点
+	StrategyRoundRobin    = "round-robin"    // 依次轮流分配
+	StrategyHash          = "hash"           // 按任务 ID 哈希, 同一任务总是落在同一节点上
+	StrategyLabelAffinity = "label-affinity" // 只在标签匹配任务节点选择器的节点中选择任务数最少的
+)
+
+// NodeLoad 是参与分配的候选节点及其当前负载
+type NodeLoad struct {
+	*models.Node
+	JobCount int // 已分配到该节点的任务数
+}
+
+// Strategy 定义了任务分配策略需要实现的方法
+type Strategy interface {
+	// Name 返回策略名称
+	Name() string
+	// Pick 从候选节点中为任务选择一个节点, 候选节点已按 UUID 排序
+	Pick(job *models.Job, nodes []*NodeLoad) (*NodeLoad, error)
+}
+
+// NewStrategy 根据名称创建分配策略, 名称为空时使用 least-jobs
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", StrategyLeastJobs:
+		return new(leastJobs), nil
+	case StrategyRoundRobin:
+		return new(roundRobin), nil
+	case StrategyHash:
+		return new(hashByID), nil
+	case StrategyLabelAffinity:
+		return new(labelAffinity), nil
+	}
+	return nil, cronyErrors.ErrUnknownAllocStrategy
+}
+
+// Allocate 使用指定的策略为任务选择节点, 并将被选中节点的任务数加一
+// 批量分配时复用同一组 nodes, 后续任务即可感知前面的分配结果
+func Allocate(s Strategy, job *models.Job, nodes []*NodeLoad) (*NodeLoad, error) {
+	if len(nodes) == 0 {
+		return nil, cronyErrors.ErrNoAvailableNode
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].UUID < nodes[j].UUID })
+	node, err := s.Pick(job, nodes)
+	if err != nil {
+		return nil, err
+	}
+	node.JobCount++
+	return node, nil
+}
+
+// leastJobs 选择任务数最少的节点, 任务数相同时取 UUID 较小的
+type leastJobs struct{}
+
+func (s *leastJobs) Name() string { return StrategyLeastJobs }
+
+func (s *leastJobs) Pick(job *models.Job, nodes []*NodeLoad) (*NodeLoad, error) {
+	var picked *NodeLoad
+	for _, node := range nodes {
+		if picked == nil || node.JobCount < picked.JobCount {
+			picked = node
+		}
+	}
+	if picked == nil {
+		return nil, cronyErrors.ErrNoAvailableNode
+	}
+	return picked, nil
+}
+
+// roundRobin 在候选节点间依次轮流分配
+type roundRobin struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (s *roundRobin) Name() string { return StrategyRoundRobin }
+
+func (s *roundRobin) Pick(job *models.Job, nodes []*NodeLoad) (*NodeLoad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node := nodes[s.next%len(nodes)]
+	s.next++
+	return node, nil
+}
+
+// hashByID 使用最高随机权重(rendezvous)哈希按任务 ID 选择节点
+// 节点增减时只有落在变化节点上的任务会被重新分配
+type hashByID struct{}
+
+func (s *hashByID) Name() string { return StrategyHash }
+
+func (s *hashByID) Pick(job *models.Job, nodes []*NodeLoad) (*NodeLoad, error) {
+	var (
+		picked *NodeLoad
+		max    uint64
+	)
+	id := strconv.Itoa(job.ID)
+	for _, node := range nodes {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(id + "/" + node.UUID))
+		if sum := h.Sum64(); picked == nil || sum > max {
+			picked, max = node, sum
+		}
+	}
+	return picked, nil
+}
+
+// labelAffinity 只在标签满足任务节点选择器的节点中选择, 再从中取任务数最少的
+type labelAffinity struct {
+	leastJobs
+}
+
+func (s *labelAffinity) Name() string { return StrategyLabelAffinity }
+
+func (s *labelAffinity) Pick(job *models.Job, nodes []*NodeLoad) (*NodeLoad, error) {
+	matched := make([]*NodeLoad, 0, len(nodes))
+	for _, node := range nodes {
+		if node.MatchLabels(job.SelectorMap) {
+			matched = append(matched, node)
+		}
+	}
+	return s.leastJobs.Pick(job, matched)
+}
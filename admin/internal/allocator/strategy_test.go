@@ -0,0 +1,87 @@
+package allocator
+
+import (
+	"crony/common/models"
+	"testing"
+)
+
+func newNodes(counts map[string]int) []*NodeLoad {
+	nodes := make([]*NodeLoad, 0, len(counts))
+	for uuid, count := range counts {
+		nodes = append(nodes, &NodeLoad{Node: &models.Node{UUID: uuid}, JobCount: count})
+	}
+	return nodes
+}
+
+func TestLeastJobs(t *testing.T) {
+	s, _ := NewStrategy(StrategyLeastJobs)
+	nodes := newNodes(map[string]int{"a": 3, "b": 1, "c": 1})
+	for _, want := range []string{"b", "c", "b", "c", "a"} {
+		node, err := Allocate(s, &models.Job{ID: 1}, nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.UUID != want {
+			t.Fatalf("want node %s, got %s", want, node.UUID)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	s, _ := NewStrategy(StrategyRoundRobin)
+	nodes := newNodes(map[string]int{"a": 0, "b": 0, "c": 0})
+	for _, want := range []string{"a", "b", "c", "a"} {
+		node, _ := Allocate(s, &models.Job{ID: 1}, nodes)
+		if node.UUID != want {
+			t.Fatalf("want node %s, got %s", want, node.UUID)
+		}
+	}
+}
+
+func TestHashIsStable(t *testing.T) {
+	s, _ := NewStrategy(StrategyHash)
+	nodes := newNodes(map[string]int{"a": 0, "b": 0, "c": 0})
+	moved := 0
+	for id := 1; id <= 100; id++ {
+		first, _ := Allocate(s, &models.Job{ID: id}, nodes)
+		second, _ := Allocate(s, &models.Job{ID: id}, nodes)
+		if first.UUID != second.UUID {
+			t.Fatalf("job %d allocated to %s then %s", id, first.UUID, second.UUID)
+		}
+		// 去掉一个节点后, 只有原本在该节点上的任务会移动
+		rest := make([]*NodeLoad, 0, 2)
+		for _, n := range nodes {
+			if n.UUID != "c" {
+				rest = append(rest, n)
+			}
+		}
+		third, _ := Allocate(s, &models.Job{ID: id}, rest)
+		if first.UUID != "c" && third.UUID != first.UUID {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Fatalf("%d jobs moved although their node is still alive", moved)
+	}
+}
+
+func TestLabelAffinity(t *testing.T) {
+	s, _ := NewStrategy(StrategyLabelAffinity)
+	nodes := []*NodeLoad{
+		{Node: &models.Node{UUID: "a", LabelMap: map[string]string{"zone": "sh"}}},
+		{Node: &models.Node{UUID: "b", LabelMap: map[string]string{"zone": "bj", "gpu": "true"}}},
+		{Node: &models.Node{UUID: "c", LabelMap: map[string]string{"zone": "bj"}}, JobCount: 5},
+	}
+	job := &models.Job{ID: 1, SelectorMap: map[string]string{"zone": "bj"}}
+	node, err := Allocate(s, job, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.UUID != "b" {
+		t.Fatalf("want node b, got %s", node.UUID)
+	}
+	job.SelectorMap = map[string]string{"zone": "gz"}
+	if _, err = Allocate(s, job, nodes); err == nil {
+		t.Fatal("want error when no node matches the selector")
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+	"crony/common/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarRouter 负责日历相关的接口
+type CalendarRouter struct{}
+
+// Create 创建日历
+func (r *CalendarRouter) Create(c *gin.Context) {
+	var calendar models.Calendar
+	if err := c.ShouldBindJSON(&calendar); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	calendar.ID = 0
+	if err := service.CreateCalendar(&calendar); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, calendar)
+}
+
+// Update 更新日历
+func (r *CalendarRouter) Update(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var calendar models.Calendar
+	if err := c.ShouldBindJSON(&calendar); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	calendar.ID = id
+	if err := service.UpdateCalendar(&calendar); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, calendar)
+}
+
+// Delete 删除日历
+func (r *CalendarRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteCalendar(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
+
+// Get 查询单个日历
+func (r *CalendarRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	calendar, err := service.GetCalendar(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, calendar)
+}
+
+// Search 分页查询日历
+func (r *CalendarRouter) Search(c *gin.Context) {
+	var req service.CalendarSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchCalendars(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
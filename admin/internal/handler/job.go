@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+	"crony/common/models"
+	"crony/common/pkg/schedule"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobRouter 负责任务相关的接口
+type JobRouter struct{}
+
+// Create 创建任务, 已指定运行节点时同时发布到 etcd
+func (r *JobRouter) Create(c *gin.Context) {
+	var job models.Job
+	if err := c.ShouldBindJSON(&job); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	job.ID = 0
+	if err := service.CreateJob(&job); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, job)
+}
+
+// Update 更新任务并同步到 etcd
+func (r *JobRouter) Update(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var job models.Job
+	if err := c.ShouldBindJSON(&job); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	job.ID = id
+	if err := service.UpdateJob(&job); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, job)
+}
+
+// Types 返回 admin 已注册的任务类型, 包括配置中的插件类型
+func (r *JobRouter) Types(c *gin.Context) {
+	OkWithData(c, models.GetJobTypes())
+}
+
+// NextRunsReq 是预览触发时间的查询参数
+type NextRunsReq struct {
+	Spec     string `form:"spec" binding:"required"` // 定时表达式
+	TimeZone string `form:"time_zone"`               // IANA 时区, 为空时使用 admin 所在机器的本地时区
+	N        int    `form:"n"`                       // 返回的次数, 默认 10, 最多 schedule.MaxNextRuns
+}
+
+// NextRunsResp 是预览触发时间的结果
+type NextRunsResp struct {
+	Spec     string      `json:"spec"`
+	TimeZone string      `json:"time_zone"`
+	Runs     []time.Time `json:"runs"` // 按时区格式化的 RFC3339 时间
+}
+
+// NextRuns 校验定时表达式并返回后 N 次触发时间, 表达式非法时返回出错的位置
+func (r *JobRouter) NextRuns(c *gin.Context) {
+	var req NextRunsReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	switch {
+	case req.N <= 0:
+		req.N = 10
+	case req.N > schedule.MaxNextRuns:
+		req.N = schedule.MaxNextRuns
+	}
+	runs, err := schedule.NextRuns(req.Spec, req.TimeZone, req.N)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, NextRunsResp{Spec: req.Spec, TimeZone: req.TimeZone, Runs: runs})
+}
+
+// Delete 删除任务及其在 etcd 中的 key
+func (r *JobRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteJob(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
+
+// Get 查询单个任务
+func (r *JobRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	job, err := service.GetJob(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, job)
+}
+
+// Search 分页查询任务
+func (r *JobRouter) Search(c *gin.Context) {
+	var req service.JobSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchJobs(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
+
+// Procs 查询任务在集群内正在执行的进程
+func (r *JobRouter) Procs(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	procs, err := service.GetJobProcs(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, procs)
+}
+
+// KillReq 是终止任务的参数, 均为空时终止任务在集群内的全部进程
+type KillReq struct {
+	NodeUUID string `form:"node_uuid"` // 只终止该节点上的进程
+	Pid      int    `form:"pid"`       // 只终止该进程
+}
+
+// Kill 终止任务正在执行的进程
+func (r *JobRouter) Kill(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var req KillReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	procs, err := service.KillJob(id, req.NodeUUID, req.Pid)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, procs)
+}
+
+// RunReq 是立即执行任务的参数
+type RunReq struct {
+	Nodes string `form:"nodes"` // "any" 或以逗号分隔的节点 UUID, 为空时使用任务的运行节点
+	Wait  int64  `form:"wait"`  // 同步等待结果的秒数, 为 0 时只触发不等待
+}
+
+// Run 立即执行一次任务, 可同步等待各节点写回的结果
+func (r *JobRouter) Run(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var req RunReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	results, err := service.RunJobOnce(id, models.ParseOnceTargets(req.Nodes), time.Duration(req.Wait)*time.Second)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, results)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobLogRouter 负责任务日志相关的接口
+type JobLogRouter struct{}
+
+// Search 按条件分页查询任务日志
+func (r *JobLogRouter) Search(c *gin.Context) {
+	var req service.JobLogSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchJobLogs(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
+
+// Get 查询单条任务日志
+func (r *JobLogRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	jobLog, err := service.GetJobLog(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, jobLog)
+}
+
+// Attempts 查询任务日志的每一次尝试
+func (r *JobLogRouter) Attempts(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	attempts, err := service.GetJobLogAttempts(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, attempts)
+}
+
+// Delete 删除单条任务日志
+func (r *JobLogRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteJobLog(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NodeRouter 负责节点相关的接口
+type NodeRouter struct{}
+
+// Search 分页查询节点及其在线状态
+func (r *NodeRouter) Search(c *gin.Context) {
+	var req service.NodeSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchNodes(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
+
+// Get 查询单个节点及其在线状态
+func (r *NodeRouter) Get(c *gin.Context) {
+	node, err := service.GetNode(c.Param("uuid"))
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, node)
+}
+
+// Delete 删除一个已下线的节点
+func (r *NodeRouter) Delete(c *gin.Context) {
+	if err := service.DeleteNode(c.Param("uuid")); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
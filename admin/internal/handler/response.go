@@ -0,0 +1,72 @@
+package handler
+
+import (
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	CodeSuccess = 0 // 请求成功
+	CodeFail    = 1 // 请求失败
+)
+
+// Response 是所有接口统一的返回结构
+type Response struct {
+	Code int         `json:"code"` // 业务状态码
+	Msg  string      `json:"msg"`  // 提示信息
+	Data interface{} `json:"data"` // 返回数据
+}
+
+// OkWithData 返回成功响应及数据
+func OkWithData(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, Response{Code: CodeSuccess, Msg: "success", Data: data})
+}
+
+// Ok 返回不带数据的成功响应
+func Ok(c *gin.Context) {
+	OkWithData(c, nil)
+}
+
+// FailWithError 根据错误类型选择 HTTP 状态码并返回失败响应
+func FailWithError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, cronyErrors.ErrNotFound), errors.Is(err, cronyErrors.ErrNodeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, cronyErrors.ErrValueMayChanged), errors.Is(err, cronyErrors.ErrNodeIsAlive), errors.Is(err, cronyErrors.ErrUserNameExisted),
+		errors.Is(err, cronyErrors.ErrCalendarInUse), errors.Is(err, cronyErrors.ErrJobInWorkflow), errors.Is(err, cronyErrors.ErrWorkflowRunning):
+		status = http.StatusConflict
+	case errors.Is(err, cronyErrors.ErrIllegalOnceTarget), errors.Is(err, cronyErrors.ErrIllegalHttpSpec),
+		errors.Is(err, cronyErrors.ErrIllegalConcurrency), errors.Is(err, cronyErrors.ErrIllegalEnv),
+		errors.Is(err, cronyErrors.ErrIllegalUmask), errors.Is(err, cronyErrors.ErrUnknownInterpreter),
+		errors.Is(err, cronyErrors.ErrIllegalResourceLimit), errors.Is(err, cronyErrors.ErrIllegalContainerSpec),
+		errors.Is(err, cronyErrors.ErrIllegalSQLSpec), errors.Is(err, cronyErrors.ErrIllegalGRPCSpec),
+		errors.Is(err, cronyErrors.ErrUnknownJobType), errors.Is(err, cronyErrors.ErrIllegalPluginParams),
+		errors.Is(err, cronyErrors.ErrIllegalJobHook), errors.Is(err, cronyErrors.ErrIllegalRetryPolicy),
+		errors.Is(err, cronyErrors.ErrIllegalTimeZone), errors.Is(err, cronyErrors.ErrIllegalJobCalendar),
+		errors.Is(err, cronyErrors.ErrIllegalCalendar), errors.Is(err, cronyErrors.ErrIllegalSpec), errors.Is(err, cronyErrors.ErrIllegalMisfire),
+		errors.Is(err, cronyErrors.ErrEmptyWorkflowName), errors.Is(err, cronyErrors.ErrIllegalWorkflow):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, Response{Code: CodeFail, Msg: err.Error()})
+}
+
+// FailWithBadRequest 返回参数错误的失败响应
+func FailWithBadRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, Response{Code: CodeFail, Msg: err.Error()})
+}
+
+// paramID 从路径参数 :id 中解析出整数 ID
+func paramID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		FailWithBadRequest(c, cronyErrors.ErrIllegalJobId)
+		return 0, false
+	}
+	return id, true
+}
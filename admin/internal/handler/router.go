@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRouters 注册 admin 服务的全部 REST 接口
+func RegisterRouters(r *gin.Engine) {
+	v1 := r.Group("/api/v1")
+
+	jobRouter := new(JobRouter)
+	jobs := v1.Group("/jobs")
+	{
+		jobs.GET("", jobRouter.Search)
+		jobs.POST("", jobRouter.Create)
+		jobs.GET("/types", jobRouter.Types)
+		jobs.GET("/next-runs", jobRouter.NextRuns)
+		jobs.GET("/:id", jobRouter.Get)
+		jobs.PUT("/:id", jobRouter.Update)
+		jobs.DELETE("/:id", jobRouter.Delete)
+		jobs.GET("/:id/procs", jobRouter.Procs)
+		jobs.POST("/:id/kill", jobRouter.Kill)
+		jobs.POST("/:id/run", jobRouter.Run)
+	}
+
+	nodeRouter := new(NodeRouter)
+	nodes := v1.Group("/nodes")
+	{
+		nodes.GET("", nodeRouter.Search)
+		nodes.GET("/:uuid", nodeRouter.Get)
+		nodes.DELETE("/:uuid", nodeRouter.Delete)
+	}
+
+	scriptRouter := new(ScriptRouter)
+	scripts := v1.Group("/scripts")
+	{
+		scripts.GET("", scriptRouter.Search)
+		scripts.POST("", scriptRouter.Create)
+		scripts.GET("/:id", scriptRouter.Get)
+		scripts.PUT("/:id", scriptRouter.Update)
+		scripts.DELETE("/:id", scriptRouter.Delete)
+	}
+
+	calendarRouter := new(CalendarRouter)
+	calendars := v1.Group("/calendars")
+	{
+		calendars.GET("", calendarRouter.Search)
+		calendars.POST("", calendarRouter.Create)
+		calendars.GET("/:id", calendarRouter.Get)
+		calendars.PUT("/:id", calendarRouter.Update)
+		calendars.DELETE("/:id", calendarRouter.Delete)
+	}
+
+	workflowRouter := new(WorkflowRouter)
+	workflows := v1.Group("/workflows")
+	{
+		workflows.GET("", workflowRouter.Search)
+		workflows.POST("", workflowRouter.Create)
+		workflows.GET("/:id", workflowRouter.Get)
+		workflows.PUT("/:id", workflowRouter.Update)
+		workflows.DELETE("/:id", workflowRouter.Delete)
+		workflows.POST("/:id/run", workflowRouter.Run)
+	}
+
+	workflowRunRouter := new(WorkflowRunRouter)
+	workflowRuns := v1.Group("/workflow-runs")
+	{
+		workflowRuns.GET("", workflowRunRouter.Search)
+		workflowRuns.GET("/:id", workflowRunRouter.Get)
+		workflowRuns.POST("/:id/retry", workflowRunRouter.Retry)
+	}
+
+	userRouter := new(UserRouter)
+	users := v1.Group("/users")
+	{
+		users.GET("", userRouter.Search)
+		users.POST("", userRouter.Create)
+		users.GET("/:id", userRouter.Get)
+		users.PUT("/:id", userRouter.Update)
+		users.DELETE("/:id", userRouter.Delete)
+	}
+
+	jobLogRouter := new(JobLogRouter)
+	logs := v1.Group("/logs")
+	{
+		logs.GET("", jobLogRouter.Search)
+		logs.GET("/:id", jobLogRouter.Get)
+		logs.GET("/:id/attempts", jobLogRouter.Attempts)
+		logs.DELETE("/:id", jobLogRouter.Delete)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+	"crony/common/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScriptRouter 负责预设脚本相关的接口
+type ScriptRouter struct{}
+
+// Create 创建预设脚本
+func (r *ScriptRouter) Create(c *gin.Context) {
+	var script models.Script
+	if err := c.ShouldBindJSON(&script); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	script.ID = 0
+	if err := service.CreateScript(&script); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, script)
+}
+
+// Update 更新预设脚本
+func (r *ScriptRouter) Update(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var script models.Script
+	if err := c.ShouldBindJSON(&script); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	script.ID = id
+	if err := service.UpdateScript(&script); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, script)
+}
+
+// Delete 删除预设脚本
+func (r *ScriptRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteScript(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
+
+// Get 查询单个预设脚本
+func (r *ScriptRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	script, err := service.GetScript(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, script)
+}
+
+// Search 分页查询预设脚本
+func (r *ScriptRouter) Search(c *gin.Context) {
+	var req service.ScriptSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchScripts(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+	"crony/common/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserRouter 负责用户相关的接口
+type UserRouter struct{}
+
+// Create 创建用户
+func (r *UserRouter) Create(c *gin.Context) {
+	var user models.User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	user.ID = 0
+	if err := service.CreateUser(&user); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, user)
+}
+
+// Update 更新用户
+func (r *UserRouter) Update(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var user models.User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	user.ID = id
+	if err := service.UpdateUser(&user); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, user)
+}
+
+// Delete 删除用户
+func (r *UserRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteUser(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
+
+// Get 查询单个用户
+func (r *UserRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	user, err := service.GetUser(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, user)
+}
+
+// Search 分页查询用户
+func (r *UserRouter) Search(c *gin.Context) {
+	var req service.UserSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchUsers(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"crony/admin/internal/service"
+	"crony/common/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkflowRouter 负责工作流相关的接口
+type WorkflowRouter struct{}
+
+// Create 创建工作流
+func (r *WorkflowRouter) Create(c *gin.Context) {
+	var workflow models.Workflow
+	if err := c.ShouldBindJSON(&workflow); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	workflow.ID = 0
+	if err := service.CreateWorkflow(&workflow); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, workflow)
+}
+
+// Update 更新工作流
+func (r *WorkflowRouter) Update(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var workflow models.Workflow
+	if err := c.ShouldBindJSON(&workflow); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	workflow.ID = id
+	if err := service.UpdateWorkflow(&workflow); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, workflow)
+}
+
+// Delete 删除工作流
+func (r *WorkflowRouter) Delete(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteWorkflow(id); err != nil {
+		FailWithError(c, err)
+		return
+	}
+	Ok(c)
+}
+
+// Get 查询单个工作流
+func (r *WorkflowRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	workflow, err := service.GetWorkflow(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, workflow)
+}
+
+// Search 分页查询工作流
+func (r *WorkflowRouter) Search(c *gin.Context) {
+	var req service.WorkflowSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchWorkflows(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
+
+// Run 立即触发一次工作流运行, 返回新建的运行
+func (r *WorkflowRouter) Run(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	run, err := service.RunWorkflow(id, models.WorkflowTriggerManual, time.Time{})
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, run)
+}
+
+// WorkflowRunRouter 负责工作流运行相关的接口
+type WorkflowRunRouter struct{}
+
+// RetryReq 是重试工作流运行的参数
+type RetryReq struct {
+	Step string `form:"step"` // 重试的步骤, 为空时重试全部失败的步骤
+}
+
+// Search 分页查询工作流运行
+func (r *WorkflowRunRouter) Search(c *gin.Context) {
+	var req service.WorkflowRunSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	result, err := service.SearchWorkflowRuns(&req)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, result)
+}
+
+// Get 查询单个工作流运行及其各步骤的状态
+func (r *WorkflowRunRouter) Get(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	run, err := service.GetWorkflowRun(id)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, run)
+}
+
+// Retry 重试工作流运行中失败的子图
+func (r *WorkflowRunRouter) Retry(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var req RetryReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		FailWithBadRequest(c, err)
+		return
+	}
+	run, err := service.RetryWorkflowRun(id, req.Step)
+	if err != nil {
+		FailWithError(c, err)
+		return
+	}
+	OkWithData(c, run)
+}
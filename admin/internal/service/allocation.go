@@ -0,0 +1,299 @@
+package service
+
+import (
+	"crony/admin/internal/allocator"
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"gorm.io/gorm"
+)
+
+// AllocationInterval 是后台分配循环扫描未分配任务的间隔
+const AllocationInterval = 10 * time.Second
+
+var (
+	strategyOnce sync.Once
+	strategy     allocator.Strategy
+	strategyErr  error
+)
+
+// getStrategy 返回配置中指定的分配策略
+// 策略实例在进程内复用, round-robin 等有状态的策略才能正确轮转
+func getStrategy() (allocator.Strategy, error) {
+	strategyOnce.Do(func() {
+		strategy, strategyErr = allocator.NewStrategy(config.GetConfigModels().System.AllocationStrategy)
+	})
+	return strategy, strategyErr
+}
+
+// GetAliveNodeLoads 从 etcd 中读取所有在线节点, 并统计每个节点已分配的任务数
+func GetAliveNodeLoads() ([]*allocator.NodeLoad, error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdNodeProfile, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		RunOn string
+		Count int
+	}
+	if err = dbclient.GetMysqlDB().Table(models.CronyJobTableName).Select("run_on, count(*) as count").
+		Where("status = ?", models.JobStatusAssigned).Group("run_on").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	countMap := make(map[string]int, len(counts))
+	for _, c := range counts {
+		countMap[c.RunOn] = c.Count
+	}
+	nodes := make([]*allocator.NodeLoad, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		node := new(models.Node)
+		if err = json.Unmarshal(kv.Value, node); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("node[%s] unmarshal err: %s", string(kv.Key), err.Error()))
+			continue
+		}
+		nodes = append(nodes, &allocator.NodeLoad{Node: node, JobCount: countMap[node.UUID]})
+	}
+	return nodes, nil
+}
+
+// normalizeAllocation 补全任务的分配方式
+// 未显式指定分配方式且未指定运行节点时, 由配置项 cmd-auto-allocation 决定是否自动分配
+func normalizeAllocation(job *models.Job) {
+	if job.Allocation == models.AutoAllocation || job.Allocation == models.ManualAllocation {
+		return
+	}
+	if job.RunOn == "" && config.GetConfigModels().System.CmdAutoAllocation {
+		job.Allocation = models.AutoAllocation
+	} else {
+		job.Allocation = models.ManualAllocation
+	}
+}
+
+// tryAllocate 为尚未指定运行节点的自动分配任务选择一个节点
+// 暂时没有可用节点时任务保持未分配状态, 由后台的分配循环稍后重试
+func tryAllocate(job *models.Job) error {
+	if job.Allocation != models.AutoAllocation || job.RunOn != "" {
+		return nil
+	}
+	s, err := getStrategy()
+	if err != nil {
+		return err
+	}
+	nodes, err := GetAliveNodeLoads()
+	if err != nil {
+		return err
+	}
+	node, err := allocator.Allocate(s, job, nodes)
+	if errors.Is(err, cronyErrors.ErrNoAvailableNode) {
+		logger.GetLogger().Warn(fmt.Sprintf("job#%d is left unassigned: %s", job.ID, err.Error()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	job.RunOn = node.UUID
+	return nil
+}
+
+// AllocateUnassignedJobs 为所有未分配的自动分配任务选择节点, 返回成功分配的任务数
+func AllocateUnassignedJobs() (int, error) {
+	var jobs []*models.Job
+	if err := dbclient.GetMysqlDB().Table(models.CronyJobTableName).
+		Where("status = ? and allocation = ?", models.JobStatusNotAssigned, models.AutoAllocation).
+		Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	failed, err := AllocateJobs(jobs, nil)
+	return len(jobs) - len(failed), err
+}
+
+// AllocateJobs 按配置的策略把一批任务分配到在线节点上, 返回未能分配的任务
+// exclude 中的节点不参与本次分配, 例如刚刚下线的节点
+func AllocateJobs(jobs []*models.Job, exclude map[string]bool) ([]*models.Job, error) {
+	s, err := getStrategy()
+	if err != nil {
+		return jobs, err
+	}
+	loads, err := GetAliveNodeLoads()
+	if err != nil {
+		return jobs, err
+	}
+	nodes := make([]*allocator.NodeLoad, 0, len(loads))
+	for _, node := range loads {
+		if !exclude[node.UUID] {
+			nodes = append(nodes, node)
+		}
+	}
+	failed := make([]*models.Job, 0)
+	for _, job := range jobs {
+		if err = job.Unmarshal(); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job#%d unmarshal err: %s", job.ID, err.Error()))
+			failed = append(failed, job)
+			continue
+		}
+		node, err := allocator.Allocate(s, job, nodes)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("allocate job#%d err: %s", job.ID, err.Error()))
+			failed = append(failed, job)
+			continue
+		}
+		if err = AssignJob(job, node.UUID); err != nil {
+			node.JobCount--
+			logger.GetLogger().Warn(fmt.Sprintf("assign job#%d to node[%s] err: %s", job.ID, node.UUID, err.Error()))
+			failed = append(failed, job)
+			continue
+		}
+	}
+	return failed, nil
+}
+
+// Rebalance 在节点上线后重新平衡自动分配的任务, 返回被移动的任务数
+// hash 策略下每个任务回到其哈希对应的节点; 其他策略下不断把任务从负载最高的节点
+// 移到负载最低的节点, 直到两者的任务数相差不超过 1
+func Rebalance() (int, error) {
+	s, err := getStrategy()
+	if err != nil {
+		return 0, err
+	}
+	nodes, err := GetAliveNodeLoads()
+	if err != nil || len(nodes) < 2 {
+		return 0, err
+	}
+	var jobs []*models.Job
+	if err = dbclient.GetMysqlDB().Table(models.CronyJobTableName).
+		Where("status = ? and allocation = ?", models.JobStatusAssigned, models.AutoAllocation).
+		Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+	byNode := make(map[string][]*models.Job)
+	for _, job := range jobs {
+		if err = job.Unmarshal(); err != nil {
+			continue
+		}
+		byNode[job.RunOn] = append(byNode[job.RunOn], job)
+	}
+
+	moved := 0
+	if s.Name() == allocator.StrategyHash {
+		for _, job := range jobs {
+			node, err := s.Pick(job, nodes)
+			if err != nil || node.UUID == job.RunOn {
+				continue
+			}
+			if err = AssignJob(job, node.UUID); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("rebalance job#%d err: %s", job.ID, err.Error()))
+				continue
+			}
+			moved++
+		}
+		return moved, nil
+	}
+
+	for range jobs {
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].JobCount < nodes[j].JobCount })
+		least, most := nodes[0], nodes[len(nodes)-1]
+		if most.JobCount-least.JobCount <= 1 {
+			break
+		}
+		// 从负载最高的节点上找一个可以移动到负载最低节点的任务
+		var picked *models.Job
+		candidates := byNode[most.UUID]
+		for i, job := range candidates {
+			if s.Name() == allocator.StrategyLabelAffinity && !least.MatchLabels(job.SelectorMap) {
+				continue
+			}
+			picked = job
+			byNode[most.UUID] = append(candidates[:i:i], candidates[i+1:]...)
+			break
+		}
+		if picked == nil {
+			break
+		}
+		if err = AssignJob(picked, least.UUID); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("rebalance job#%d err: %s", picked.ID, err.Error()))
+			break
+		}
+		byNode[least.UUID] = append(byNode[least.UUID], picked)
+		most.JobCount--
+		least.JobCount++
+		moved++
+	}
+	return moved, nil
+}
+
+// UnassignJob 将任务从其运行节点上撤下, 并标记为未分配, 等待后台分配循环重新分配
+func UnassignJob(job *models.Job) error {
+	oldRunOn := job.RunOn
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyJobTableName).Where("id = ?", job.ID).
+			Updates(map[string]interface{}{"run_on": "", "status": models.JobStatusNotAssigned}).Error; err != nil {
+			return err
+		}
+		if oldRunOn == "" {
+			return nil
+		}
+		_, err := etcdclient.Delete(JobKey(oldRunOn, job.ID))
+		return err
+	})
+}
+
+// AssignJob 将任务改为运行在指定节点上
+// 同时更新 MySQL 中的分配信息, 删除旧节点下的 key, 并写入新节点的 /crony/job/<node_uuid>/<job_id>
+func AssignJob(job *models.Job, nodeUUID string) error {
+	if err := job.Unmarshal(); err != nil {
+		return err
+	}
+	if err := job.Check(); err != nil {
+		return err
+	}
+	oldRunOn := job.RunOn
+	job.RunOn = nodeUUID
+	job.Status = models.JobStatusAssigned
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyJobTableName).Where("id = ?", job.ID).
+			Updates(map[string]interface{}{"run_on": job.RunOn, "status": job.Status}).Error; err != nil {
+			return err
+		}
+		if oldRunOn != "" && oldRunOn != nodeUUID {
+			if _, err := etcdclient.Delete(JobKey(oldRunOn, job.ID)); err != nil {
+				return err
+			}
+		}
+		return publishJob(job, 0)
+	})
+}
+
+// RunAllocationLoop 周期性地为未分配的自动分配任务选择节点, 直到 stop 被关闭
+func RunAllocationLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(AllocationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n, err := AllocateUnassignedJobs()
+			if err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("allocate unassigned jobs err: %s", err.Error()))
+				continue
+			}
+			if n > 0 {
+				logger.GetLogger().Info(fmt.Sprintf("allocated %d unassigned jobs", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CalendarSearchReq 是日历列表的查询条件
+type CalendarSearchReq struct {
+	PageReq
+	Name string `form:"name"` // 日历名称, 模糊匹配
+}
+
+// CalendarKey 返回日历在 etcd 中的 key: /crony/calendar/<calendar_id>
+func CalendarKey(id int) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdCalendar, id)
+}
+
+// CreateCalendar 在 MySQL 中创建日历并发布到 etcd
+// etcd 的 key 依赖插入后生成的日历ID, 发布失败时回滚插入, 任务不会引用一个节点上不存在的日历
+func CreateCalendar(calendar *models.Calendar) error {
+	if err := calendar.Check(); err != nil {
+		return err
+	}
+	if err := calendar.Marshal(); err != nil {
+		return err
+	}
+	calendar.Created = time.Now().Unix()
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyCalendarTableName).Create(calendar).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Put(CalendarKey(calendar.ID), calendar.Val())
+		return err
+	})
+}
+
+// UpdateCalendar 更新 MySQL 中的日历并同步到 etcd, 节点收到后重新调度引用它的任务
+func UpdateCalendar(calendar *models.Calendar) error {
+	if err := calendar.Check(); err != nil {
+		return err
+	}
+	if err := calendar.Marshal(); err != nil {
+		return err
+	}
+	old := &models.Calendar{ID: calendar.ID}
+	if err := old.FindById(); err != nil {
+		return err
+	}
+	calendar.Created = old.Created
+	calendar.Updated = time.Now().Unix()
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		// Select("*") 使零值字段(如清空时区)同样被更新
+		if err := tx.Table(models.CronyCalendarTableName).Where("id = ?", calendar.ID).Select("*").Updates(calendar).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Put(CalendarKey(calendar.ID), calendar.Val())
+		return err
+	})
+}
+
+// DeleteCalendar 删除日历, 仍被任务引用的日历不能删除
+func DeleteCalendar(id int) error {
+	calendar := &models.Calendar{ID: id}
+	if err := calendar.FindById(); err != nil {
+		return err
+	}
+	jobIds, err := jobsUsingCalendar(id)
+	if err != nil {
+		return err
+	}
+	if len(jobIds) > 0 {
+		return fmt.Errorf("%w: job %v", cronyErrors.ErrCalendarInUse, jobIds)
+	}
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("delete from %s where id = ?", models.CronyCalendarTableName), id).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Delete(CalendarKey(id))
+		return err
+	})
+}
+
+// GetCalendar 根据 ID 查询日历
+func GetCalendar(id int) (*models.Calendar, error) {
+	calendar := &models.Calendar{ID: id}
+	if err := calendar.FindById(); err != nil {
+		return nil, err
+	}
+	if err := calendar.Unmarshal(); err != nil {
+		return nil, err
+	}
+	return calendar, nil
+}
+
+// SearchCalendars 分页查询日历
+func SearchCalendars(req *CalendarSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyCalendarTableName)
+	if req.Name != "" {
+		db = db.Where("name like ?", "%"+req.Name+"%")
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	calendars := make([]models.Calendar, 0)
+	if err := db.Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&calendars).Error; err != nil {
+		return nil, err
+	}
+	for i := range calendars {
+		_ = calendars[i].Unmarshal()
+	}
+	return &PageResult{List: calendars, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// jobsUsingCalendar 返回引用了日历的任务ID
+func jobsUsingCalendar(id int) ([]int, error) {
+	var jobs []models.Job
+	if err := dbclient.GetMysqlDB().Table(models.CronyJobTableName).Select("id, calendars").
+		Where("calendars is not null").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	var ids []int
+	for i := range jobs {
+		if err := jobs[i].Unmarshal(); err != nil {
+			continue
+		}
+		for _, r := range jobs[i].Calendars {
+			if r.CalendarID == id {
+				ids = append(ids, jobs[i].ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// checkJobCalendars 校验任务引用的日历是否存在
+func checkJobCalendars(job *models.Job) error {
+	for _, r := range job.Calendars {
+		calendar := &models.Calendar{ID: r.CalendarID}
+		if err := calendar.FindById(); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: calendar#%d not found", cronyErrors.ErrIllegalJobCalendar, r.CalendarID)
+			}
+			return err
+		}
+	}
+	return nil
+}
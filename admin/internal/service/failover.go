@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// RunFailover 监听节点的上下线, 直到 stop 被关闭
+// 节点的租约过期后, 把它上面自动分配的任务转移到其他在线节点; 节点重新上线时重新平衡任务
+// 应当通过 RunAsLeader 调用, 保证集群中只有一个实例在执行
+func RunFailover(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 先开始监听再做一次全量对账, 避免两者之间发生的事件被遗漏
+	rch := etcdclient.GetEtcdClient().Watch(ctx, etcdclient.KeyEtcdNodeProfile, clientv3.WithPrefix())
+	reconcileNodes()
+	for {
+		select {
+		case <-stop:
+			return
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch nodes err: %s", err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				uuid := strings.TrimPrefix(string(ev.Kv.Key), etcdclient.KeyEtcdNodeProfile)
+				switch {
+				case ev.Type == mvccpb.DELETE:
+					nodeDown(uuid)
+				case ev.Type == mvccpb.PUT && ev.IsCreate():
+					nodeUp(uuid)
+				}
+			}
+		}
+	}
+}
+
+// reconcileNodes 处理在没有领导者期间下线或重新上线的节点
+// MySQL 中仍记录为在线、或者仍然挂有任务, 但在 etcd 中已经不存在的节点, 都按下线处理;
+// MySQL 中记录为下线, 但在 etcd 中存在的节点按上线处理
+func reconcileNodes() {
+	alive, err := GetAliveNodeUUIDs()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("reconcile nodes err: %s", err.Error()))
+		return
+	}
+	var uuids []string
+	if err = dbclient.GetMysqlDB().Table(models.CronyNodeTableName).
+		Where("status = ?", models.NodeConnSuccess).Pluck("uuid", &uuids).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("reconcile nodes err: %s", err.Error()))
+		return
+	}
+	var runOns []string
+	if err = dbclient.GetMysqlDB().Table(models.CronyJobTableName).
+		Where("status = ?", models.JobStatusAssigned).Distinct().Pluck("run_on", &runOns).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("reconcile nodes err: %s", err.Error()))
+		return
+	}
+	down := make(map[string]bool)
+	for _, uuid := range append(uuids, runOns...) {
+		if uuid != "" && !alive[uuid] {
+			down[uuid] = true
+		}
+	}
+	for uuid := range down {
+		nodeDown(uuid)
+	}
+
+	var failed []string
+	if err = dbclient.GetMysqlDB().Table(models.CronyNodeTableName).
+		Where("status = ?", models.NodeConnFail).Pluck("uuid", &failed).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("reconcile nodes err: %s", err.Error()))
+		return
+	}
+	for _, uuid := range failed {
+		if alive[uuid] {
+			nodeUp(uuid)
+		}
+	}
+}
+
+// nodeDown 将节点标记为下线, 并把它上面自动分配的任务转移到其他在线节点
+// 没有可用节点时任务被标记为未分配, 由后台分配循环在有节点上线后重新分配
+func nodeDown(uuid string) {
+	logger.GetLogger().Warn(fmt.Sprintf("node[%s] is down", uuid))
+	if err := dbclient.GetMysqlDB().Table(models.CronyNodeTableName).Where("uuid = ?", uuid).
+		Updates(map[string]interface{}{"status": models.NodeConnFail, "down": time.Now().Unix()}).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("mark node[%s] failed err: %s", uuid, err.Error()))
+	}
+
+	var jobs []*models.Job
+	if err := dbclient.GetMysqlDB().Table(models.CronyJobTableName).
+		Where("run_on = ? and status = ?", uuid, models.JobStatusAssigned).Find(&jobs).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("find jobs of node[%s] err: %s", uuid, err.Error()))
+		return
+	}
+	autoJobs := make([]*models.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Allocation == models.AutoAllocation {
+			autoJobs = append(autoJobs, job)
+		} else {
+			// 手动分配的任务不做转移, 只记录下来
+			logger.GetLogger().Warn(fmt.Sprintf("job#%d is manually allocated to down node[%s], it will not run until the node comes back", job.ID, uuid))
+		}
+	}
+	if len(autoJobs) == 0 {
+		return
+	}
+	failed, err := AllocateJobs(autoJobs, map[string]bool{uuid: true})
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("failover jobs of node[%s] err: %s", uuid, err.Error()))
+	}
+	for _, job := range failed {
+		if err = UnassignJob(job); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("unassign job#%d err: %s", job.ID, err.Error()))
+		}
+	}
+	logger.GetLogger().Info(fmt.Sprintf("failover node[%s]: %d jobs moved, %d jobs unassigned", uuid, len(autoJobs)-len(failed), len(failed)))
+}
+
+// nodeUp 将节点标记为在线, 并重新平衡自动分配的任务
+// etcd 租约短暂丢失后节点只会重新写入 etcd 中的 key, MySQL 中的状态需要在这里恢复
+func nodeUp(uuid string) {
+	logger.GetLogger().Info(fmt.Sprintf("node[%s] is up", uuid))
+	if err := dbclient.GetMysqlDB().Table(models.CronyNodeTableName).Where("uuid = ?", uuid).
+		Updates(map[string]interface{}{"status": models.NodeConnSuccess, "up": time.Now().Unix(), "down": 0}).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("mark node[%s] up err: %s", uuid, err.Error()))
+	}
+	moved, err := Rebalance()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("rebalance after node[%s] up err: %s", uuid, err.Error()))
+		return
+	}
+	if moved > 0 {
+		logger.GetLogger().Info(fmt.Sprintf("rebalance after node[%s] up: %d jobs moved", uuid, moved))
+	}
+}
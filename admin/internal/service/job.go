@@ -0,0 +1,252 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/schedule"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobSearchReq 是任务列表的查询条件
+type JobSearchReq struct {
+	PageReq
+	Name  string `form:"name"`   // 任务名称, 模糊匹配
+	RunOn string `form:"run_on"` // 运行节点
+	Type  int    `form:"type"`   // 任务类型
+}
+
+// JobKey 返回任务在 etcd 中的 key: /crony/job/<node_uuid>/<job_id>
+func JobKey(nodeUUID string, jobId int) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdJob, nodeUUID, jobId)
+}
+
+// CreateJob 在 MySQL 中创建任务, 若已指定运行节点则同时发布到 etcd
+// 自动分配的任务在插入拿到 ID 后按配置的策略选择一个在线节点
+// 两步在同一个数据库事务中完成, etcd 写入失败时数据库的插入会被回滚
+func CreateJob(job *models.Job) error {
+	if err := job.Check(); err != nil {
+		return err
+	}
+	if err := checkNewSpec(job.Spec); err != nil {
+		return err
+	}
+	normalizeAllocation(job)
+	if err := checkRunOn(job.RunOn); err != nil {
+		return err
+	}
+	if err := checkHookScripts(job); err != nil {
+		return err
+	}
+	if err := checkJobCalendars(job); err != nil {
+		return err
+	}
+	if err := job.Marshal(); err != nil {
+		return err
+	}
+	job.Created = time.Now().Unix()
+	job.Status = jobStatus(job.RunOn)
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyJobTableName).Create(job).Error; err != nil {
+			return err
+		}
+		if job.RunOn == "" {
+			if err := tryAllocate(job); err != nil {
+				return err
+			}
+			job.Status = jobStatus(job.RunOn)
+			if err := tx.Table(models.CronyJobTableName).Where("id = ?", job.ID).
+				Updates(map[string]interface{}{"run_on": job.RunOn, "status": job.Status}).Error; err != nil {
+				return err
+			}
+		}
+		return publishJob(job, 0)
+	})
+}
+
+// UpdateJob 更新 MySQL 中的任务并同步到 etcd
+// 运行节点发生变化时会删除旧节点下的 key; 写入新 key 时使用 ModRevision 做乐观并发控制
+func UpdateJob(job *models.Job) error {
+	if err := job.Check(); err != nil {
+		return err
+	}
+	if err := checkNewSpec(job.Spec); err != nil {
+		return err
+	}
+	normalizeAllocation(job)
+	if err := tryAllocate(job); err != nil {
+		return err
+	}
+	if err := checkRunOn(job.RunOn); err != nil {
+		return err
+	}
+	if err := checkHookScripts(job); err != nil {
+		return err
+	}
+	if err := checkJobCalendars(job); err != nil {
+		return err
+	}
+	if err := job.Marshal(); err != nil {
+		return err
+	}
+	old := &models.Job{ID: job.ID}
+	if err := old.FindById(); err != nil {
+		return err
+	}
+	job.Created = old.Created
+	job.Updated = time.Now().Unix()
+	job.Status = jobStatus(job.RunOn)
+
+	// 读取当前 key 的版本号, 用于 CAS 写入
+	var rev int64
+	if job.RunOn != "" {
+		resp, err := etcdclient.Get(JobKey(job.RunOn, job.ID))
+		if err != nil {
+			return err
+		}
+		if resp.Count > 0 {
+			rev = resp.Kvs[0].ModRevision
+		}
+	}
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		// Select("*") 使零值字段(如清空运行节点)同样被更新
+		if err := tx.Table(models.CronyJobTableName).Where("id = ?", job.ID).Select("*").Updates(job).Error; err != nil {
+			return err
+		}
+		if old.RunOn != "" && old.RunOn != job.RunOn {
+			if _, err := etcdclient.Delete(JobKey(old.RunOn, job.ID)); err != nil {
+				return err
+			}
+		}
+		return publishJob(job, rev)
+	})
+}
+
+// DeleteJob 删除 MySQL 中的任务, 并删除 etcd 中对应的 key
+func DeleteJob(id int) error {
+	job := &models.Job{ID: id}
+	if err := job.FindById(); err != nil {
+		return err
+	}
+	workflowIds, err := workflowsUsingJob(id)
+	if err != nil {
+		return err
+	}
+	if len(workflowIds) > 0 {
+		return fmt.Errorf("%w: workflow %v", cronyErrors.ErrJobInWorkflow, workflowIds)
+	}
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("delete from %s where id = ?", models.CronyJobTableName), id).Error; err != nil {
+			return err
+		}
+		// 最近一次调度时刻只用于节点恢复后补执行, 任务删除后不再需要
+		if _, err := etcdclient.Delete(fmt.Sprintf(etcdclient.KeyEtcdFire, id)); err != nil {
+			return err
+		}
+		if job.RunOn == "" {
+			return nil
+		}
+		_, err := etcdclient.Delete(JobKey(job.RunOn, id))
+		return err
+	})
+}
+
+// GetJob 根据 ID 查询任务
+func GetJob(id int) (*models.Job, error) {
+	job := &models.Job{ID: id}
+	if err := job.FindById(); err != nil {
+		return nil, err
+	}
+	if err := job.Unmarshal(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// SearchJobs 分页查询任务列表
+func SearchJobs(req *JobSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyJobTableName)
+	if req.Name != "" {
+		db = db.Where("name like ?", "%"+req.Name+"%")
+	}
+	if req.RunOn != "" {
+		db = db.Where("run_on = ?", req.RunOn)
+	}
+	if req.Type > 0 {
+		db = db.Where("type = ?", req.Type)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	jobs := make([]models.Job, 0)
+	if err := db.Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		_ = jobs[i].Unmarshal()
+	}
+	return &PageResult{List: jobs, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// checkNewSpec 校验创建或更新时提交的定时表达式, 不接受有歧义的 5 段表达式
+// models 的 Check 为了兼容 etcd 中已经保存的任务仍然接受 5 段表达式, 只有 admin 保存时才拒绝
+func checkNewSpec(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	_, err := schedule.CheckSpec(spec)
+	return err
+}
+
+// publishJob 将任务写入其运行节点对应的 etcd key, 未指定节点的任务不发布
+func publishJob(job *models.Job, rev int64) error {
+	if job.RunOn == "" {
+		return nil
+	}
+	_, err := etcdclient.PutWithModRev(JobKey(job.RunOn, job.ID), job.Val(), rev)
+	return err
+}
+
+// jobStatus 根据是否指定了运行节点返回任务的分配状态
+func jobStatus(runOn string) int {
+	if runOn == "" {
+		return models.JobStatusNotAssigned
+	}
+	return models.JobStatusAssigned
+}
+
+// checkRunOn 校验指定的运行节点是否存在
+func checkRunOn(runOn string) error {
+	if runOn == "" {
+		return nil
+	}
+	node := &models.Node{UUID: runOn}
+	if err := node.FindByUUID(); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cronyErrors.ErrNodeNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// checkHookScripts 校验钩子引用的预设脚本是否存在
+func checkHookScripts(job *models.Job) error {
+	for _, hook := range job.GetHooks() {
+		script := &models.Script{ID: hook.ScriptID}
+		if err := script.FindById(); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: script#%d not found", cronyErrors.ErrIllegalJobHook, hook.ScriptID)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"fmt"
+)
+
+// JobLogSearchReq 是任务日志的查询条件
+type JobLogSearchReq struct {
+	PageReq
+	Name          string `form:"name"`            // 任务名称, 模糊匹配
+	JobId         int    `form:"job_id"`          // 任务 ID
+	NodeUUID      string `form:"node_uuid"`       // 执行节点
+	Success       *bool  `form:"success"`         // 是否执行成功
+	Status        *int   `form:"status"`          // 执行状态
+	CatchUp       *bool  `form:"catch_up"`        // 是否为补执行
+	WorkflowRunID int    `form:"workflow_run_id"` // 所属的工作流运行
+	StartTime     int64  `form:"start_time"`      // 开始时间下限(unix 秒)
+	EndTime       int64  `form:"end_time"`        // 开始时间上限(unix 秒)
+}
+
+// SearchJobLogs 按条件分页查询任务执行日志, 结果按开始时间倒序
+func SearchJobLogs(req *JobLogSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyJobLogTableName)
+	if req.Name != "" {
+		db = db.Where("name like ?", "%"+req.Name+"%")
+	}
+	if req.JobId > 0 {
+		db = db.Where("job_id = ?", req.JobId)
+	}
+	if req.NodeUUID != "" {
+		db = db.Where("node_uuid = ?", req.NodeUUID)
+	}
+	if req.Success != nil {
+		db = db.Where("success = ?", *req.Success)
+	}
+	if req.Status != nil {
+		db = db.Where("status = ?", *req.Status)
+	}
+	if req.CatchUp != nil {
+		db = db.Where("catch_up = ?", *req.CatchUp)
+	}
+	if req.WorkflowRunID > 0 {
+		db = db.Where("workflow_run_id = ?", req.WorkflowRunID)
+	}
+	if req.StartTime > 0 {
+		db = db.Where("start_time >= ?", req.StartTime)
+	}
+	if req.EndTime > 0 {
+		db = db.Where("start_time <= ?", req.EndTime)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	logs := make([]models.JobLog, 0)
+	if err := db.Order("start_time desc, id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return &PageResult{List: logs, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// GetJobLog 根据 ID 查询一条任务日志
+func GetJobLog(id int) (*models.JobLog, error) {
+	jobLog := &models.JobLog{}
+	if err := dbclient.GetMysqlDB().Table(models.CronyJobLogTableName).Where("id = ?", id).First(jobLog).Error; err != nil {
+		return nil, err
+	}
+	return jobLog, nil
+}
+
+// GetJobLogAttempts 查询一条任务日志的全部尝试记录, 按尝试顺序排列
+func GetJobLogAttempts(id int) ([]models.JobLogAttempt, error) {
+	attempts := make([]models.JobLogAttempt, 0)
+	err := dbclient.GetMysqlDB().Table(models.CronyAttemptTableName).Where("job_log_id = ?", id).Order("attempt asc").Find(&attempts).Error
+	return attempts, err
+}
+
+// DeleteJobLog 删除一条任务日志及其尝试记录
+func DeleteJobLog(id int) error {
+	if err := dbclient.GetMysqlDB().Exec(fmt.Sprintf("delete from %s where job_log_id = ?", models.CronyAttemptTableName), id).Error; err != nil {
+		return err
+	}
+	return (&models.JobLog{ID: id}).Delete()
+}
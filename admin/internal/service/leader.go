@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"crony/common/pkg/config"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 集群中只允许一个 admin 实例执行的后台任务, 分别使用独立的选举
+const (
+	LeaderFailover   = "failover"   // 节点故障转移
+	LeaderAllocation = "allocation" // 分配未分配的任务
+	LeaderLogClean   = "log-clean"  // 清理过期的任务日志
+	LeaderWorkflow   = "workflow"   // 调度工作流并推进工作流运行
+)
+
+// defaultLeaderTtl 是配置中未设置 node-ttl 时, 选举会话租约的默认有效期(秒)
+const defaultLeaderTtl = 10
+
+// RunAsLeader 保证集群中同一时刻只有一个 admin 实例执行 fn
+// 当选后执行 fn, 领导者身份结束(租约丢失)或 stop 被关闭时, 关闭传给 fn 的 leaderStop 并等待 fn 返回,
+// 随后重新参与选举
+func RunAsLeader(name string, stop <-chan struct{}, fn func(leaderStop <-chan struct{})) {
+	ttl := config.GetConfigModels().System.NodeTtl
+	if ttl <= 0 {
+		ttl = defaultLeaderTtl
+	}
+	hostname, _ := os.Hostname()
+	value := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+
+	election := etcdclient.NewElection(name, ttl)
+	defer election.Close()
+
+	// stop 被关闭时取消正在阻塞的竞选
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for ctx.Err() == nil {
+		leaderCtx, err := election.Campaign(ctx, value)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.GetLogger().Warn(fmt.Sprintf("campaign for leader[%s] err: %s", name, err.Error()))
+				sleepOrStop(stop, time.Duration(ttl)*time.Second/2)
+			}
+			continue
+		}
+		logger.GetLogger().Info(fmt.Sprintf("became leader of [%s]", name))
+		done := make(chan struct{})
+		go func() {
+			fn(leaderCtx.Done())
+			close(done)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-leaderCtx.Done():
+		case <-done:
+		}
+		_ = election.Resign(context.Background())
+		<-done
+		logger.GetLogger().Info(fmt.Sprintf("leadership of [%s] ended", name))
+	}
+}
+
+// sleepOrStop 等待 d, 期间 stop 被关闭时返回 false
+func sleepOrStop(stop <-chan struct{}, d time.Duration) bool {
+	select {
+	case <-stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/logger"
+	"fmt"
+	"time"
+)
+
+// RunLogClean 按 log-clean-period(分钟)周期删除早于 log-clean-expiration(天)的任务日志, 直到 stop 被关闭
+// 任一配置项小于等于 0 时不做清理
+func RunLogClean(stop <-chan struct{}) {
+	system := config.GetConfigModels().System
+	if system.LogCleanPeriod <= 0 || system.LogCleanExpiration <= 0 {
+		<-stop
+		return
+	}
+	ticker := time.NewTicker(time.Duration(system.LogCleanPeriod) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n, err := CleanJobLogs(time.Now().AddDate(0, 0, -int(system.LogCleanExpiration)))
+			if err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("clean job logs err: %s", err.Error()))
+				continue
+			}
+			if n > 0 {
+				logger.GetLogger().Info(fmt.Sprintf("cleaned %d expired job logs", n))
+			}
+		}
+	}
+}
+
+// CleanJobLogs 删除开始时间早于 before 的任务日志及其尝试记录, 返回删除的任务日志条数
+func CleanJobLogs(before time.Time) (int64, error) {
+	if err := dbclient.GetMysqlDB().Exec(fmt.Sprintf("delete from %s where start_time < ?", models.CronyAttemptTableName), before.Unix()).Error; err != nil {
+		return 0, err
+	}
+	result := dbclient.GetMysqlDB().Exec(fmt.Sprintf("delete from %s where start_time < ?", models.CronyJobLogTableName), before.Unix())
+	return result.RowsAffected, result.Error
+}
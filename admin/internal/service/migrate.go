@@ -0,0 +1,96 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/schedule"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// AutoMigrate 根据模型定义创建或更新数据库表结构, 再迁移已经保存的数据
+func AutoMigrate() error {
+	if err := dbclient.GetMysqlDB().AutoMigrate(
+		&models.Node{},
+		&models.Job{},
+		&models.JobLog{},
+		&models.JobLogAttempt{},
+		&models.User{},
+		&models.Script{},
+		&models.Calendar{},
+		&models.Workflow{},
+		&models.WorkflowRun{},
+		&models.WorkflowRunStep{},
+	); err != nil {
+		return err
+	}
+	return migrateLegacySpecs()
+}
+
+// migrateLegacySpecs 把保存的 5 段定时表达式改写为调度时刻相同的 6 段表达式, 并同步到 etcd
+// 5 段表达式有歧义, 新的表达式只接受 6 段:
+// 任务的 5 段表达式之前由 cron.Parse 读作 秒 分 时 日 月, 改写为 "<秒 分 时 日 月> *";
+// 工作流从一开始就把 5 段表达式读作标准 crontab 的 分 时 日 月 星期, 改写为 "0 <分 时 日 月 星期>"
+// 每条改写都记录日志, 便于核对; 改写失败的记录日志后跳过, 不影响 admin 启动, 节点仍按之前的读法调度它们, 下次启动时重试
+func migrateLegacySpecs() error {
+	var jobs []models.Job
+	if err := dbclient.GetMysqlDB().Table(models.CronyJobTableName).Where("spec <> ''").Find(&jobs).Error; err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		spec, ok := schedule.LegacySpec(job.Spec)
+		if !ok {
+			continue
+		}
+		if err := job.Unmarshal(); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("migrate spec of job#%d err: %s", job.ID, err.Error()))
+			continue
+		}
+		old := job.Spec
+		job.Spec = spec
+		if err := dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Table(models.CronyJobTableName).Where("id = ?", job.ID).Update("spec", spec).Error; err != nil {
+				return err
+			}
+			return publishJob(job, 0)
+		}); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("migrate spec of job#%d err: %s", job.ID, err.Error()))
+			continue
+		}
+		logger.GetLogger().Info(fmt.Sprintf("job#%d spec %q is rewritten to %q, the schedule is unchanged", job.ID, old, spec))
+	}
+
+	var workflows []models.Workflow
+	if err := dbclient.GetMysqlDB().Table(models.CronyWorkflowTableName).Where("spec <> ''").Find(&workflows).Error; err != nil {
+		return err
+	}
+	for i := range workflows {
+		workflow := &workflows[i]
+		if _, ok := schedule.LegacySpec(workflow.Spec); !ok {
+			continue
+		}
+		if err := workflow.Unmarshal(); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("migrate spec of workflow#%d err: %s", workflow.ID, err.Error()))
+			continue
+		}
+		old := workflow.Spec
+		workflow.Spec = "0 " + strings.Join(strings.Fields(old), " ")
+		if err := dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Table(models.CronyWorkflowTableName).Where("id = ?", workflow.ID).Update("spec", workflow.Spec).Error; err != nil {
+				return err
+			}
+			_, err := etcdclient.Put(WorkflowKey(workflow.ID), workflow.Val())
+			return err
+		}); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("migrate spec of workflow#%d err: %s", workflow.ID, err.Error()))
+			continue
+		}
+		logger.GetLogger().Info(fmt.Sprintf("workflow#%d spec %q is rewritten to %q, the schedule is unchanged", workflow.ID, old, workflow.Spec))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"gorm.io/gorm"
+)
+
+// NodeSearchReq 是节点列表的查询条件
+type NodeSearchReq struct {
+	PageReq
+	IP       string `form:"ip"`       // 节点 IP
+	Hostname string `form:"hostname"` // 主机名, 模糊匹配
+	Alive    *bool  `form:"alive"`    // 是否在线
+}
+
+// NodeStatus 是带有 etcd 实时在线状态的节点信息
+type NodeStatus struct {
+	models.Node
+	Alive    bool  `json:"alive"`     // 节点在 etcd 中的注册信息是否仍然存在
+	JobCount int64 `json:"job_count"` // 分配到该节点的任务数量
+}
+
+// GetAliveNodeUUIDs 从 etcd 中读取所有在线节点的 UUID
+// 节点以租约的方式注册在 /crony/node/<node_uuid>, 租约过期即视为下线
+func GetAliveNodeUUIDs() (map[string]bool, error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdNodeProfile, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	alive := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		alive[strings.TrimPrefix(string(kv.Key), etcdclient.KeyEtcdNodeProfile)] = true
+	}
+	return alive, nil
+}
+
+// SearchNodes 分页查询节点, 并附带每个节点的实时在线状态
+func SearchNodes(req *NodeSearchReq) (*PageResult, error) {
+	req.Normalize()
+	alive, err := GetAliveNodeUUIDs()
+	if err != nil {
+		return nil, err
+	}
+	db := dbclient.GetMysqlDB().Table(models.CronyNodeTableName)
+	if req.IP != "" {
+		db = db.Where("ip = ?", req.IP)
+	}
+	if req.Hostname != "" {
+		db = db.Where("hostname like ?", "%"+req.Hostname+"%")
+	}
+	// 在线状态以 etcd 为准, 这里按 UUID 集合过滤
+	if req.Alive != nil {
+		uuids := make([]string, 0, len(alive))
+		for uuid := range alive {
+			uuids = append(uuids, uuid)
+		}
+		if *req.Alive {
+			db = db.Where("uuid in ?", uuids)
+		} else if len(uuids) > 0 {
+			db = db.Where("uuid not in ?", uuids)
+		}
+	}
+	var total int64
+	if err = db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	nodes := make([]models.Node, 0)
+	if err = db.Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	list := make([]NodeStatus, 0, len(nodes))
+	for _, node := range nodes {
+		status := NodeStatus{Node: node, Alive: alive[node.UUID]}
+		dbclient.GetMysqlDB().Table(models.CronyJobTableName).Where("run_on = ?", node.UUID).Count(&status.JobCount)
+		list = append(list, status)
+	}
+	return &PageResult{List: list, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// GetNode 根据 UUID 查询节点及其在线状态
+func GetNode(uuid string) (*NodeStatus, error) {
+	node := &models.Node{UUID: uuid}
+	if err := node.FindByUUID(); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cronyErrors.ErrNodeNotFound
+		}
+		return nil, err
+	}
+	resp, err := etcdclient.Get(fmt.Sprintf(etcdclient.KeyEtcdNode, uuid), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	status := &NodeStatus{Node: *node, Alive: resp.Count > 0}
+	dbclient.GetMysqlDB().Table(models.CronyJobTableName).Where("run_on = ?", uuid).Count(&status.JobCount)
+	return status, nil
+}
+
+// DeleteNode 删除一个已下线的节点记录, 在线节点不允许删除
+func DeleteNode(uuid string) error {
+	status, err := GetNode(uuid)
+	if err != nil {
+		return err
+	}
+	if status.Alive {
+		return cronyErrors.ErrNodeIsAlive
+	}
+	return status.Node.Delete()
+}
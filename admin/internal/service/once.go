@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// MaxOnceWait 是同步等待一次性执行结果的最长时间
+const MaxOnceWait = 10 * time.Minute
+
+// RunJobOnce 写入 /crony/once/<job_id> 触发任务立即执行一次
+// targets 为空时由任务的运行节点执行, 任务未分配节点时由任意一个在线节点执行
+// wait 大于 0 时等待全部目标节点写回结果, 超时后返回已收到的结果
+func RunJobOnce(jobId int, targets []string, wait time.Duration) ([]*models.JobOnceResult, error) {
+	job, err := GetJob(jobId)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		targets = []string{models.OnceTargetAny}
+		if job.RunOn != "" {
+			targets = []string{job.RunOn}
+		}
+	}
+	if !models.IsOnceTargetAny(targets) {
+		for _, uuid := range targets {
+			if uuid == models.OnceTargetAny {
+				return nil, cronyErrors.ErrIllegalOnceTarget
+			}
+			if err = checkRunOn(uuid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// 触发 key 绑定租约, 目标节点不在线、一直没有写回结果时由 etcd 在到期后删除
+	resp, err := etcdclient.PutWithTtl(fmt.Sprintf(etcdclient.KeyEtcdOnce, jobId), strings.Join(targets, ","), models.OnceTtl)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*models.JobOnceResult, 0, len(targets))
+	if wait <= 0 {
+		return results, nil
+	}
+	if wait > MaxOnceWait {
+		wait = MaxOnceWait
+	}
+	return waitOnceResults(jobId, resp.Header.Revision, len(targets), wait)
+}
+
+// waitOnceResults 从触发时的版本号开始监听结果, 直到收齐 count 个或超时
+func waitOnceResults(jobId int, triggerRev int64, count int, wait time.Duration) ([]*models.JobOnceResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	results := make([]*models.JobOnceResult, 0, count)
+	rch := etcdclient.GetEtcdClient().Watch(ctx, fmt.Sprintf(etcdclient.KeyEtcdJobOnceResultProfile, jobId),
+		clientv3.WithPrefix(), clientv3.WithRev(triggerRev), clientv3.WithFilterDelete())
+	for len(results) < count {
+		select {
+		case <-ctx.Done():
+			return results, nil
+		case wresp, ok := <-rch:
+			if !ok {
+				return results, nil
+			}
+			if err := wresp.Err(); err != nil {
+				return results, err
+			}
+			for _, ev := range wresp.Events {
+				result := new(models.JobOnceResult)
+				if err := json.Unmarshal(ev.Kv.Value, result); err != nil || result.TriggerRev != triggerRev {
+					continue
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
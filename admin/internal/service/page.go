@@ -0,0 +1,38 @@
+package service
+
+const (
+	defaultPageSize = 20  // 默认每页条数
+	maxPageSize     = 500 // 每页条数上限
+)
+
+// PageReq 是分页查询的公共参数
+type PageReq struct {
+	Page     int `json:"page" form:"page"`           // 页码, 从 1 开始
+	PageSize int `json:"page_size" form:"page_size"` // 每页条数
+}
+
+// Normalize 修正非法的分页参数
+func (p *PageReq) Normalize() {
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+	if p.PageSize <= 0 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+}
+
+// Offset 返回当前页在结果集中的偏移量
+func (p *PageReq) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// PageResult 是分页查询的公共返回值
+type PageResult struct {
+	List     interface{} `json:"list"`      // 当前页数据
+	Total    int64       `json:"total"`     // 总条数
+	Page     int         `json:"page"`      // 页码
+	PageSize int         `json:"page_size"` // 每页条数
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+// GetJobProcs 返回集群内指定任务正在执行的全部进程
+func GetJobProcs(jobId int) ([]*models.JobProc, error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdProcProfile, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]*models.JobProc, 0)
+	for _, kv := range resp.Kvs {
+		proc, err := models.ParseProc(string(kv.Key), kv.Value)
+		if err != nil || proc.JobID != jobId {
+			continue
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
+
+// KillJobProc 将进程记录标记为需要终止, 进程所在节点监听到后终止对应的进程组
+func KillJobProc(proc *models.JobProc) error {
+	val, err := proc.MarkKilled()
+	if err != nil {
+		return err
+	}
+	// 保留记录原有的租约; 记录已不存在时 etcd 会返回错误
+	_, err = etcdclient.Put(proc.Key(), val, clientv3.WithIgnoreLease())
+	if err == rpctypes.ErrKeyNotFound {
+		return cronyErrors.ErrNotFound
+	}
+	return err
+}
+
+// KillJob 终止任务正在执行的进程
+// nodeUUID 为空时终止集群内该任务的全部进程, 否则只终止指定节点上的进程; pid 不为 0 时只终止该进程
+// 返回被标记终止的进程
+func KillJob(jobId int, nodeUUID string, pid int) ([]*models.JobProc, error) {
+	procs, err := GetJobProcs(jobId)
+	if err != nil {
+		return nil, err
+	}
+	killed := make([]*models.JobProc, 0, len(procs))
+	for _, proc := range procs {
+		if (nodeUUID != "" && proc.NodeUUID != nodeUUID) || (pid != 0 && proc.ID != pid) {
+			continue
+		}
+		if err = KillJobProc(proc); err != nil {
+			if err == cronyErrors.ErrNotFound {
+				// 进程在查询之后已经自行结束
+				continue
+			}
+			return killed, err
+		}
+		killed = append(killed, proc)
+	}
+	if len(killed) == 0 {
+		return nil, cronyErrors.ErrNotFound
+	}
+	return killed, nil
+}
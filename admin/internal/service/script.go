@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"time"
+)
+
+// ScriptSearchReq 是预设脚本列表的查询条件
+type ScriptSearchReq struct {
+	PageReq
+	Name string `form:"name"` // 脚本名称, 模糊匹配
+}
+
+// CreateScript 创建预设脚本
+func CreateScript(script *models.Script) error {
+	if err := script.Check(); err != nil {
+		return err
+	}
+	script.Created = time.Now().Unix()
+	_, err := script.Insert()
+	return err
+}
+
+// UpdateScript 更新预设脚本
+func UpdateScript(script *models.Script) error {
+	if err := script.Check(); err != nil {
+		return err
+	}
+	old := &models.Script{ID: script.ID}
+	if err := old.FindById(); err != nil {
+		return err
+	}
+	script.Created = old.Created
+	script.Updated = time.Now().Unix()
+	return script.Update()
+}
+
+// DeleteScript 删除预设脚本
+func DeleteScript(id int) error {
+	script := &models.Script{ID: id}
+	if err := script.FindById(); err != nil {
+		return err
+	}
+	return script.Delete()
+}
+
+// GetScript 根据 ID 查询预设脚本
+func GetScript(id int) (*models.Script, error) {
+	script := &models.Script{ID: id}
+	if err := script.FindById(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// SearchScripts 分页查询预设脚本
+func SearchScripts(req *ScriptSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyScriptTableName)
+	if req.Name != "" {
+		db = db.Where("name like ?", "%"+req.Name+"%")
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	scripts := make([]models.Script, 0)
+	if err := db.Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&scripts).Error; err != nil {
+		return nil, err
+	}
+	return &PageResult{List: scripts, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
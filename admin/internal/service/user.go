@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserSearchReq 是用户列表的查询条件
+type UserSearchReq struct {
+	PageReq
+	UserName string `form:"username"` // 用户名, 模糊匹配
+	Email    string `form:"email"`    // 邮箱
+	Role     int    `form:"role"`     // 角色
+}
+
+// userColumns 是对外返回的用户字段, 不包含密码
+var userColumns = []string{"id", "username", "email", "role", "created", "updated"}
+
+// CreateUser 创建用户, 密码以 bcrypt 哈希的形式保存
+func CreateUser(user *models.User) error {
+	user.UserName = strings.TrimSpace(user.UserName)
+	if user.UserName == "" {
+		return cronyErrors.ErrEmptyUserName
+	}
+	if user.Password == "" {
+		return cronyErrors.ErrEmptyPassword
+	}
+	var count int64
+	if err := dbclient.GetMysqlDB().Table(models.CronyUserTableName).Where("username = ?", user.UserName).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return cronyErrors.ErrUserNameExisted
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hash)
+	if user.Role != models.RoleAdmin {
+		user.Role = models.RoleNormal
+	}
+	user.Created = time.Now().Unix()
+	_, err = user.Insert()
+	user.Password = ""
+	return err
+}
+
+// UpdateUser 更新用户信息, 密码为空时保留原密码
+func UpdateUser(user *models.User) error {
+	old := &models.User{ID: user.ID}
+	if err := old.FindById(); err != nil {
+		return err
+	}
+	if user.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.Password = string(hash)
+	}
+	user.Updated = time.Now().Unix()
+	// Updates 会忽略零值字段, 因此空密码不会覆盖原密码
+	err := user.Update()
+	user.Password = ""
+	return err
+}
+
+// DeleteUser 删除用户
+func DeleteUser(id int) error {
+	user := &models.User{ID: id}
+	if err := user.FindById(); err != nil {
+		return err
+	}
+	return user.Delete()
+}
+
+// GetUser 根据 ID 查询用户, 返回值中不包含密码
+func GetUser(id int) (*models.User, error) {
+	user := &models.User{ID: id}
+	if err := user.FindById(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SearchUsers 分页查询用户, 返回值中不包含密码
+func SearchUsers(req *UserSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyUserTableName)
+	if req.UserName != "" {
+		db = db.Where("username like ?", "%"+req.UserName+"%")
+	}
+	if req.Email != "" {
+		db = db.Where("email = ?", req.Email)
+	}
+	if req.Role > 0 {
+		db = db.Where("role = ?", req.Role)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0)
+	if err := db.Select(userColumns).Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return &PageResult{List: users, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
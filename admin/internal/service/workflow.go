@@ -0,0 +1,166 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WorkflowSearchReq 是工作流列表的查询条件
+type WorkflowSearchReq struct {
+	PageReq
+	Name string `form:"name"` // 工作流名称, 模糊匹配
+}
+
+// WorkflowKey 返回工作流在 etcd 中的 key: /crony/workflow/<workflow_id>
+func WorkflowKey(id int) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdWorkflow, id)
+}
+
+// CreateWorkflow 校验步骤引用的任务后在 MySQL 中创建工作流, 并发布到 etcd 由当选的 admin 实例按定时表达式调度
+// 发布失败时回滚插入, 不会留下一个列表中可见却永远不会被调度的工作流
+func CreateWorkflow(workflow *models.Workflow) error {
+	if err := workflow.Check(); err != nil {
+		return err
+	}
+	if err := checkNewSpec(workflow.Spec); err != nil {
+		return err
+	}
+	if err := checkWorkflowSteps(workflow); err != nil {
+		return err
+	}
+	if err := workflow.Marshal(); err != nil {
+		return err
+	}
+	workflow.Created = time.Now().Unix()
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyWorkflowTableName).Create(workflow).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Put(WorkflowKey(workflow.ID), workflow.Val())
+		return err
+	})
+}
+
+// UpdateWorkflow 更新 MySQL 中的工作流并同步到 etcd
+// 已经开始的运行使用开始时的步骤和连线快照, 不受影响
+func UpdateWorkflow(workflow *models.Workflow) error {
+	if err := workflow.Check(); err != nil {
+		return err
+	}
+	if err := checkNewSpec(workflow.Spec); err != nil {
+		return err
+	}
+	if err := checkWorkflowSteps(workflow); err != nil {
+		return err
+	}
+	if err := workflow.Marshal(); err != nil {
+		return err
+	}
+	old := &models.Workflow{ID: workflow.ID}
+	if err := old.FindById(); err != nil {
+		return err
+	}
+	workflow.Created = old.Created
+	workflow.Updated = time.Now().Unix()
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		// Select("*") 使零值字段(如清空定时表达式)同样被更新
+		if err := tx.Table(models.CronyWorkflowTableName).Where("id = ?", workflow.ID).Select("*").Updates(workflow).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Put(WorkflowKey(workflow.ID), workflow.Val())
+		return err
+	})
+}
+
+// DeleteWorkflow 删除工作流, 已有的运行记录保留
+func DeleteWorkflow(id int) error {
+	workflow := &models.Workflow{ID: id}
+	if err := workflow.FindById(); err != nil {
+		return err
+	}
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("delete from %s where id = ?", models.CronyWorkflowTableName), id).Error; err != nil {
+			return err
+		}
+		_, err := etcdclient.Delete(WorkflowKey(id))
+		return err
+	})
+}
+
+// GetWorkflow 根据 ID 查询工作流
+func GetWorkflow(id int) (*models.Workflow, error) {
+	workflow := &models.Workflow{ID: id}
+	if err := workflow.FindById(); err != nil {
+		return nil, err
+	}
+	if err := workflow.Unmarshal(); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+// SearchWorkflows 分页查询工作流
+func SearchWorkflows(req *WorkflowSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyWorkflowTableName)
+	if req.Name != "" {
+		db = db.Where("name like ?", "%"+req.Name+"%")
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	workflows := make([]models.Workflow, 0)
+	if err := db.Order("id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&workflows).Error; err != nil {
+		return nil, err
+	}
+	for i := range workflows {
+		_ = workflows[i].Unmarshal()
+	}
+	return &PageResult{List: workflows, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// checkWorkflowSteps 校验步骤引用的任务和执行节点是否存在
+func checkWorkflowSteps(workflow *models.Workflow) error {
+	for _, s := range workflow.Steps {
+		job := &models.Job{ID: s.JobID}
+		if err := job.FindById(); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: job#%d of step %q not found", cronyErrors.ErrIllegalWorkflow, s.JobID, s.Name)
+			}
+			return err
+		}
+		if err := checkRunOn(s.RunOn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workflowsUsingJob 返回引用了任务的工作流ID
+func workflowsUsingJob(jobId int) ([]int, error) {
+	var workflows []models.Workflow
+	if err := dbclient.GetMysqlDB().Table(models.CronyWorkflowTableName).Select("id, steps").Find(&workflows).Error; err != nil {
+		return nil, err
+	}
+	var ids []int
+	for i := range workflows {
+		if err := workflows[i].Unmarshal(); err != nil {
+			continue
+		}
+		for _, s := range workflows[i].Steps {
+			if s.JobID == jobId {
+				ids = append(ids, workflows[i].ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
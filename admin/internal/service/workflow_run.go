@@ -0,0 +1,324 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxStepOutput 是步骤记录中输出和失败原因的最大长度, 完整的输出见对应的任务日志
+const maxStepOutput = 512
+
+// workflowMu 保证本实例内同一时刻只有一个 goroutine 推进工作流运行
+// 多个 admin 实例之间由步骤状态的条件更新保证同一步骤只被触发一次
+var workflowMu sync.Mutex
+
+// WorkflowRunSearchReq 是工作流运行的查询条件
+type WorkflowRunSearchReq struct {
+	PageReq
+	WorkflowID int    `form:"workflow_id"` // 工作流ID
+	Status     *int   `form:"status"`      // 状态
+	Trigger    string `form:"trigger"`     // 触发方式
+}
+
+// StepKey 返回步骤触发在 etcd 中的 key: /crony/step/<run_id>/<step>
+func StepKey(runId int, step string) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdStep, runId, step)
+}
+
+// StepResultKey 返回步骤结果在 etcd 中的 key: /crony/step-result/<run_id>/<step>
+func StepResultKey(runId int, step string) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdStepResult, runId, step)
+}
+
+// RunWorkflow 创建工作流的一次运行, 并触发没有上游的步骤
+// fireTime 为调度时刻, 手动触发时为零值
+func RunWorkflow(id int, trigger string, fireTime time.Time) (*models.WorkflowRun, error) {
+	workflow, err := GetWorkflow(id)
+	if err != nil {
+		return nil, err
+	}
+	run := &models.WorkflowRun{
+		WorkflowID: workflow.ID,
+		Name:       workflow.Name,
+		Status:     models.WorkflowStatusRunning,
+		Trigger:    trigger,
+		Dag:        workflow.Dag(),
+		StartTime:  time.Now().Unix(),
+	}
+	if !fireTime.IsZero() {
+		run.FireTime = fireTime.Unix()
+	}
+	if err = run.Marshal(); err != nil {
+		return nil, err
+	}
+	err = dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(models.CronyWorkflowRunTableName).Create(run).Error; err != nil {
+			return err
+		}
+		for _, s := range run.Dag.Steps {
+			step := &models.WorkflowRunStep{RunID: run.ID, Step: s.Name, JobID: s.JobID, Status: models.WorkflowStatusPending}
+			if err := tx.Table(models.CronyWorkflowRunStepTableName).Create(step).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.GetLogger().Info(fmt.Sprintf("start workflow#%d run#%d by %s", workflow.ID, run.ID, trigger))
+	if err = advanceRun(run.ID); err != nil {
+		return nil, err
+	}
+	return GetWorkflowRun(run.ID)
+}
+
+// GetWorkflowRun 查询工作流运行及其各步骤的状态
+func GetWorkflowRun(id int) (*models.WorkflowRun, error) {
+	run := &models.WorkflowRun{ID: id}
+	if err := run.FindById(); err != nil {
+		return nil, err
+	}
+	if err := run.Unmarshal(); err != nil {
+		return nil, err
+	}
+	steps, err := run.FindSteps()
+	if err != nil {
+		return nil, err
+	}
+	run.Steps = steps
+	return run, nil
+}
+
+// SearchWorkflowRuns 分页查询工作流运行, 结果按开始时间倒序, 不包含各步骤的状态
+func SearchWorkflowRuns(req *WorkflowRunSearchReq) (*PageResult, error) {
+	req.Normalize()
+	db := dbclient.GetMysqlDB().Table(models.CronyWorkflowRunTableName)
+	if req.WorkflowID > 0 {
+		db = db.Where("workflow_id = ?", req.WorkflowID)
+	}
+	if req.Status != nil {
+		db = db.Where("status = ?", *req.Status)
+	}
+	if req.Trigger != "" {
+		db = db.Where("trigger_type = ?", req.Trigger)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	runs := make([]models.WorkflowRun, 0)
+	if err := db.Order("start_time desc, id desc").Offset(req.Offset()).Limit(req.PageSize).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		_ = runs[i].Unmarshal()
+	}
+	return &PageResult{List: runs, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// RetryWorkflowRun 重新执行工作流运行中失败的子图
+// step 为空时重试全部失败的步骤, 否则重试指定的步骤; 被重试的步骤及其全部下游步骤重置为等待状态, 再按连线重新判断
+// 运行仍在执行中时只能重试指定的、状态为执行中的步骤, 用于执行节点宕机后步骤一直没有结果的情况
+func RetryWorkflowRun(id int, step string) (*models.WorkflowRun, error) {
+	if err := resetWorkflowRun(id, step); err != nil {
+		return nil, err
+	}
+	if err := advanceRun(id); err != nil {
+		return nil, err
+	}
+	return GetWorkflowRun(id)
+}
+
+// resetWorkflowRun 把需要重试的步骤及其下游步骤重置为等待状态, 并把运行标记为执行中
+func resetWorkflowRun(id int, step string) error {
+	workflowMu.Lock()
+	defer workflowMu.Unlock()
+	run, err := GetWorkflowRun(id)
+	if err != nil {
+		return err
+	}
+	status := make(map[string]int, len(run.Steps))
+	for _, s := range run.Steps {
+		status[s.Step] = s.Status
+	}
+	var roots []string
+	if step != "" {
+		if _, ok := run.Dag.Step(step); !ok {
+			return fmt.Errorf("%w: step %q not found in workflow run#%d", cronyErrors.ErrIllegalWorkflow, step, id)
+		}
+		if run.Status == models.WorkflowStatusRunning && status[step] != models.WorkflowStatusRunning {
+			return fmt.Errorf("%w: step %q is not running", cronyErrors.ErrWorkflowRunning, step)
+		}
+		roots = []string{step}
+	} else {
+		if run.Status == models.WorkflowStatusRunning {
+			return cronyErrors.ErrWorkflowRunning
+		}
+		for _, s := range run.Steps {
+			if s.Status == models.WorkflowStatusFailed {
+				roots = append(roots, s.Step)
+			}
+		}
+		if len(roots) == 0 {
+			return fmt.Errorf("%w: workflow run#%d has no failed step", cronyErrors.ErrIllegalWorkflow, id)
+		}
+	}
+	reset := run.Dag.Descendants(roots)
+	return dbclient.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		for _, s := range run.Steps {
+			if !reset[s.Step] {
+				continue
+			}
+			// attempt 加 1 后, 上一次执行迟到的结果会被丢弃
+			if err := tx.Table(models.CronyWorkflowRunStepTableName).Where("id = ?", s.ID).Updates(map[string]interface{}{
+				"status": models.WorkflowStatusPending, "attempt": s.Attempt + 1, "node_uuid": "", "job_log_id": 0,
+				"output": "", "error": "", "start_time": 0, "end_time": 0,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Table(models.CronyWorkflowRunTableName).Where("id = ?", id).Updates(map[string]interface{}{
+			"status": models.WorkflowStatusRunning, "retries": run.Retries + 1, "end_time": 0,
+		}).Error
+	})
+}
+
+// advanceRun 按各步骤的状态触发可以执行的步骤、跳过条件不满足的步骤, 全部步骤结束后记录运行的结果
+func advanceRun(id int) error {
+	workflowMu.Lock()
+	defer workflowMu.Unlock()
+	run, err := GetWorkflowRun(id)
+	if err != nil {
+		return err
+	}
+	if run.Status != models.WorkflowStatusRunning {
+		return nil
+	}
+	status := make(map[string]int, len(run.Steps))
+	attempts := make(map[string]int, len(run.Steps))
+	for _, s := range run.Steps {
+		status[s.Step] = s.Status
+		attempts[s.Step] = s.Attempt
+	}
+	db := dbclient.GetMysqlDB().Table(models.CronyWorkflowRunStepTableName)
+	for {
+		start, skip := run.Dag.Resolve(status)
+		if len(start) == 0 && len(skip) == 0 {
+			break
+		}
+		for _, name := range skip {
+			if err = db.Session(&gorm.Session{}).Where("run_id = ? and step = ? and status = ?", id, name, models.WorkflowStatusPending).
+				Updates(map[string]interface{}{"status": models.WorkflowStatusSkipped, "end_time": time.Now().Unix()}).Error; err != nil {
+				return err
+			}
+		}
+		for _, name := range start {
+			if startErr := startStep(run, name, attempts[name]); startErr != nil {
+				// 无法触发的步骤记为失败, 下一轮按失败继续判断下游
+				logger.GetLogger().Warn(fmt.Sprintf("start step %s of workflow run#%d err: %s", name, id, startErr.Error()))
+				status[name] = models.WorkflowStatusFailed
+				if err = db.Session(&gorm.Session{}).Where("run_id = ? and step = ?", id, name).Updates(map[string]interface{}{
+					"status": models.WorkflowStatusFailed, "error": truncate(startErr.Error(), maxStepOutput), "end_time": time.Now().Unix(),
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+	}
+	done, success := run.Dag.Finished(status)
+	if !done {
+		return nil
+	}
+	result := models.WorkflowStatusSuccess
+	if !success {
+		result = models.WorkflowStatusFailed
+	}
+	logger.GetLogger().Info(fmt.Sprintf("workflow#%d run#%d finished with status %d", run.WorkflowID, id, result))
+	return dbclient.GetMysqlDB().Table(models.CronyWorkflowRunTableName).
+		Where("id = ? and status = ?", id, models.WorkflowStatusRunning).
+		Updates(map[string]interface{}{"status": result, "end_time": time.Now().Unix()}).Error
+}
+
+// startStep 把步骤标记为执行中, 并写入 /crony/step/<run_id>/<step> 触发节点执行
+// 步骤已经被其他 admin 实例触发时直接返回
+func startStep(run *models.WorkflowRun, name string, attempt int) error {
+	step, _ := run.Dag.Step(name)
+	target, err := stepTarget(step)
+	if err != nil {
+		return err
+	}
+	res := dbclient.GetMysqlDB().Table(models.CronyWorkflowRunStepTableName).
+		Where("run_id = ? and step = ? and status = ?", run.ID, name, models.WorkflowStatusPending).
+		Updates(map[string]interface{}{"status": models.WorkflowStatusRunning, "start_time": time.Now().Unix()})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	b, err := json.Marshal(&models.WorkflowStepTrigger{RunID: run.ID, Step: name, JobID: step.JobID, Attempt: attempt, Target: target})
+	if err != nil {
+		return err
+	}
+	_, err = etcdclient.Put(StepKey(run.ID, name), string(b))
+	return err
+}
+
+// stepTarget 返回执行步骤的节点: 步骤指定的节点, 其次是任务的运行节点, 都没有时由任意一个在线节点执行
+func stepTarget(step *models.WorkflowStep) (string, error) {
+	if step.RunOn != "" {
+		return step.RunOn, nil
+	}
+	job := &models.Job{ID: step.JobID}
+	if err := job.FindById(); err != nil {
+		return "", fmt.Errorf("find job#%d err: %w", step.JobID, err)
+	}
+	if job.RunOn != "" {
+		return job.RunOn, nil
+	}
+	return models.OnceTargetAny, nil
+}
+
+// applyStepResult 记录节点写回的步骤结果并继续推进工作流运行
+// 过期的结果(重试前的执行)只删除, 不记录; rev 为结果 key 的 ModRevision, 删除时不会误删之后写入的结果
+func applyStepResult(result *models.WorkflowStepResult, rev int64) error {
+	status := models.WorkflowStatusFailed
+	if result.Success {
+		status = models.WorkflowStatusSuccess
+	}
+	res := dbclient.GetMysqlDB().Table(models.CronyWorkflowRunStepTableName).
+		Where("run_id = ? and step = ? and attempt = ? and status = ?", result.RunID, result.Step, result.Attempt, models.WorkflowStatusRunning).
+		Updates(map[string]interface{}{
+			"status": status, "node_uuid": result.NodeUUID, "job_log_id": result.JobLogID,
+			"output": truncate(result.Output, maxStepOutput), "error": truncate(result.Error, maxStepOutput),
+			"start_time": result.StartTime, "end_time": result.EndTime,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if err := etcdclient.DeleteWithModRev(StepResultKey(result.RunID, result.Step), rev); err != nil && err != cronyErrors.ErrValueMayChanged {
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	if _, err := etcdclient.Delete(StepKey(result.RunID, result.Step)); err != nil {
+		return err
+	}
+	return advanceRun(result.RunID)
+}
+
+// truncate 截断超过 n 字节的字符串
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/schedule"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/jakecoffman/cron"
+)
+
+// RunWorkflows 按定时表达式触发工作流, 并处理节点写回的步骤结果, 直到 stop 被关闭
+// 当选时先继续推进仍在执行中的运行, 并处理没有领导者期间写入的步骤结果
+// 应当通过 RunAsLeader 调用, 保证集群中只有一个实例在调度
+func RunWorkflows(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 先开始监听再做全量加载, 避免两者之间发生的事件被遗漏
+	wch := etcdclient.GetEtcdClient().Watch(ctx, etcdclient.KeyEtcdWorkflowProfile, clientv3.WithPrefix())
+	rch := etcdclient.GetEtcdClient().Watch(ctx, etcdclient.KeyEtcdStepResultProfile, clientv3.WithPrefix())
+
+	c := cron.New()
+	c.Start()
+	defer c.Stop()
+	loadWorkflows(c)
+	resumeWorkflowRuns()
+	loadStepResults()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case wresp, ok := <-wch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch workflows err: %s", err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				switch ev.Type {
+				case mvccpb.PUT:
+					scheduleWorkflow(c, ev.Kv.Value)
+				case mvccpb.DELETE:
+					id, err := strconv.Atoi(strings.TrimPrefix(string(ev.Kv.Key), etcdclient.KeyEtcdWorkflowProfile))
+					if err != nil {
+						continue
+					}
+					c.RemoveJob(workflowEntryName(id))
+				}
+			}
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch step results err: %s", err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type == mvccpb.PUT {
+					handleStepResult(ev.Kv)
+				}
+			}
+		}
+	}
+}
+
+// workflowEntryName 返回工作流在调度器中的名称
+func workflowEntryName(id int) string {
+	return fmt.Sprintf("workflow-%d", id)
+}
+
+// loadWorkflows 把 etcd 中的全部工作流加入调度器
+func loadWorkflows(c *cron.Cron) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdWorkflowProfile, clientv3.WithPrefix())
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("load workflows err: %s", err.Error()))
+		return
+	}
+	for _, kv := range resp.Kvs {
+		scheduleWorkflow(c, kv.Value)
+	}
+}
+
+// scheduleWorkflow 按工作流的定时表达式(重新)加入调度器, 定时表达式为空时只移除
+func scheduleWorkflow(c *cron.Cron, value []byte) {
+	workflow := new(models.Workflow)
+	if err := json.Unmarshal(value, workflow); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("unmarshal workflow err: %s", err.Error()))
+		return
+	}
+	name := workflowEntryName(workflow.ID)
+	c.RemoveJob(name)
+	if workflow.Spec == "" {
+		return
+	}
+	loc, err := workflow.Location()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("schedule workflow#%d err: %s", workflow.ID, err.Error()))
+		return
+	}
+	s, err := schedule.Parse(workflow.Spec, loc, workflow.DstGap == models.DstGapSkip)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("schedule workflow#%d err: %s", workflow.ID, err.Error()))
+		return
+	}
+	id := workflow.ID
+	c.Schedule(s, cron.FuncJob(func() {
+		if _, err := RunWorkflow(id, models.WorkflowTriggerSchedule, time.Now().Truncate(time.Second)); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("run workflow#%d err: %s", id, err.Error()))
+		}
+	}), name)
+}
+
+// resumeWorkflowRuns 继续推进执行中的运行, 补上领导者切换期间没有触发的步骤
+func resumeWorkflowRuns() {
+	var ids []int
+	if err := dbclient.GetMysqlDB().Table(models.CronyWorkflowRunTableName).
+		Where("status = ?", models.WorkflowStatusRunning).Pluck("id", &ids).Error; err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("load running workflow runs err: %s", err.Error()))
+		return
+	}
+	for _, id := range ids {
+		if err := advanceRun(id); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("resume workflow run#%d err: %s", id, err.Error()))
+		}
+	}
+}
+
+// loadStepResults 处理 etcd 中已有的步骤结果
+func loadStepResults() {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdStepResultProfile, clientv3.WithPrefix())
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("load step results err: %s", err.Error()))
+		return
+	}
+	for _, kv := range resp.Kvs {
+		handleStepResult(kv)
+	}
+}
+
+// handleStepResult 记录一个步骤结果, 失败时保留结果 key, 下次当选时重新处理
+func handleStepResult(kv *mvccpb.KeyValue) {
+	result := new(models.WorkflowStepResult)
+	if err := json.Unmarshal(kv.Value, result); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("step result[%s] unmarshal err: %s", string(kv.Key), err.Error()))
+		return
+	}
+	if err := applyStepResult(result, kv.ModRevision); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("apply result of step %s of workflow run#%d err: %s", result.Step, result.RunID, err.Error()))
+	}
+}
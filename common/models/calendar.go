@@ -0,0 +1,206 @@
+package models
+
+import (
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/utils"
+	"crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultBusinessDays 是未设置工作日时使用的工作日: 周一到周五
+var DefaultBusinessDays = []int{1, 2, 3, 4, 5}
+
+// Calendar 是一个命名日历, 包含节假日、工作日规则和维护窗口
+// 保存在 MySQL 中, 并发布到 etcd 的 /crony/calendar/<calendar_id>, 由节点在调度时使用
+type Calendar struct {
+	ID           int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                                      // 日历ID
+	Name         string `json:"name" gorm:"size:64;column:name;not null;index:idx_calendar_name" binding:"required"` // 日历名称
+	TimeZone     string `json:"time_zone" gorm:"size:64;column:time_zone;default:''"`                                // 判断日期使用的时区, 为空时使用任务的时区
+	HolidaySpec  []byte `json:"-" gorm:"type:mediumtext;column:holidays;default:null"`                               // 节假日（字节数组）
+	WeekdaySpec  []byte `json:"-" gorm:"size:64;column:business_days;default:null"`                                  // 工作日（字节数组）
+	BlackoutSpec []byte `json:"-" gorm:"type:text;column:blackouts;default:null"`                                    // 维护窗口（字节数组）
+	Note         string `json:"note" gorm:"size:512;column:note;default:''"`                                         // 备注
+	Created      int64  `json:"created" gorm:"column:created;not null"`                                              // 创建时间
+	Updated      int64  `json:"updated" gorm:"column:updated;default:0"`                                             // 更新时间
+
+	Holidays     []Holiday  `json:"holidays" gorm:"-"`      // 节假日
+	BusinessDays []int      `json:"business_days" gorm:"-"` // 工作日, 0 表示周日, 为空时为周一到周五
+	Blackouts    []Blackout `json:"blackouts" gorm:"-"`     // 维护窗口
+
+	holidays map[string]string // 日期到节假日名称, 由 Check 生成
+	weekdays [7]bool           // 是否为工作日, 由 Check 生成
+	loc      *time.Location    // 日历的时区, 未设置时为 nil
+}
+
+// Holiday 是一个节假日
+type Holiday struct {
+	Date string `json:"date"` // 日期, 格式为 2006-01-02
+	Name string `json:"name"` // 名称, 记录在跳过原因中
+}
+
+// Blackout 是一个维护窗口, 包含开始时刻, 不包含结束时刻
+type Blackout struct {
+	Start string `json:"start"` // 开始时间, 格式为 2006-01-02 15:04
+	End   string `json:"end"`   // 结束时间, 格式为 2006-01-02 15:04
+	Note  string `json:"note"`  // 说明, 记录在跳过原因中
+}
+
+// Insert 插入新日历
+func (c *Calendar) Insert() (insertId int, err error) {
+	err = dbclient.GetMysqlDB().Table(CronyCalendarTableName).Create(c).Error
+	if err == nil {
+		insertId = c.ID
+	}
+	return
+}
+
+// Update 更新日历
+func (c *Calendar) Update() error {
+	return dbclient.GetMysqlDB().Table(CronyCalendarTableName).Select("*").Updates(c).Error
+}
+
+// Delete 删除日历
+func (c *Calendar) Delete() error {
+	return dbclient.GetMysqlDB().Exec(fmt.Sprintf("delete from %s where id = ?", CronyCalendarTableName), c.ID).Error
+}
+
+// FindById 根据ID查找日历
+func (c *Calendar) FindById() error {
+	return dbclient.GetMysqlDB().Table(CronyCalendarTableName).Where("id = ?", c.ID).First(c).Error
+}
+
+// TableName 返回表名
+func (c *Calendar) TableName() string {
+	return CronyCalendarTableName
+}
+
+// Val 返回日历的JSON字符串
+func (c *Calendar) Val() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// Check 校验日历, 并生成判断日期时使用的索引
+func (c *Calendar) Check() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return errors.ErrEmptyCalendarName
+	}
+	c.TimeZone = strings.TrimSpace(c.TimeZone)
+	c.loc = nil
+	if c.TimeZone != "" {
+		// 与任务的时区一样只接受 IANA 名称
+		loc, err := (&Job{TimeZone: c.TimeZone}).Location()
+		if err != nil {
+			return fmt.Errorf("%w: %s", errors.ErrIllegalCalendar, err.Error())
+		}
+		c.loc = loc
+	}
+	c.holidays = make(map[string]string, len(c.Holidays))
+	for i, h := range c.Holidays {
+		d, err := time.Parse(utils.TimeFormatDateV1, strings.TrimSpace(h.Date))
+		if err != nil {
+			return fmt.Errorf("%w: invalid holiday date %q", errors.ErrIllegalCalendar, h.Date)
+		}
+		c.Holidays[i].Date = d.Format(utils.TimeFormatDateV1)
+		c.holidays[c.Holidays[i].Date] = h.Name
+	}
+	days := c.BusinessDays
+	if len(days) == 0 {
+		days = DefaultBusinessDays
+	}
+	c.weekdays = [7]bool{}
+	for _, d := range days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("%w: business day %d is not in [0, 6]", errors.ErrIllegalCalendar, d)
+		}
+		c.weekdays[d] = true
+	}
+	for i, b := range c.Blackouts {
+		start, err := time.Parse(utils.TimeFormatMinute, strings.TrimSpace(b.Start))
+		if err != nil {
+			return fmt.Errorf("%w: invalid blackout start %q", errors.ErrIllegalCalendar, b.Start)
+		}
+		end, err := time.Parse(utils.TimeFormatMinute, strings.TrimSpace(b.End))
+		if err != nil {
+			return fmt.Errorf("%w: invalid blackout end %q", errors.ErrIllegalCalendar, b.End)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("%w: blackout end %q is not after start %q", errors.ErrIllegalCalendar, b.End, b.Start)
+		}
+		c.Blackouts[i].Start, c.Blackouts[i].End = start.Format(utils.TimeFormatMinute), end.Format(utils.TimeFormatMinute)
+	}
+	return nil
+}
+
+// Marshal 序列化节假日、工作日和维护窗口, 以便写入数据库
+func (c *Calendar) Marshal() (err error) {
+	if c.HolidaySpec, err = json.Marshal(c.Holidays); err != nil {
+		return
+	}
+	if c.WeekdaySpec, err = json.Marshal(c.BusinessDays); err != nil {
+		return
+	}
+	c.BlackoutSpec, err = json.Marshal(c.Blackouts)
+	return
+}
+
+// Unmarshal 反序列化节假日、工作日和维护窗口
+func (c *Calendar) Unmarshal() (err error) {
+	if len(c.HolidaySpec) > 0 {
+		if err = json.Unmarshal(c.HolidaySpec, &c.Holidays); err != nil {
+			return
+		}
+	}
+	if len(c.WeekdaySpec) > 0 {
+		if err = json.Unmarshal(c.WeekdaySpec, &c.BusinessDays); err != nil {
+			return
+		}
+	}
+	if len(c.BlackoutSpec) > 0 {
+		err = json.Unmarshal(c.BlackoutSpec, &c.Blackouts)
+	}
+	return
+}
+
+// In 返回 t 在日历时区中的时间, 日历未设置时区时使用 fallback
+// 以下判断方法都按传入时间所在时区的日期和墙上时间判断, 调用前需要先用 In 转换
+func (c *Calendar) In(t time.Time, fallback *time.Location) time.Time {
+	if c.loc != nil {
+		return t.In(c.loc)
+	}
+	return t.In(fallback)
+}
+
+// Holiday 判断 t 所在的日期是否为节假日, 返回节假日名称
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[t.Format(utils.TimeFormatDateV1)]
+	return name, ok
+}
+
+// IsBusinessDay 判断 t 所在的日期是否为工作日: 星期属于工作日, 且不是节假日
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if !c.weekdays[t.Weekday()] {
+		return false
+	}
+	_, holiday := c.Holiday(t)
+	return !holiday
+}
+
+// Blackout 返回 t 所在的维护窗口
+func (c *Calendar) Blackout(t time.Time) (*Blackout, bool) {
+	// 两端都是固定宽度的格式, 可以直接按字符串比较
+	wall := t.Format(utils.TimeFormatMinute)
+	for i := range c.Blackouts {
+		if b := &c.Blackouts[i]; wall >= b.Start && wall < b.End {
+			return b, true
+		}
+	}
+	return nil, false
+}
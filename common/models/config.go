@@ -3,11 +3,16 @@ package models
 import "fmt"
 
 const (
-	CronyNodeTableName   = "node"
-	CronyJobTableName    = "job"
-	CronyJobLogTableName = "job_log"
-	CronyUserTableName   = "user"
-	CronyScriptTableName = "script"
+	CronyNodeTableName            = "node"
+	CronyJobTableName             = "job"
+	CronyJobLogTableName          = "job_log"
+	CronyAttemptTableName         = "job_log_attempt"
+	CronyUserTableName            = "user"
+	CronyScriptTableName          = "script"
+	CronyCalendarTableName        = "calendar"
+	CronyWorkflowTableName        = "workflow"
+	CronyWorkflowRunTableName     = "workflow_run"
+	CronyWorkflowRunStepTableName = "workflow_run_step"
 )
 
 type (
@@ -44,14 +49,24 @@ type (
 		ReqTimeout  int64    `mapstructure:"req-timeout" json:"req-timeout" yaml:"req-timeout" ini:"req-timeout"`
 	}
 	System struct {
-		Env                string `mapstructure:"env" json:"env" yaml:"env" ini:"env"`
-		Addr               int    `mapstructure:"addr" json:"addr" yaml:"addr" ini:"addr"`
-		NodeTtl            int64  `mapstructure:"node-ttl" json:"node-ttl" yaml:"node-ttl" ini:"node-ttl"`
-		JobProcTtl         int64  `mapstructure:"job-proc-ttl" json:"job-proc-ttl" yaml:"job-proc-ttl" ini:"job-proc-ttl"`
+		Env             string `mapstructure:"env" json:"env" yaml:"env" ini:"env"`
+		Addr            int    `mapstructure:"addr" json:"addr" yaml:"addr" ini:"addr"`
+		NodeTtl         int64  `mapstructure:"node-ttl" json:"node-ttl" yaml:"node-ttl" ini:"node-ttl"`
+		JobProcTtl      int64  `mapstructure:"job-proc-ttl" json:"job-proc-ttl" yaml:"job-proc-ttl" ini:"job-proc-ttl"`
+		KillGracePeriod int64  `mapstructure:"kill-grace-period" json:"kill-grace-period" yaml:"kill-grace-period" ini:"kill-grace-period"`
+		// cgroup v2 的挂载点和节点使用的 slice, 任务的 cgroup 创建在 <cgroup-root>/<cgroup-slice>/ 下
+		CgroupRoot  string `mapstructure:"cgroup-root" json:"cgroup-root" yaml:"cgroup-root" ini:"cgroup-root"`
+		CgroupSlice string `mapstructure:"cgroup-slice" json:"cgroup-slice" yaml:"cgroup-slice" ini:"cgroup-slice"`
+		// 容器任务使用的运行时命令行, 例如 docker、podman、nerdctl
+		ContainerRuntime   string `mapstructure:"container-runtime" json:"container-runtime" yaml:"container-runtime" ini:"container-runtime"`
 		Version            string `mapstructure:"version" json:"version" yaml:"version" ini:"version"`
 		LogCleanPeriod     int64  `mapstructure:"log-clean-period" json:"log-clean-period" yaml:"log-clean-period" ini:"log-clean-period"`
 		LogCleanExpiration int64  `mapstructure:"log-clean-expiration" json:"log-clean-expiration" yaml:"log-clean-expiration" ini:"log-clean-expiration"`
 		CmdAutoAllocation  bool   `mapstructure:"cmd-auto-allocation" json:"cmd-auto-allocation" yaml:"cmd-auto-allocation" ini:"cmd-auto-allocation"`
+		// 自动分配任务时使用的策略: least-jobs、round-robin、hash、label-affinity
+		AllocationStrategy string `mapstructure:"allocation-strategy" json:"allocation-strategy" yaml:"allocation-strategy" ini:"allocation-strategy"`
+		// 节点标签, 用于 label-affinity 策略匹配任务的节点选择器
+		NodeLabels map[string]string `mapstructure:"node-labels" json:"node-labels" yaml:"node-labels" ini:"node-labels"`
 	}
 	Log struct {
 		Level         string `mapstructure:"level" json:"level" yaml:"level" ini:"level"`
@@ -63,6 +78,21 @@ type (
 		StacktraceKey string `mapstructure:"stacktrace-key" json:"stacktraceKey" yaml:"stacktrace-key" ini:"stacktrace-key"`
 		LogInConsole  bool   `mapstructure:"log-in-console" json:"logInConsole" yaml:"log-in-console" ini:"log-in-console"`
 	}
+	// Datasource 是 SQL 任务可以使用的数据源, 通过 database/sql 连接
+	Datasource struct {
+		Driver       string `mapstructure:"driver" json:"driver" yaml:"driver" ini:"driver"` // 驱动名, 默认 mysql
+		Dsn          string `mapstructure:"dsn" json:"dsn" yaml:"dsn" ini:"dsn"`
+		MaxIdleConns int    `mapstructure:"max-idle-conns" json:"maxIdleConns" yaml:"max-idle-conns" ini:"max-idle-conns"`
+		MaxOpenConns int    `mapstructure:"max-open-conns" json:"maxOpenConns" yaml:"max-open-conns" ini:"max-open-conns"`
+	}
+	// Plugin 是以外部可执行文件实现的任务类型, 节点通过标准输入输出上的 JSON 与其通信
+	Plugin struct {
+		Type     int      `mapstructure:"type" json:"type" yaml:"type" ini:"type"`                 // 任务类型, 不能与内置类型重复
+		Name     string   `mapstructure:"name" json:"name" yaml:"name" ini:"name"`                 // 类型名称
+		Path     string   `mapstructure:"path" json:"path" yaml:"path" ini:"path"`                 // 插件可执行文件的路径
+		Args     []string `mapstructure:"args" json:"args" yaml:"args" ini:"args"`                 // 执行插件时的参数
+		Validate bool     `mapstructure:"validate" json:"validate" yaml:"validate" ini:"validate"` // 保存任务时是否调用插件校验任务参数
+	}
 	Config struct {
 		WebHook WebHook `mapstructure:"webhook" json:"webhook" yaml:"webhook" ini:"webhook"`
 		Log     Log     `mapstructure:"log" json:"log" yaml:"log" ini:"log"`
@@ -70,6 +100,10 @@ type (
 		System  System  `mapstructure:"system" json:"system" yaml:"system" ini:"system"`
 		Mysql   Mysql   `mapstructure:"mysql" json:"mysql" yaml:"mysql" ini:"mysql"`
 		Etcd    Etcd    `mapstructure:"etcd" json:"etcd" yaml:"etcd" ini:"etcd"`
+		// SQL 任务的数据源, key 为任务中引用的数据源名称
+		Datasources map[string]Datasource `mapstructure:"datasources" json:"datasources" yaml:"datasources" ini:"datasources"`
+		// 以外部可执行文件实现的任务类型
+		Plugins []Plugin `mapstructure:"plugins" json:"plugins" yaml:"plugins" ini:"plugins"`
 	}
 )
 
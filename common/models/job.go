@@ -6,6 +6,7 @@ import (
 	"crony/common/pkg/utils/errors"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -13,8 +14,12 @@ import (
 type JobType int
 
 const (
-	JobTypeCmd  = JobType(1) // 命令任务
-	JobTypeHttp = JobType(2) // HTTP任务
+	JobTypeCmd       = JobType(1) // 命令任务
+	JobTypeHttp      = JobType(2) // HTTP任务
+	JobTypeShell     = JobType(3) // 脚本任务
+	JobTypeContainer = JobType(4) // 容器任务
+	JobTypeSQL       = JobType(5) // SQL任务
+	JobTypeGRPC      = JobType(6) // gRPC任务
 
 	HttpMethodGet  = 1 // GET请求
 	HttpMethodPost = 2 // POST请求
@@ -27,6 +32,18 @@ const (
 
 	ManualAllocation = 1 // 手动分配
 	AutoAllocation   = 2 // 自动分配
+
+	EnvInherit = 0 // 继承节点进程的环境变量, 再追加任务的环境变量
+	EnvClean   = 1 // 只使用任务的环境变量
+)
+
+// 并发策略, 决定上一次执行尚未结束时如何处理本次调度
+// 是否有执行尚未结束以 /crony/proc/ 下的进程记录为准, 对所有节点生效
+const (
+	ConcurrencyAllow   = 0 // 允许重叠执行
+	ConcurrencyForbid  = 1 // 跳过本次调度
+	ConcurrencyQueue   = 2 // 等待上一次执行结束后再执行
+	ConcurrencyReplace = 3 // 终止上一次执行后再执行
 )
 
 // 注册到 /crony/job/<node_uuid>/<job_id>
@@ -40,8 +57,8 @@ type Job struct {
 	// 任务执行超时时间设置，大于0时生效
 	Timeout int64 `json:"timeout" gorm:"size:13;column:timeout;default:0"` // 超时时间
 	// 任务执行失败重试次数，默认0
-	RetryTimes int `json:"retry_times" gorm:"size:4,column:retry_times;default:0"` // 重试次数
-	// 任务执行失败重试间隔，单位秒，小于0时立即重试
+	RetryTimes int `json:"retry_times" gorm:"size:4;column:retry_times;default:0"` // 重试次数
+	// 任务执行失败重试间隔，单位秒，小于0时立即重试，等于0时第n次重试前等待n分钟；设置了 Retry 时不再使用
 	RetryInterval int64   `json:"retry_interval" gorm:"size:10;column:retry_interval;default:0"`   // 重试间隔
 	Type          JobType `json:"job_type" gorm:"size:1;column:type;not null;" binding:"required"` // 任务类型
 	HttpMethod    int     `json:"http_method" gorm:"size:1;column:http_method"`                    // HTTP方法
@@ -51,10 +68,61 @@ type Job struct {
 	NotifyTo      []byte `json:"-" gorm:"size:256;column:notify_to;default:null"`                            // 通知对象（字节数组）
 	NotifyToArray []int  `json:"notify_to" gorm:"-"`                                                         // 通知对象数组
 	Spec          string `json:"spec" gorm:"size:64;column:spec;not null"`                                   // 定时表达式
+	TimeZone      string `json:"time_zone" gorm:"size:64;column:time_zone;default:''"`                       // 定时表达式使用的时区, IANA 名称, 为空时使用节点本地时区
+	DstGap        string `json:"dst_gap" gorm:"size:16;column:dst_gap;default:''"`                           // 调度时刻落在夏令时跳过的时间段时的处理方式
+	Misfire       string `json:"misfire" gorm:"size:16;column:misfire;default:''"`                           // 节点宕机期间错过调度时的处理方式
+	MisfireCap    int    `json:"misfire_cap" gorm:"column:misfire_cap;default:0"`                            // run_all 时最多补执行的次数
 	RunOn         string `json:"run_on" gorm:"size:128;column:run_on;index:idx_job_run_on;"`                 // 运行节点
+	Allocation    int    `json:"allocation" gorm:"size:1;column:allocation;not null;default:1"`              // 分配方式
+	Exclusive     bool   `json:"exclusive" gorm:"column:exclusive;not null;default:false"`                   // 任务出现在多个节点下时, 是否每个调度时刻只执行一次
+	Concurrency   int    `json:"concurrency" gorm:"size:1;column:concurrency;not null;default:0"`            // 并发策略
+	NodeSelector  []byte `json:"-" gorm:"size:512;column:node_selector;default:null"`                        // 节点选择器（字节数组）
+	HttpSpec      []byte `json:"-" gorm:"type:text;column:http_spec;default:null"`                           // HTTP请求定义（字节数组）
+	ContainerSpec []byte `json:"-" gorm:"type:text;column:container_spec;default:null"`                      // 容器定义（字节数组）
+	SQLSpec       []byte `json:"-" gorm:"type:text;column:sql_spec;default:null"`                            // SQL任务定义（字节数组）
+	GRPCSpec      []byte `json:"-" gorm:"type:mediumtext;column:grpc_spec;default:null"`                     // gRPC调用定义（字节数组）
+	PluginParams  []byte `json:"-" gorm:"type:text;column:plugin_params;default:null"`                       // 插件任务参数（字节数组）
+	HookSpec      []byte `json:"-" gorm:"type:text;column:hooks;default:null"`                               // 钩子定义（字节数组）
+	RetrySpec     []byte `json:"-" gorm:"type:text;column:retry_policy;default:null"`                        // 重试策略（字节数组）
+	CalendarSpec  []byte `json:"-" gorm:"type:text;column:calendars;default:null"`                           // 日历规则（字节数组）
 	Note          string `json:"note" gorm:"size:512;column:note;default:''"`                                // 备注
 	Created       int64  `json:"created" gorm:"column:created;not null"`                                     // 创建时间
-	Updated       int64  `json:"updated" gorm:"column:upddated;default:0"`                                   // 更新时间
+	Updated       int64  `json:"updated" gorm:"column:updated;default:0"`                                    // 更新时间
+
+	// 节点选择器, 使用 label-affinity 策略自动分配时只选择标签全部匹配的节点
+	SelectorMap map[string]string `json:"node_selector" gorm:"-"`
+	// HTTP 任务的请求定义, 为空时按 HttpMethod 和 Command 发送请求
+	Http *HttpSpec `json:"http" gorm:"-"`
+	// 容器任务的镜像、挂载等定义, Command 为容器内执行的命令
+	Container *ContainerSpec `json:"container" gorm:"-"`
+	// SQL 任务的数据源和语句定义
+	SQL *SQLSpec `json:"sql" gorm:"-"`
+	// gRPC 任务的调用定义, Command 为服务地址
+	GRPC *GRPCSpec `json:"grpc" gorm:"-"`
+	// 失败后的重试策略, 为空时按 RetryInterval 的旧规则重试
+	Retry *RetryPolicy `json:"retry" gorm:"-"`
+	// 执行前后运行的预设脚本
+	Hooks []JobHook `json:"hooks" gorm:"-"`
+	// 引用的日历及规则, 决定调度时刻在节假日、非工作日和维护窗口内时是否执行
+	Calendars []JobCalendar `json:"calendars" gorm:"-"`
+	// 插件任务的参数, 原样传给插件
+	Params json.RawMessage `json:"params" gorm:"-"`
+	// 脚本任务的解释器和严格模式, Command 为脚本内容
+	Interpreter string `json:"interpreter" gorm:"size:32;column:interpreter;default:''"`
+	Strict      bool   `json:"strict" gorm:"column:strict;not null;default:false"`
+	// 命令和脚本任务的执行环境, 为空时沿用节点进程的用户、工作目录和 umask
+	RunAsUser  string   `json:"run_as_user" gorm:"size:64;column:run_as_user;default:''"`   // 执行用户, 用户名或 uid
+	RunAsGroup string   `json:"run_as_group" gorm:"size:64;column:run_as_group;default:''"` // 执行用户组, 组名或 gid, 为空时使用用户的主组
+	WorkDir    string   `json:"work_dir" gorm:"size:256;column:work_dir;default:''"`        // 工作目录
+	Env        []byte   `json:"-" gorm:"type:text;column:env;default:null"`                 // 环境变量（字节数组）
+	EnvList    []string `json:"env" gorm:"-"`                                               // 环境变量, 格式为 KEY=VALUE
+	EnvMode    int      `json:"env_mode" gorm:"size:1;column:env_mode;not null;default:0"`  // 环境变量模式
+	Umask      string   `json:"umask" gorm:"size:4;column:umask;default:''"`                // 八进制的 umask, 例如 022
+	// 命令和脚本任务的资源限制, 为 0 时不限制
+	CpuQuota  int   `json:"cpu_quota" gorm:"column:cpu_quota;default:0"`   // CPU 配额, 单位为一个核的百分比, 例如 50 表示半个核
+	MemoryMax int64 `json:"memory_max" gorm:"column:memory_max;default:0"` // 内存上限, 单位 MB
+	PidsMax   int   `json:"pids_max" gorm:"column:pids_max;default:0"`     // 进程数上限
+	IoWeight  int   `json:"io_weight" gorm:"column:io_weight;default:0"`   // IO 权重, 取值 1-10000
 
 	Hostname string   `json:"host_name" gorm:"-"` // 主机名
 	Ip       string   `json:"ip" gorm:"-"`        // IP地址
@@ -69,6 +137,15 @@ func (j *Job) InitNodeInfo(status int, nodeUUID, hostname, ip string) {
 	j.Ip = ip
 }
 
+// 插入新任务
+func (j *Job) Insert() (insertId int, err error) {
+	err = dbclient.GetMysqlDB().Table(CronyJobTableName).Create(j).Error
+	if err == nil {
+		insertId = j.ID
+	}
+	return
+}
+
 // 更新任务
 func (j *Job) Update() error {
 	return dbclient.GetMysqlDB().Table(CronyJobTableName).Updates(j).Error
@@ -90,13 +167,46 @@ func (j *Job) Check() error {
 	if len(j.Name) == 0 {
 		return errors.ErrEmptyJobName
 	}
-	if j.RetryInterval == 0 {
-		j.RetryTimes = 1
-	}
 	if len(strings.TrimSpace(j.Command)) == 0 {
 		return errors.ErrEmptyJobCommand
 	}
-	if len(j.Cmd) == 0 && j.Type == JobTypeCmd {
+	if j.Concurrency < ConcurrencyAllow || j.Concurrency > ConcurrencyReplace {
+		return errors.ErrIllegalConcurrency
+	}
+	if j.RetryTimes < 0 {
+		return fmt.Errorf("%w: retry_times must not be negative", errors.ErrIllegalRetryPolicy)
+	}
+	if j.Retry != nil {
+		if err := j.Retry.Check(); err != nil {
+			return err
+		}
+	}
+	if err := j.checkSpec(); err != nil {
+		return err
+	}
+	if err := j.checkTimeZone(); err != nil {
+		return err
+	}
+	if err := j.checkMisfire(); err != nil {
+		return err
+	}
+	if err := j.checkJobType(); err != nil {
+		return err
+	}
+	if err := j.checkExecOptions(); err != nil {
+		return err
+	}
+	for i := range j.Hooks {
+		if err := j.Hooks[i].Check(); err != nil {
+			return err
+		}
+	}
+	for i := range j.Calendars {
+		if err := j.Calendars[i].Check(); err != nil {
+			return err
+		}
+	}
+	if len(j.Cmd) == 0 && (j.Type == JobTypeCmd || j.Type == JobTypeContainer) {
 		j.SplitCmd()
 	}
 	return nil
@@ -128,13 +238,166 @@ func (j *Job) TableName() string {
 	return CronyJobTableName
 }
 
-// 反序列化通知对象和脚本ID
-func (j *Job) Unmarshal() (err error) {
-	if err = json.Unmarshal(j.NotifyTo, &j.NotifyToArray); err != nil {
+// 序列化通知对象和脚本ID, 以便写入数据库
+func (j *Job) Marshal() (err error) {
+	if j.NotifyTo, err = json.Marshal(j.NotifyToArray); err != nil {
+		return
+	}
+	if j.ScriptID, err = json.Marshal(j.ScriptIDArray); err != nil {
 		return
 	}
-	if err = json.Unmarshal(j.ScriptID, &j.ScriptIDArray); err != nil {
+	if j.NodeSelector, err = json.Marshal(j.SelectorMap); err != nil {
 		return
 	}
+	if j.Env, err = json.Marshal(j.EnvList); err != nil {
+		return
+	}
+	j.HttpSpec = nil
+	if j.Http != nil {
+		if j.HttpSpec, err = json.Marshal(j.Http); err != nil {
+			return
+		}
+	}
+	j.ContainerSpec = nil
+	if j.Container != nil {
+		if j.ContainerSpec, err = json.Marshal(j.Container); err != nil {
+			return
+		}
+	}
+	j.SQLSpec = nil
+	if j.SQL != nil {
+		if j.SQLSpec, err = json.Marshal(j.SQL); err != nil {
+			return
+		}
+	}
+	j.GRPCSpec = nil
+	if j.GRPC != nil {
+		if j.GRPCSpec, err = json.Marshal(j.GRPC); err != nil {
+			return
+		}
+	}
+	j.RetrySpec = nil
+	if j.Retry != nil {
+		if j.RetrySpec, err = json.Marshal(j.Retry); err != nil {
+			return
+		}
+	}
+	j.HookSpec = nil
+	if len(j.Hooks) > 0 {
+		if j.HookSpec, err = json.Marshal(j.Hooks); err != nil {
+			return
+		}
+	}
+	j.CalendarSpec = nil
+	if len(j.Calendars) > 0 {
+		if j.CalendarSpec, err = json.Marshal(j.Calendars); err != nil {
+			return
+		}
+	}
+	j.PluginParams = nil
+	if len(j.Params) > 0 {
+		j.PluginParams = []byte(j.Params)
+	}
+	return
+}
+
+// 反序列化通知对象和脚本ID
+func (j *Job) Unmarshal() (err error) {
+	// 数据库中的字段可能为 null, 此时保持数组为空
+	if len(j.NotifyTo) > 0 {
+		if err = json.Unmarshal(j.NotifyTo, &j.NotifyToArray); err != nil {
+			return
+		}
+	}
+	if len(j.ScriptID) > 0 {
+		if err = json.Unmarshal(j.ScriptID, &j.ScriptIDArray); err != nil {
+			return
+		}
+	}
+	if len(j.NodeSelector) > 0 {
+		if err = json.Unmarshal(j.NodeSelector, &j.SelectorMap); err != nil {
+			return
+		}
+	}
+	if len(j.HttpSpec) > 0 {
+		if err = json.Unmarshal(j.HttpSpec, &j.Http); err != nil {
+			return
+		}
+	}
+	if len(j.ContainerSpec) > 0 {
+		if err = json.Unmarshal(j.ContainerSpec, &j.Container); err != nil {
+			return
+		}
+	}
+	if len(j.SQLSpec) > 0 {
+		if err = json.Unmarshal(j.SQLSpec, &j.SQL); err != nil {
+			return
+		}
+	}
+	if len(j.GRPCSpec) > 0 {
+		if err = json.Unmarshal(j.GRPCSpec, &j.GRPC); err != nil {
+			return
+		}
+	}
+	if len(j.RetrySpec) > 0 {
+		if err = json.Unmarshal(j.RetrySpec, &j.Retry); err != nil {
+			return
+		}
+	}
+	if len(j.HookSpec) > 0 {
+		if err = json.Unmarshal(j.HookSpec, &j.Hooks); err != nil {
+			return
+		}
+	}
+	if len(j.CalendarSpec) > 0 {
+		if err = json.Unmarshal(j.CalendarSpec, &j.Calendars); err != nil {
+			return
+		}
+	}
+	if len(j.PluginParams) > 0 {
+		j.Params = json.RawMessage(j.PluginParams)
+	}
+	if len(j.Env) > 0 {
+		if err = json.Unmarshal(j.Env, &j.EnvList); err != nil {
+			return
+		}
+	}
 	return
 }
+
+// checkExecOptions 校验执行环境相关的字段
+// 用户和用户组是否存在只能在节点上判断, 这里只校验格式
+func (j *Job) checkExecOptions() error {
+	if j.EnvMode != EnvInherit && j.EnvMode != EnvClean {
+		return errors.ErrIllegalEnv
+	}
+	for _, kv := range j.EnvList {
+		if i := strings.IndexByte(kv, '='); i <= 0 {
+			return fmt.Errorf("%w: %q", errors.ErrIllegalEnv, kv)
+		}
+	}
+	if _, err := j.ParseUmask(); err != nil {
+		return err
+	}
+	if j.CpuQuota < 0 || j.MemoryMax < 0 || j.PidsMax < 0 || j.IoWeight < 0 || j.IoWeight > 10000 {
+		return errors.ErrIllegalResourceLimit
+	}
+	return nil
+}
+
+// HasResourceLimits 判断任务是否设置了资源限制
+func (j *Job) HasResourceLimits() bool {
+	return j.CpuQuota > 0 || j.MemoryMax > 0 || j.PidsMax > 0 || j.IoWeight > 0
+}
+
+// ParseUmask 解析八进制的 umask, 未设置时返回 -1
+func (j *Job) ParseUmask() (int, error) {
+	if j.Umask == "" {
+		return -1, nil
+	}
+	umask, err := strconv.ParseUint(j.Umask, 8, 32)
+	if err != nil || umask > 0777 {
+		return 0, errors.ErrIllegalUmask
+	}
+	return int(umask), nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+)
+
+// 任务引用日历的规则
+const (
+	CalendarSkipHoliday     = "skip_holiday"      // 调度时刻在节假日时跳过
+	CalendarNextBusinessDay = "next_business_day" // 调度时刻不在工作日时跳过, 顺延到下一个工作日的同一时刻执行
+	CalendarSkipBlackout    = "skip_blackout"     // 调度时刻在维护窗口内时跳过
+)
+
+// JobCalendar 是任务引用的一个日历及其规则
+type JobCalendar struct {
+	CalendarID int    `json:"calendar_id"` // 日历ID
+	Rule       string `json:"rule"`        // 规则
+}
+
+// Check 校验任务引用日历的规则
+func (r *JobCalendar) Check() error {
+	if r.CalendarID <= 0 {
+		return fmt.Errorf("%w: calendar_id is required", errors.ErrIllegalJobCalendar)
+	}
+	switch r.Rule {
+	case CalendarSkipHoliday, CalendarNextBusinessDay, CalendarSkipBlackout:
+	default:
+		return fmt.Errorf("%w: unknown rule %q", errors.ErrIllegalJobCalendar, r.Rule)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// 容器任务的镜像拉取策略
+const (
+	ContainerPullMissing = "missing" // 本地不存在时拉取, 默认
+	ContainerPullAlways  = "always"  // 每次执行前都拉取
+	ContainerPullNever   = "never"   // 从不拉取
+)
+
+// ContainerSpec 是容器任务的定义, 容器内执行的命令为任务的 Command
+// 环境变量、工作目录、执行用户和资源限制沿用任务的 env、work_dir、run_as_user、run_as_group 以及 cpu_quota 等字段
+type ContainerSpec struct {
+	Image   string           `json:"image"`   // 镜像
+	Mounts  []ContainerMount `json:"mounts"`  // 挂载到容器内的宿主机目录
+	Pull    string           `json:"pull"`    // 镜像拉取策略, 默认 missing
+	Network string           `json:"network"` // 网络模式, 为空时使用运行时的默认网络
+}
+
+// ContainerMount 是一个挂载点
+type ContainerMount struct {
+	Source   string `json:"source"`    // 宿主机路径
+	Target   string `json:"target"`    // 容器内路径
+	ReadOnly bool   `json:"read_only"` // 是否只读
+}
+
+// Check 校验容器定义, 并补全默认值
+func (s *ContainerSpec) Check() error {
+	s.Image = strings.TrimSpace(s.Image)
+	if s.Image == "" {
+		return fmt.Errorf("%w: image is empty", errors.ErrIllegalContainerSpec)
+	}
+	switch s.Pull {
+	case "":
+		s.Pull = ContainerPullMissing
+	case ContainerPullMissing, ContainerPullAlways, ContainerPullNever:
+	default:
+		return fmt.Errorf("%w: unsupported pull policy %s", errors.ErrIllegalContainerSpec, s.Pull)
+	}
+	for _, m := range s.Mounts {
+		if !path.IsAbs(m.Source) || !path.IsAbs(m.Target) {
+			return fmt.Errorf("%w: mount %s:%s must use absolute paths", errors.ErrIllegalContainerSpec, m.Source, m.Target)
+		}
+		// 运行时的命令行参数以 ':' 和 ',' 分隔挂载选项
+		if strings.ContainsAny(m.Source+m.Target, ":,") {
+			return fmt.Errorf("%w: mount %s:%s contains ':' or ','", errors.ErrIllegalContainerSpec, m.Source, m.Target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// GRPCSpec 是 gRPC 任务的调用定义, 服务地址为任务的 Command, 例如 127.0.0.1:9000
+type GRPCSpec struct {
+	Method        string            `json:"method"`         // 完整方法名, 例如 pkg.Service/Method
+	Body          string            `json:"body"`           // JSON 格式的请求, 为空时发送空消息
+	Metadata      map[string]string `json:"metadata"`       // 请求的 metadata
+	DescriptorSet string            `json:"descriptor_set"` // base64 编码的 FileDescriptorSet, 为空时通过服务端反射获取方法定义
+	TLS           bool              `json:"tls"`            // 是否使用 TLS 连接
+	SuccessCodes  []string          `json:"success_codes"`  // 视为成功的状态码名称, 默认只有 OK
+}
+
+// Check 校验 gRPC 调用定义, 并补全默认值
+func (s *GRPCSpec) Check() error {
+	if _, _, err := s.ParseMethod(); err != nil {
+		return err
+	}
+	if s.Body != "" && !json.Valid([]byte(s.Body)) {
+		return fmt.Errorf("%w: body is not valid json", errors.ErrIllegalGRPCSpec)
+	}
+	if s.DescriptorSet != "" {
+		if _, err := base64.StdEncoding.DecodeString(s.DescriptorSet); err != nil {
+			return fmt.Errorf("%w: descriptor_set is not valid base64", errors.ErrIllegalGRPCSpec)
+		}
+	}
+	if len(s.SuccessCodes) == 0 {
+		s.SuccessCodes = []string{codes.OK.String()}
+	}
+	for _, name := range s.SuccessCodes {
+		if _, err := ParseGRPCCode(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseMethod 将方法名解析为服务名和方法名, 支持 pkg.Service/Method、/pkg.Service/Method 和 pkg.Service.Method
+func (s *GRPCSpec) ParseMethod() (service, method string, err error) {
+	name := strings.TrimPrefix(strings.TrimSpace(s.Method), "/")
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		i = strings.LastIndex(name, ".")
+	}
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("%w: invalid method %q", errors.ErrIllegalGRPCSpec, s.Method)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+// IsSuccess 判断状态码是否视为成功
+func (s *GRPCSpec) IsSuccess(code codes.Code) bool {
+	if len(s.SuccessCodes) == 0 {
+		return code == codes.OK
+	}
+	for _, name := range s.SuccessCodes {
+		if c, err := ParseGRPCCode(name); err == nil && c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGRPCCode 解析状态码名称, 例如 OK、NOT_FOUND
+func ParseGRPCCode(name string) (codes.Code, error) {
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(strings.TrimSpace(name)) + `"`)); err != nil {
+		return 0, fmt.Errorf("%w: unknown status code %s", errors.ErrIllegalGRPCSpec, name)
+	}
+	return code, nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+)
+
+// 钩子的执行阶段
+const (
+	HookPhaseEnv         = "env"          // 执行前准备环境变量, 标准输出中 KEY=VALUE 格式的行追加到任务的环境变量
+	HookPhasePre         = "pre"          // 执行前运行, 失败时不再执行任务
+	HookPhasePost        = "post"         // 执行后总是运行
+	HookPhasePostSuccess = "post_success" // 执行成功后运行
+	HookPhasePostFailure = "post_failure" // 执行失败后运行
+)
+
+// JobHook 是任务引用的一个预设脚本及其执行阶段
+type JobHook struct {
+	ScriptID int    `json:"script_id"` // 预设脚本ID
+	Phase    string `json:"phase"`     // 执行阶段
+	Timeout  int64  `json:"timeout"`   // 超时时间, 单位秒, 为 0 时使用任务的超时时间
+}
+
+// Check 校验钩子的定义
+func (h *JobHook) Check() error {
+	if h.ScriptID <= 0 {
+		return fmt.Errorf("%w: script_id is required", errors.ErrIllegalJobHook)
+	}
+	switch h.Phase {
+	case HookPhaseEnv, HookPhasePre, HookPhasePost, HookPhasePostSuccess, HookPhasePostFailure:
+	default:
+		return fmt.Errorf("%w: unknown phase %q", errors.ErrIllegalJobHook, h.Phase)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("%w: timeout must not be negative", errors.ErrIllegalJobHook)
+	}
+	return nil
+}
+
+// GetHooks 返回任务的全部钩子
+// 只设置了 script_id 的旧任务, 其中的脚本作为 pre 钩子依次执行
+func (j *Job) GetHooks() []JobHook {
+	hooks := make([]JobHook, 0, len(j.ScriptIDArray)+len(j.Hooks))
+	for _, id := range j.ScriptIDArray {
+		hooks = append(hooks, JobHook{ScriptID: id, Phase: HookPhasePre})
+	}
+	return append(hooks, j.Hooks...)
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"crony/common/pkg/utils"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// HTTP 任务的认证方式
+const (
+	HttpAuthBasic  = "basic"  // Basic 认证
+	HttpAuthBearer = "bearer" // Bearer Token 认证
+)
+
+// DefaultHttpMaxRedirects 是跟随重定向的默认最大次数
+const DefaultHttpMaxRedirects = 10
+
+// HttpSpec 是 HTTP 任务的请求定义, 请求地址为任务的 Command
+// 未设置时沿用旧的行为: HttpMethod 为 GET 时直接请求 Command, 否则将 '?' 之后的部分作为 JSON body 发送 POST 请求
+type HttpSpec struct {
+	Method       string            `json:"method"`        // 请求方法, 默认 GET
+	Query        map[string]string `json:"query"`         // 追加到 URL 上的查询参数
+	Headers      map[string]string `json:"headers"`       // 请求头
+	Body         string            `json:"body"`          // 请求体模板, 使用 text/template 语法
+	Auth         *HttpAuth         `json:"auth"`          // 认证信息
+	NoRedirect   bool              `json:"no_redirect"`   // 为 true 时不跟随重定向, 直接以 3xx 响应作为结果
+	MaxRedirects int               `json:"max_redirects"` // 跟随重定向的最大次数, 默认 DefaultHttpMaxRedirects
+	Assert       *HttpAssert       `json:"assert"`        // 判定执行成功的断言
+}
+
+// HttpAuth 是 HTTP 任务的认证信息
+type HttpAuth struct {
+	Type     string `json:"type"`     // basic 或 bearer
+	Username string `json:"username"` // basic 认证的用户名
+	Password string `json:"password"` // basic 认证的密码
+	Token    string `json:"token"`    // bearer 认证的 token
+}
+
+// HttpAssert 是判定 HTTP 任务执行成功的条件, 所有设置了的条件都满足才算成功
+type HttpAssert struct {
+	StatusMin int    `json:"status_min"` // 状态码下限, 默认 200
+	StatusMax int    `json:"status_max"` // 状态码上限, 默认 299
+	BodyRegex string `json:"body_regex"` // 响应体需要匹配的正则表达式
+	JSONPath  string `json:"json_path"`  // 响应体为 JSON 时需要存在的路径, 例如 $.data.status
+	JSONValue string `json:"json_value"` // JSONPath 对应的值需要等于该字符串, 为空时只要求路径存在且不为 null
+}
+
+// HttpTemplateData 是渲染请求体模板时可以使用的数据
+type HttpTemplateData struct {
+	JobID    int    // 任务ID
+	JobName  string // 任务名称
+	NodeUUID string // 执行节点
+	Hostname string // 执行节点的主机名
+	IP       string // 执行节点的IP
+	Unix     int64  // 执行时的 unix 时间戳(秒)
+}
+
+// Clone 返回请求定义的副本, 在副本上调用 Check 补全默认值不会修改原来的定义
+func (s *HttpSpec) Clone() *HttpSpec {
+	c := *s
+	if s.Auth != nil {
+		auth := *s.Auth
+		c.Auth = &auth
+	}
+	if s.Assert != nil {
+		assert := *s.Assert
+		c.Assert = &assert
+	}
+	return &c
+}
+
+// Check 校验 HTTP 请求定义, 并补全默认值
+func (s *HttpSpec) Check() error {
+	s.Method = strings.ToUpper(strings.TrimSpace(s.Method))
+	if s.Method == "" {
+		s.Method = http.MethodGet
+	}
+	switch s.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+	default:
+		return fmt.Errorf("%w: unsupported method %s", errors.ErrIllegalHttpSpec, s.Method)
+	}
+	if _, err := template.New("body").Parse(s.Body); err != nil {
+		return fmt.Errorf("%w: %s", errors.ErrIllegalHttpSpec, err.Error())
+	}
+	if s.Auth != nil {
+		s.Auth.Type = strings.ToLower(strings.TrimSpace(s.Auth.Type))
+		if s.Auth.Type != HttpAuthBasic && s.Auth.Type != HttpAuthBearer {
+			return fmt.Errorf("%w: unsupported auth type %s", errors.ErrIllegalHttpSpec, s.Auth.Type)
+		}
+	}
+	if s.MaxRedirects < 0 {
+		return fmt.Errorf("%w: max_redirects must not be negative", errors.ErrIllegalHttpSpec)
+	}
+	if s.MaxRedirects == 0 {
+		s.MaxRedirects = DefaultHttpMaxRedirects
+	}
+	if s.Assert == nil {
+		s.Assert = new(HttpAssert)
+	}
+	return s.Assert.Check()
+}
+
+// Check 校验断言, 并补全状态码范围的默认值
+func (a *HttpAssert) Check() error {
+	if a.StatusMin == 0 {
+		a.StatusMin = http.StatusOK
+	}
+	if a.StatusMax == 0 {
+		a.StatusMax = http.StatusMultipleChoices - 1
+	}
+	if a.StatusMin < 100 || a.StatusMax > 599 || a.StatusMin > a.StatusMax {
+		return fmt.Errorf("%w: invalid status range [%d, %d]", errors.ErrIllegalHttpSpec, a.StatusMin, a.StatusMax)
+	}
+	if a.BodyRegex != "" {
+		if _, err := regexp.Compile(a.BodyRegex); err != nil {
+			return fmt.Errorf("%w: %s", errors.ErrIllegalHttpSpec, err.Error())
+		}
+	}
+	if a.JSONPath != "" {
+		if _, err := utils.ParseJSONPath(a.JSONPath); err != nil {
+			return fmt.Errorf("%w: %s", errors.ErrIllegalHttpSpec, err.Error())
+		}
+	} else if a.JSONValue != "" {
+		return fmt.Errorf("%w: json_value requires json_path", errors.ErrIllegalHttpSpec)
+	}
+	return nil
+}
@@ -5,6 +5,18 @@ import (
 	"fmt"
 )
 
+// 作业日志状态
+const (
+	JobLogStatusRunning = 0 // 执行中
+	JobLogStatusSuccess = 1 // 执行成功
+	JobLogStatusFail    = 2 // 执行失败
+	JobLogStatusSkipped = 3 // 未执行, 被跳过
+	JobLogStatusKilled  = 4 // 被强制终止
+)
+
+// JobLogOutputSize 是 job_log.output 列的长度, 更长的输出在写入前截断
+const JobLogOutputSize = 512
+
 // JobLog 结构体表示作业日志表
 type JobLog struct {
 	ID       int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                             // 主键，自增
@@ -15,11 +27,19 @@ type JobLog struct {
 	Hostname string `json:"hostname" gorm:"size:32;column:hostname"`                                    // 节点主机名
 	NodeUUID string `json:"node_uuid" gorm:"size:128;column:node_uuid;not null;index:idx_job_log_node"` // 节点唯一标识
 	Success  bool   `json:"success" gorm:"size:1;column:success;not null"`                              // 是否成功
+	Status   int    `json:"status" gorm:"size:1;column:status;not null;default:0"`                      // 执行状态
 
-	Output string `json:"output" gorm:"size:512;column:output;"`     // 执行输出
-	Spec   string `json:"spec" gorm:"size:64;column:spec;not null" ` // 定时表达式
+	Output        string `json:"output" gorm:"size:512;column:output;"`                                                  // 执行输出
+	HookOutput    string `json:"hook_output" gorm:"type:text;column:hook_output"`                                        // 钩子脚本的输出
+	Spec          string `json:"spec" gorm:"size:64;column:spec;not null" `                                              // 定时表达式
+	TimeZone      string `json:"time_zone" gorm:"size:64;column:time_zone"`                                              // 定时表达式使用的时区
+	FireTime      int64  `json:"fire_time" gorm:"column:fire_time;default:0"`                                            // 调度时刻, 立即执行时为 0
+	WorkflowRunID int    `json:"workflow_run_id" gorm:"column:workflow_run_id;default:0;index:idx_job_log_workflow_run"` // 所属的工作流运行ID, 不是由工作流触发时为 0
+	CatchUp       bool   `json:"catch_up" gorm:"column:catch_up;not null;default:false"`                                 // 是否为节点恢复后对错过调度的补执行
 
 	RetryTimes int   `json:"retry_times" gorm:"size:4;column:retry_times;default:0"` // 重试次数
+	PeakMemory int64 `json:"peak_memory" gorm:"column:peak_memory;default:0"`        // 峰值内存, 单位字节
+	CpuTime    int64 `json:"cpu_time" gorm:"column:cpu_time;default:0"`              // CPU 时间(用户态 + 内核态), 单位毫秒
 	StartTime  int64 `json:"start_time" gorm:"column:start_time;not null;"`          // 开始时间
 	EndTime    int64 `json:"end_time" gorm:"column:end_time;default:0;"`             // 结束时间
 }
@@ -43,7 +63,39 @@ func (jb *JobLog) Insert() (insertId int, err error) {
 	return
 }
 
+// FindLastSuccess 查找任务最近一次执行成功的作业日志
+func (jb *JobLog) FindLastSuccess() error {
+	return dbclient.GetMysqlDB().Table(CronyJobLogTableName).
+		Where("job_id = ? and status = ?", jb.JobId, JobLogStatusSuccess).
+		Order("start_time desc").First(jb).Error
+}
+
 // TableName 返回作业日志表名
 func (jb *JobLog) TableName() string {
 	return CronyJobLogTableName
 }
+
+// JobLogAttempt 是一次执行中的一次尝试, 重试时每次尝试各记录一条
+type JobLogAttempt struct {
+	ID         int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                     // 主键，自增
+	JobLogId   int    `json:"job_log_id" gorm:"column:job_log_id;index:idx_attempt_log;not null"` // 所属的作业日志ID
+	JobId      int    `json:"job_id" gorm:"column:job_id;not null"`                               // 作业ID
+	Attempt    int    `json:"attempt" gorm:"column:attempt;not null"`                             // 第几次尝试, 从 0 开始
+	Status     int    `json:"status" gorm:"size:1;column:status;not null"`                        // 执行状态
+	Output     string `json:"output" gorm:"type:text;column:output"`                              // 执行输出
+	Error      string `json:"error" gorm:"size:512;column:error"`                                 // 失败原因
+	HookOutput string `json:"hook_output" gorm:"type:text;column:hook_output"`                    // 钩子脚本的输出
+	StartTime  int64  `json:"start_time" gorm:"column:start_time;not null"`                       // 开始时间
+	Duration   int64  `json:"duration" gorm:"column:duration;not null"`                           // 执行时长, 单位毫秒
+	NextDelay  int64  `json:"next_delay" gorm:"column:next_delay;default:0"`                      // 下一次重试前的等待时间, 单位毫秒, 不再重试时为 0
+}
+
+// Insert 插入一条尝试记录
+func (a *JobLogAttempt) Insert() error {
+	return dbclient.GetMysqlDB().Table(CronyAttemptTableName).Create(a).Error
+}
+
+// TableName 返回尝试记录表名
+func (a *JobLogAttempt) TableName() string {
+	return CronyAttemptTableName
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+)
+
+// 错过调度(misfire)的处理方式
+// 节点宕机或重启期间到达的调度时刻不会被调度器触发, 节点重新加载任务时按任务的策略补执行
+const (
+	MisfireIgnore  = "ignore"   // 不补执行, 只记录一条跳过日志, 默认值
+	MisfireRunOnce = "run_once" // 只补执行一次, 对应最近一个错过的调度时刻
+	MisfireRunAll  = "run_all"  // 按时间顺序补执行每个错过的调度时刻, 最多 misfire_cap 次
+)
+
+const (
+	DefaultMisfireCap = 24  // run_all 未设置 misfire_cap 时最多补执行的次数
+	MaxMisfireCap     = 500 // misfire_cap 的上限
+)
+
+// checkMisfire 校验任务错过调度时的处理方式
+func (j *Job) checkMisfire() error {
+	switch j.Misfire {
+	case "", MisfireIgnore, MisfireRunOnce, MisfireRunAll:
+	default:
+		return fmt.Errorf("%w: unknown misfire %q", errors.ErrIllegalMisfire, j.Misfire)
+	}
+	if j.MisfireCap < 0 || j.MisfireCap > MaxMisfireCap {
+		return fmt.Errorf("%w: misfire_cap must be in [0, %d]", errors.ErrIllegalMisfire, MaxMisfireCap)
+	}
+	return nil
+}
+
+// MisfireLimit 返回最多补执行的次数
+func (j *Job) MisfireLimit() int {
+	switch j.Misfire {
+	case MisfireRunOnce:
+		return 1
+	case MisfireRunAll:
+		if j.MisfireCap > 0 {
+			return j.MisfireCap
+		}
+		return DefaultMisfireCap
+	}
+	return 0
+}
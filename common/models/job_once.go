@@ -0,0 +1,40 @@
+package models
+
+import "strings"
+
+// OnceTargetAny 表示一次性执行由任意一个在线节点完成
+const OnceTargetAny = "any"
+
+// OnceTtl 是一次性执行的触发和结果在 etcd 中的保留时长(秒)
+// 目标节点不在线时触发 key 不会被 FinishOnce 删除, 到期后由 etcd 清理
+const OnceTtl = 600
+
+// ParseOnceTargets 解析 /crony/once/<job_id> 的值
+// 值为 "any" 或以逗号分隔的节点 UUID, 返回去掉空白后的目标列表
+func ParseOnceTargets(val string) []string {
+	targets := make([]string, 0)
+	for _, s := range strings.Split(val, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			targets = append(targets, s)
+		}
+	}
+	return targets
+}
+
+// IsOnceTargetAny 判断目标列表是否为 "any"
+func IsOnceTargetAny(targets []string) bool {
+	return len(targets) == 1 && targets[0] == OnceTargetAny
+}
+
+// JobOnceResult 是一次性执行的结果, 写入 /crony/once-result/<job_id>/<node_uuid>
+type JobOnceResult struct {
+	JobID      int    `json:"job_id"`      // 任务ID
+	NodeUUID   string `json:"node_uuid"`   // 执行节点
+	TriggerRev int64  `json:"trigger_rev"` // 触发 key 的 ModRevision, 用于区分同一任务的多次触发
+	JobLogID   int    `json:"job_log_id"`  // 对应的任务日志ID
+	Success    bool   `json:"success"`     // 是否成功
+	Output     string `json:"output"`      // 执行输出
+	Error      string `json:"error"`       // 错误信息
+	StartTime  int64  `json:"start_time"`  // 开始时间
+	EndTime    int64  `json:"end_time"`    // 结束时间
+}
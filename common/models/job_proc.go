@@ -2,6 +2,9 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,8 +22,8 @@ type JobProc struct {
 	NodeUUID   string `json:"node_uuid"` // 节点唯一标识
 	JobProcVal        // 作业进程状态
 
-	Running int32          // 运行状态标识
-	Wg      sync.WaitGroup // 用于同步的等待组
+	Running int32          `json:"-"` // 运行状态标识
+	Wg      sync.WaitGroup `json:"-"` // 用于同步的等待组
 }
 
 // Val 返回 JobProcVal 的 JSON 字符串表示
@@ -31,3 +34,54 @@ func (p *JobProc) Val() (string, error) {
 	}
 	return string(b), nil
 }
+
+// ProcKeyPrefix 是进程记录在 etcd 中的前缀, 完整的 key 为 /crony/proc/<node_uuid>/<job_id>/<pid>
+// 与 etcdclient.KeyEtcdProcProfile 相同, 节点和 admin 都通过这里生成和解析进程记录的 key
+const ProcKeyPrefix = "/crony/proc/"
+
+// ProcKey 返回进程记录在 etcd 中的 key
+func ProcKey(nodeUUID string, jobId, pid int) string {
+	return fmt.Sprintf("%s%s/%d/%d", ProcKeyPrefix, nodeUUID, jobId, pid)
+}
+
+// Key 返回进程记录在 etcd 中的 key
+func (p *JobProc) Key() string {
+	return ProcKey(p.NodeUUID, p.JobID, p.ID)
+}
+
+// ParseProcKey 从进程记录的 key 中解析出节点、任务ID和进程ID
+func ParseProcKey(key string) (*JobProc, error) {
+	// key 的最后三段依次为 node_uuid、job_id、pid
+	ss := strings.Split(key, "/")
+	if len(ss) < 5 {
+		return nil, fmt.Errorf("invalid proc key [%s]", key)
+	}
+	pid, err := strconv.Atoi(ss[len(ss)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proc key [%s]: %w", key, err)
+	}
+	jobId, err := strconv.Atoi(ss[len(ss)-2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proc key [%s]: %w", key, err)
+	}
+	return &JobProc{ID: pid, JobID: jobId, NodeUUID: ss[len(ss)-3]}, nil
+}
+
+// ParseProc 从进程记录的 key 和值中解析出进程记录
+func ParseProc(key string, val []byte) (*JobProc, error) {
+	p, err := ParseProcKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(val, &p.JobProcVal); err != nil {
+		return p, fmt.Errorf("proc[%s] unmarshal err: %w", key, err)
+	}
+	return p, nil
+}
+
+// MarkKilled 将进程记录标记为需要终止, 返回需要写回 etcd 的值
+// 写回时应保留记录原有的租约, 进程所在节点崩溃时记录仍会按时过期
+func (p *JobProc) MarkKilled() (string, error) {
+	p.Killed = true
+	return p.Val()
+}
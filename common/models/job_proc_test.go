@@ -0,0 +1,27 @@
+package models_test
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"fmt"
+	"testing"
+)
+
+func TestProcKey(t *testing.T) {
+	key := models.ProcKey("node-1", 12, -3)
+	if expect := fmt.Sprintf(etcdclient.KeyEtcdProc, "node-1", 12, -3); key != expect {
+		t.Fatalf("proc key %s, expect %s", key, expect)
+	}
+	p, err := models.ParseProc(key, []byte(`{"Kiddled":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NodeUUID != "node-1" || p.JobID != 12 || p.ID != -3 || !p.Killed {
+		t.Fatalf("parse proc %+v", p)
+	}
+	for _, invalid := range []string{"/crony/proc/1", "/crony/proc/node/x/1", "/crony/proc/node/1/x"} {
+		if _, err = models.ParseProcKey(invalid); err == nil {
+			t.Fatalf("expect error for %s", invalid)
+		}
+	}
+}
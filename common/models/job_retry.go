@@ -0,0 +1,187 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 重试的退避方式
+const (
+	BackoffFixed       = "fixed"       // 每次等待 delay
+	BackoffLinear      = "linear"      // 第 n 次重试前等待 n*delay
+	BackoffExponential = "exponential" // 第 n 次重试前等待 delay*multiplier^(n-1)
+)
+
+// 超时失败是否重试
+const (
+	RetryTimeoutAny   = "any"   // 超时和其他失败都重试, 默认值
+	RetryTimeoutOnly  = "only"  // 只重试超时
+	RetryTimeoutNever = "never" // 不重试超时
+)
+
+// DefaultBackoffMultiplier 是 exponential 未设置倍数时使用的倍数
+const DefaultBackoffMultiplier = 2
+
+// RetryPolicy 是任务失败后的重试策略, 最多重试 Job.RetryTimes 次
+type RetryPolicy struct {
+	Backoff    string   `json:"backoff"`     // 退避方式, 默认 fixed
+	Delay      int64    `json:"delay"`       // 第一次重试前的等待时间, 单位秒
+	Multiplier float64  `json:"multiplier"`  // exponential 的倍数, 默认 2
+	MaxDelay   int64    `json:"max_delay"`   // 单次等待时间的上限, 单位秒, 0 表示不限制
+	Jitter     float64  `json:"jitter"`      // 抖动比例, 取值 0-1, 实际等待时间在 delay*(1±jitter) 之间随机
+	MaxElapsed int64    `json:"max_elapsed"` // 从第一次执行开始的总时长上限, 单位秒, 下一次重试会超过时不再重试, 0 表示不限制
+	RetryOn    *RetryOn `json:"retry_on"`    // 可重试的失败, 为空时所有失败都重试
+}
+
+// RetryOn 描述哪些失败可以重试, 每个条件只约束对应类别的失败
+type RetryOn struct {
+	ExitCodes  []int    `json:"exit_codes"`  // 命令、脚本、容器和插件以这些退出码失败时重试, 为空时不限制
+	HttpStatus []string `json:"http_status"` // HTTP 任务的响应状态码为这些值时重试, 支持 503 和 5xx 两种写法, 为空时不限制
+	Timeout    string   `json:"timeout"`     // 超时失败是否重试, 取值 any、only、never
+}
+
+// Failure 是一次失败执行的类别
+type Failure struct {
+	ExitCode   int  // 进程或容器的退出码, -1 表示没有退出码
+	HttpStatus int  // HTTP 响应的状态码, 0 表示没有状态码
+	Timeout    bool // 是否因超时失败
+}
+
+// Check 校验重试策略
+func (p *RetryPolicy) Check() error {
+	switch p.Backoff {
+	case "", BackoffFixed, BackoffLinear, BackoffExponential:
+	default:
+		return fmt.Errorf("%w: unknown backoff %q", errors.ErrIllegalRetryPolicy, p.Backoff)
+	}
+	if p.Delay < 0 || p.MaxDelay < 0 || p.MaxElapsed < 0 {
+		return fmt.Errorf("%w: delay, max_delay and max_elapsed must not be negative", errors.ErrIllegalRetryPolicy)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("%w: multiplier must not be less than 1", errors.ErrIllegalRetryPolicy)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("%w: jitter must be in [0, 1]", errors.ErrIllegalRetryPolicy)
+	}
+	if p.RetryOn == nil {
+		return nil
+	}
+	for _, s := range p.RetryOn.HttpStatus {
+		if _, _, err := parseStatusPattern(s); err != nil {
+			return err
+		}
+	}
+	switch p.RetryOn.Timeout {
+	case "", RetryTimeoutAny, RetryTimeoutOnly, RetryTimeoutNever:
+	default:
+		return fmt.Errorf("%w: unknown timeout option %q", errors.ErrIllegalRetryPolicy, p.RetryOn.Timeout)
+	}
+	return nil
+}
+
+// NextDelay 返回第 n 次(从 1 开始)重试前的等待时间, random 为 [0, 1) 的随机数, 用于计算抖动
+func (p *RetryPolicy) NextDelay(n int, random float64) time.Duration {
+	delay := float64(p.Delay)
+	switch p.Backoff {
+	case BackoffLinear:
+		delay *= float64(n)
+	case BackoffExponential:
+		multiplier := p.Multiplier
+		if multiplier == 0 {
+			multiplier = DefaultBackoffMultiplier
+		}
+		delay *= math.Pow(multiplier, float64(n-1))
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*random-1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
+// Retryable 判断一次失败是否可以重试
+func (p *RetryPolicy) Retryable(f Failure) bool {
+	on := p.RetryOn
+	if on == nil {
+		return true
+	}
+	switch on.Timeout {
+	case RetryTimeoutOnly:
+		if !f.Timeout {
+			return false
+		}
+	case RetryTimeoutNever:
+		if f.Timeout {
+			return false
+		}
+	}
+	if len(on.ExitCodes) > 0 && f.ExitCode >= 0 {
+		matched := false
+		for _, code := range on.ExitCodes {
+			if code == f.ExitCode {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(on.HttpStatus) > 0 && f.HttpStatus > 0 {
+		matched := false
+		for _, s := range on.HttpStatus {
+			if min, max, err := parseStatusPattern(s); err == nil && f.HttpStatus >= min && f.HttpStatus <= max {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStatusPattern 解析 503 或 5xx 形式的状态码, 返回状态码的范围
+func parseStatusPattern(s string) (min, max int, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		class := int(s[0]-'0') * 100
+		return class, class + 99, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("%w: invalid http status %q", errors.ErrIllegalRetryPolicy, s)
+	}
+	return code, code, nil
+}
+
+// GetRetryPolicy 返回任务的重试策略
+// 没有设置 retry 的任务沿用旧的行为: RetryInterval 大于 0 时每次等待 RetryInterval 秒,
+// 小于 0 时立即重试, 等于 0 时第 n 次重试前等待 n 分钟
+func (j *Job) GetRetryPolicy() *RetryPolicy {
+	if j.Retry != nil {
+		p := *j.Retry
+		if p.Backoff == "" {
+			p.Backoff = BackoffFixed
+		}
+		return &p
+	}
+	switch {
+	case j.RetryInterval > 0:
+		return &RetryPolicy{Backoff: BackoffFixed, Delay: j.RetryInterval}
+	case j.RetryInterval < 0:
+		return &RetryPolicy{Backoff: BackoffFixed}
+	default:
+		return &RetryPolicy{Backoff: BackoffLinear, Delay: 60}
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import "crony/common/pkg/utils/errors"
+
+// 脚本任务支持的解释器
+const (
+	ShellSh      = "sh"      // /bin/sh, 默认
+	ShellBash    = "bash"    // bash
+	ShellPython3 = "python3" // python3
+)
+
+// ShellInterpreter 描述一个脚本解释器
+type ShellInterpreter struct {
+	Path        string   // 解释器的可执行文件
+	StrictFlags []string // 开启严格模式时追加的参数
+	Ext         string   // 临时脚本文件的后缀
+}
+
+// shellInterpreters 是名称到解释器的映射
+var shellInterpreters = map[string]*ShellInterpreter{
+	ShellSh:   {Path: "/bin/sh", StrictFlags: []string{"-e", "-u"}, Ext: ".sh"},
+	"/bin/sh": {Path: "/bin/sh", StrictFlags: []string{"-e", "-u"}, Ext: ".sh"},
+	ShellBash: {Path: "bash", StrictFlags: []string{"-e", "-u", "-o", "pipefail"}, Ext: ".sh"},
+	// python 遇到未捕获的异常本身就会退出, 严格模式下把警告也当作错误
+	ShellPython3: {Path: "python3", StrictFlags: []string{"-W", "error"}, Ext: ".py"},
+}
+
+// GetShellInterpreter 根据名称返回解释器, 名称为空时使用 /bin/sh
+func GetShellInterpreter(name string) (*ShellInterpreter, error) {
+	if name == "" {
+		name = ShellSh
+	}
+	interpreter, ok := shellInterpreters[name]
+	if !ok {
+		return nil, errors.ErrUnknownInterpreter
+	}
+	return interpreter, nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultSQLMaxRows 是 SQL 任务输出结果集的默认最大行数
+const DefaultSQLMaxRows = 100
+
+// SQLSpec 是 SQL 任务的定义
+type SQLSpec struct {
+	Datasource       string   `json:"datasource"`        // 节点配置中 datasources 下的数据源名称
+	Statements       []string `json:"statements"`        // 依次执行的语句, 为空时执行任务的 Command
+	Transaction      bool     `json:"transaction"`       // 是否在同一个事务中执行全部语句, 任一语句失败时回滚
+	StatementTimeout int64    `json:"statement_timeout"` // 每条语句的超时时间, 单位秒, 为 0 时只受任务的超时时间限制
+	MaxRows          int      `json:"max_rows"`          // 每个结果集最多输出的行数, 默认 DefaultSQLMaxRows
+}
+
+// Check 校验 SQL 任务定义, 并补全默认值
+func (s *SQLSpec) Check() error {
+	s.Datasource = strings.TrimSpace(s.Datasource)
+	if s.Datasource == "" {
+		return fmt.Errorf("%w: datasource is empty", errors.ErrIllegalSQLSpec)
+	}
+	for i, stmt := range s.Statements {
+		if strings.TrimSpace(stmt) == "" {
+			return fmt.Errorf("%w: statement %d is empty", errors.ErrIllegalSQLSpec, i+1)
+		}
+	}
+	if s.StatementTimeout < 0 || s.MaxRows < 0 {
+		return fmt.Errorf("%w: statement_timeout and max_rows must not be negative", errors.ErrIllegalSQLSpec)
+	}
+	if s.MaxRows == 0 {
+		s.MaxRows = DefaultSQLMaxRows
+	}
+	return nil
+}
+
+// GetStatements 返回需要执行的语句
+func (s *SQLSpec) GetStatements(command string) []string {
+	if len(s.Statements) > 0 {
+		return s.Statements
+	}
+	return []string{command}
+}
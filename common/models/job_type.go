@@ -0,0 +1,135 @@
+package models
+
+import (
+	"crony/common/pkg/plugin"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// JobTypeValidator 在 Job.Check 时校验某种任务类型特有的配置
+type JobTypeValidator func(j *Job) error
+
+// JobTypeInfo 是一种已注册的任务类型
+type JobTypeInfo struct {
+	Type     JobType          `json:"type"`
+	Name     string           `json:"name"`
+	Validate JobTypeValidator `json:"-"` // 可以为 nil, 表示没有类型特有的配置
+}
+
+var (
+	jobTypesMu sync.RWMutex
+	jobTypes   = make(map[JobType]*JobTypeInfo)
+)
+
+// 内置的任务类型
+func init() {
+	RegisterJobType(JobTypeCmd, "cmd", nil)
+	RegisterJobType(JobTypeHttp, "http", validateHttpJob)
+	RegisterJobType(JobTypeShell, "shell", validateShellJob)
+	RegisterJobType(JobTypeContainer, "container", validateContainerJob)
+	RegisterJobType(JobTypeSQL, "sql", validateSQLJob)
+	RegisterJobType(JobTypeGRPC, "grpc", validateGRPCJob)
+}
+
+// RegisterJobType 注册一种任务类型及其校验函数, 重复注册时后注册的覆盖先注册的
+// 未注册的任务类型无法通过 Job.Check, 因此 admin 和节点都需要注册同样的类型
+func RegisterJobType(t JobType, name string, validate JobTypeValidator) {
+	if t <= 0 {
+		panic(fmt.Sprintf("register job type %q: type must be positive", name))
+	}
+	jobTypesMu.Lock()
+	defer jobTypesMu.Unlock()
+	jobTypes[t] = &JobTypeInfo{Type: t, Name: name, Validate: validate}
+}
+
+// GetJobType 返回已注册的任务类型
+func GetJobType(t JobType) (*JobTypeInfo, bool) {
+	jobTypesMu.RLock()
+	defer jobTypesMu.RUnlock()
+	info, ok := jobTypes[t]
+	return info, ok
+}
+
+// GetJobTypes 返回全部已注册的任务类型, 按类型编号排序
+func GetJobTypes() []*JobTypeInfo {
+	jobTypesMu.RLock()
+	defer jobTypesMu.RUnlock()
+	types := make([]*JobTypeInfo, 0, len(jobTypes))
+	for _, info := range jobTypes {
+		types = append(types, info)
+	}
+	sort.Slice(types, func(i, k int) bool { return types[i].Type < types[k].Type })
+	return types
+}
+
+// RegisterPlugins 将配置中的插件注册为任务类型, 插件的类型不能与已注册的类型重复
+// 插件设置了 Validate 时, Job.Check 会调用插件校验任务参数, 因此调用 Check 的机器上也需要有插件文件
+func RegisterPlugins(plugins []Plugin) error {
+	for _, p := range plugins {
+		if p.Type <= 0 || p.Path == "" {
+			return fmt.Errorf("%w: plugin %q requires a positive type and a path", errors.ErrIllegalPlugin, p.Name)
+		}
+		if info, ok := GetJobType(JobType(p.Type)); ok {
+			return fmt.Errorf("%w: type %d of plugin %q is used by %q", errors.ErrIllegalPlugin, p.Type, p.Name, info.Name)
+		}
+		var validate JobTypeValidator
+		if p.Validate {
+			path, args := p.Path, p.Args
+			validate = func(j *Job) error {
+				if err := plugin.Validate(path, args, j); err != nil {
+					return fmt.Errorf("%w: %s", errors.ErrIllegalPluginParams, err.Error())
+				}
+				return nil
+			}
+		}
+		RegisterJobType(JobType(p.Type), p.Name, validate)
+	}
+	return nil
+}
+
+// checkJobType 确认任务类型已注册, 并执行该类型的校验函数
+func (j *Job) checkJobType() error {
+	info, ok := GetJobType(j.Type)
+	if !ok {
+		return fmt.Errorf("%w: %d", errors.ErrUnknownJobType, j.Type)
+	}
+	if info.Validate == nil {
+		return nil
+	}
+	return info.Validate(j)
+}
+
+func validateHttpJob(j *Job) error {
+	if j.Http == nil {
+		return nil
+	}
+	return j.Http.Check()
+}
+
+func validateShellJob(j *Job) error {
+	_, err := GetShellInterpreter(j.Interpreter)
+	return err
+}
+
+func validateContainerJob(j *Job) error {
+	if j.Container == nil {
+		return fmt.Errorf("%w: container is required", errors.ErrIllegalContainerSpec)
+	}
+	return j.Container.Check()
+}
+
+func validateSQLJob(j *Job) error {
+	if j.SQL == nil {
+		return fmt.Errorf("%w: sql is required", errors.ErrIllegalSQLSpec)
+	}
+	return j.SQL.Check()
+}
+
+func validateGRPCJob(j *Job) error {
+	if j.GRPC == nil {
+		return fmt.Errorf("%w: grpc is required", errors.ErrIllegalGRPCSpec)
+	}
+	return j.GRPC.Check()
+}
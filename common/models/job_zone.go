@@ -0,0 +1,70 @@
+package models
+
+import (
+	"crony/common/pkg/schedule"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strings"
+	"time"
+	// 节点所在的机器可能没有安装时区数据库, 内嵌一份以保证时区可以加载
+	_ "time/tzdata"
+)
+
+// 调度时刻落在夏令时开始时跳过的时间段(例如 02:00-03:00 不存在)时的处理方式
+// 夏令时结束时重复出现的时间段中, 同一个墙上时间只在第一次出现时执行一次
+const (
+	DstGapRunOnce = "run_once" // 在跳变后的第一个时刻执行一次, 默认值
+	DstGapSkip    = "skip"     // 跳过本次调度
+)
+
+// LocalTimeZone 是未设置时区的任务在作业日志中记录的时区名称, 表示节点本地时区
+const LocalTimeZone = "Local"
+
+// checkTimeZone 校验任务的时区和夏令时处理方式
+func (j *Job) checkTimeZone() error {
+	j.TimeZone = strings.TrimSpace(j.TimeZone)
+	if _, err := j.Location(); err != nil {
+		return err
+	}
+	switch j.DstGap {
+	case "", DstGapRunOnce, DstGapSkip:
+	default:
+		return fmt.Errorf("%w: unknown dst_gap %q", errors.ErrIllegalTimeZone, j.DstGap)
+	}
+	return nil
+}
+
+// Location 返回任务定时表达式使用的时区, 未设置时为节点本地时区
+func (j *Job) Location() (*time.Location, error) {
+	loc, err := schedule.LoadLocation(j.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errors.ErrIllegalTimeZone, err.Error())
+	}
+	return loc, nil
+}
+
+// checkSpec 校验定时表达式, 错误中包含出错的位置
+// 表达式为空的任务不会被调度, 只能立即执行
+// 节点同样调用这里校验 etcd 中的任务, 因此接受已经保存的 5 段表达式并按之前的读法解析; 新保存的表达式由 admin 调用 schedule.CheckSpec 校验
+func (j *Job) checkSpec() error {
+	j.Spec = strings.TrimSpace(j.Spec)
+	if j.Spec == "" {
+		return nil
+	}
+	s, err := schedule.ParseSpec(j.Spec)
+	if err != nil {
+		return err
+	}
+	if s.Next(time.Now().UTC()).IsZero() {
+		return fmt.Errorf("%w: %q never fires", errors.ErrIllegalSpec, j.Spec)
+	}
+	return nil
+}
+
+// ZoneName 返回作业日志中记录的时区名称
+func (j *Job) ZoneName() string {
+	if j.TimeZone == "" {
+		return LocalTimeZone
+	}
+	return j.TimeZone
+}
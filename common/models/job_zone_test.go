@@ -0,0 +1,46 @@
+package models_test
+
+import (
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"testing"
+)
+
+func TestJobTimeZoneCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, TimeZone: "Mars/Olympus_Mons"},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, TimeZone: models.LocalTimeZone},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, TimeZone: "Asia/Tokyo", DstGap: "sometimes"},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalTimeZone) {
+			t.Errorf("job %+v: expect ErrIllegalTimeZone, got %v", job, err)
+		}
+	}
+	job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, TimeZone: " Asia/Tokyo ", DstGap: models.DstGapSkip}
+	if err := job.Check(); err != nil || job.ZoneName() != "Asia/Tokyo" {
+		t.Fatalf("zone %q err %v", job.ZoneName(), err)
+	}
+	if (&models.Job{}).ZoneName() != models.LocalTimeZone {
+		t.Fatal("job without time zone should use local time zone")
+	}
+}
+
+func TestJobSpecCheck(t *testing.T) {
+	for _, spec := range []string{"0 0 9 * * 8", "0 0 0 30 2 *", "@every"} {
+		job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, Spec: spec}
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalSpec) {
+			t.Errorf("spec %q: expect ErrIllegalSpec, got %v", spec, err)
+		}
+	}
+	job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, Spec: " 0 0 9 * * 1-5 "}
+	if err := job.Check(); err != nil || job.Spec != "0 0 9 * * 1-5" {
+		t.Fatalf("spec %q err %v", job.Spec, err)
+	}
+	// 节点用 Check 校验 etcd 中的任务, 已经保存的 5 段表达式按之前的读法接受, 由 admin 保存时再拒绝
+	job = &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, Spec: "0 9 * * 1-5"}
+	if err := job.Check(); err != nil {
+		t.Fatalf("legacy 5-field spec should still be scheduled, got %v", err)
+	}
+}
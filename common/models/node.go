@@ -2,6 +2,7 @@ package models
 
 import (
 	"crony/common/pkg/dbclient"
+	"encoding/json"
 	"fmt"
 )
 
@@ -16,10 +17,13 @@ type Node struct {
 	ID       int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                // 主键ID
 	PID      string `json:"pid" gorm:"size:16;column:pid;not null"`                        // 进程ID
 	IP       string `json:"ip" gorm:"size:32;column:ip;default:''"`                        // IP地址
-	Hostname string `json:"hostname" gorm:"size64;column:hostname;default:''"`             // 主机名
+	Hostname string `json:"hostname" gorm:"size:64;column:hostname;default:''"`            // 主机名
 	UUID     string `json:"uuid" gorm:"size:128;column:uuid;not null;index:idx_node_uuid"` // 节点唯一标识
 	Version  string `json:"version" gorm:"size:64;column:version;default:''"`              // 版本号
 	Status   int    `json:"statur" gorm:"size:1;column:status"`                            // 状态
+	Labels   []byte `json:"-" gorm:"size:512;column:labels;default:null"`                  // 节点标签（字节数组）
+
+	LabelMap map[string]string `json:"labels" gorm:"-"` // 节点标签
 
 	UpTime   int64 `json:"up" gorm:"column:up;not null"`      // 上线时间
 	DownTime int64 `json:"down" gorm:"column:down;default:0"` // 下线时间
@@ -58,3 +62,27 @@ func (n *Node) FindByUUID() error {
 func (n *Node) TableName() string {
 	return CronyNodeTableName
 }
+
+// 序列化节点标签, 以便写入数据库
+func (n *Node) Marshal() (err error) {
+	n.Labels, err = json.Marshal(n.LabelMap)
+	return
+}
+
+// 反序列化节点标签
+func (n *Node) Unmarshal() error {
+	if len(n.Labels) == 0 {
+		return nil
+	}
+	return json.Unmarshal(n.Labels, &n.LabelMap)
+}
+
+// 判断节点标签是否满足选择器中的全部键值对
+func (n *Node) MatchLabels(selector map[string]string) bool {
+	for k, v := range selector {
+		if n.LabelMap[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,329 @@
+package models
+
+import (
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 连线的触发条件, 决定上游步骤结束后下游步骤是否执行
+const (
+	WorkflowOnSuccess = "success" // 上游执行成功, 默认值
+	WorkflowOnFailure = "failure" // 上游执行失败
+	WorkflowOnAlways  = "always"  // 上游执行结束, 无论成功还是失败
+)
+
+// 工作流运行及其步骤的状态
+const (
+	WorkflowStatusPending = 0 // 等待上游步骤结束
+	WorkflowStatusRunning = 1 // 执行中
+	WorkflowStatusSuccess = 2 // 执行成功
+	WorkflowStatusFailed  = 3 // 执行失败
+	WorkflowStatusSkipped = 4 // 连线的条件不满足, 未执行
+)
+
+// 工作流运行的触发方式
+const (
+	WorkflowTriggerSchedule = "schedule" // 按工作流的定时表达式触发
+	WorkflowTriggerManual   = "manual"   // 通过接口手动触发
+)
+
+// Workflow 是由已有任务组成的有向无环图, 以一个定时表达式调度
+// 保存在 MySQL 中, 并发布到 etcd 的 /crony/workflow/<workflow_id>, 由当选的 admin 实例调度
+type Workflow struct {
+	ID       int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                                      // 工作流ID
+	Name     string `json:"name" gorm:"size:64;column:name;not null;index:idx_workflow_name" binding:"required"` // 工作流名称
+	Spec     string `json:"spec" gorm:"size:64;column:spec;default:''"`                                          // 定时表达式, 为空时只能手动触发
+	TimeZone string `json:"time_zone" gorm:"size:64;column:time_zone;default:''"`                                // 定时表达式使用的时区
+	DstGap   string `json:"dst_gap" gorm:"size:16;column:dst_gap;default:''"`                                    // 调度时刻落在夏令时跳过的时间段时的处理方式
+	StepSpec []byte `json:"-" gorm:"type:text;column:steps;default:null"`                                        // 步骤（字节数组）
+	EdgeSpec []byte `json:"-" gorm:"type:text;column:edges;default:null"`                                        // 连线（字节数组）
+	Note     string `json:"note" gorm:"size:512;column:note;default:''"`                                         // 备注
+	Created  int64  `json:"created" gorm:"column:created;not null"`                                              // 创建时间
+	Updated  int64  `json:"updated" gorm:"column:updated;default:0"`                                             // 更新时间
+
+	Steps []WorkflowStep `json:"steps" gorm:"-"` // 步骤
+	Edges []WorkflowEdge `json:"edges" gorm:"-"` // 连线
+}
+
+// WorkflowStep 是工作流中的一个步骤, 执行一个已有的任务
+type WorkflowStep struct {
+	Name  string `json:"name"`   // 步骤名称, 在工作流内唯一, 连线通过名称引用步骤
+	JobID int    `json:"job_id"` // 执行的任务ID
+	RunOn string `json:"run_on"` // 执行节点, 为空时由任务的运行节点执行, 任务未分配节点时由任意一个在线节点执行
+}
+
+// WorkflowEdge 是一条连线, From 结束且满足条件 On 时 To 才能执行
+type WorkflowEdge struct {
+	From string `json:"from"` // 上游步骤名称
+	To   string `json:"to"`   // 下游步骤名称
+	On   string `json:"on"`   // 触发条件, 为空时为 success
+}
+
+// WorkflowDag 是工作流的步骤和连线, 工作流运行时保存一份快照, 修改工作流不影响已经开始的运行
+type WorkflowDag struct {
+	Steps []WorkflowStep `json:"steps"`
+	Edges []WorkflowEdge `json:"edges"`
+}
+
+// Insert 插入新工作流
+func (w *Workflow) Insert() (insertId int, err error) {
+	err = dbclient.GetMysqlDB().Table(CronyWorkflowTableName).Create(w).Error
+	if err == nil {
+		insertId = w.ID
+	}
+	return
+}
+
+// Update 更新工作流
+func (w *Workflow) Update() error {
+	return dbclient.GetMysqlDB().Table(CronyWorkflowTableName).Select("*").Updates(w).Error
+}
+
+// Delete 删除工作流
+func (w *Workflow) Delete() error {
+	return dbclient.GetMysqlDB().Exec(fmt.Sprintf("delete from %s where id = ?", CronyWorkflowTableName), w.ID).Error
+}
+
+// FindById 根据ID查找工作流
+func (w *Workflow) FindById() error {
+	return dbclient.GetMysqlDB().Table(CronyWorkflowTableName).Where("id = ?", w.ID).First(w).Error
+}
+
+// TableName 返回表名
+func (w *Workflow) TableName() string {
+	return CronyWorkflowTableName
+}
+
+// Val 返回工作流的JSON字符串
+func (w *Workflow) Val() string {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// Dag 返回工作流的步骤和连线
+func (w *Workflow) Dag() *WorkflowDag {
+	return &WorkflowDag{Steps: w.Steps, Edges: w.Edges}
+}
+
+// Location 返回定时表达式使用的时区, 未设置时为本地时区
+func (w *Workflow) Location() (*time.Location, error) {
+	return (&Job{TimeZone: w.TimeZone}).Location()
+}
+
+// Check 校验工作流
+// 定时表达式、时区和夏令时的规则与任务相同
+func (w *Workflow) Check() error {
+	w.Name = strings.TrimSpace(w.Name)
+	if len(w.Name) == 0 {
+		return errors.ErrEmptyWorkflowName
+	}
+	job := &Job{Spec: w.Spec, TimeZone: w.TimeZone, DstGap: w.DstGap}
+	if err := job.checkSpec(); err != nil {
+		return err
+	}
+	if err := job.checkTimeZone(); err != nil {
+		return err
+	}
+	w.Spec, w.TimeZone = job.Spec, job.TimeZone
+	return w.Dag().Check()
+}
+
+// Marshal 序列化步骤和连线, 以便写入数据库
+func (w *Workflow) Marshal() (err error) {
+	if w.StepSpec, err = json.Marshal(w.Steps); err != nil {
+		return
+	}
+	w.EdgeSpec, err = json.Marshal(w.Edges)
+	return
+}
+
+// Unmarshal 反序列化步骤和连线
+func (w *Workflow) Unmarshal() (err error) {
+	if len(w.StepSpec) > 0 {
+		if err = json.Unmarshal(w.StepSpec, &w.Steps); err != nil {
+			return
+		}
+	}
+	if len(w.EdgeSpec) > 0 {
+		err = json.Unmarshal(w.EdgeSpec, &w.Edges)
+	}
+	return
+}
+
+// Check 校验步骤和连线: 步骤名称唯一, 连线引用的步骤存在, 且图中没有环
+func (d *WorkflowDag) Check() error {
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("%w: steps are empty", errors.ErrIllegalWorkflow)
+	}
+	names := make(map[string]bool, len(d.Steps))
+	for i := range d.Steps {
+		s := &d.Steps[i]
+		s.Name = strings.TrimSpace(s.Name)
+		s.RunOn = strings.TrimSpace(s.RunOn)
+		// 步骤名称是 etcd key 的一部分
+		if s.Name == "" || strings.ContainsAny(s.Name, "/\\") {
+			return fmt.Errorf("%w: invalid step name %q", errors.ErrIllegalWorkflow, s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("%w: duplicate step %q", errors.ErrIllegalWorkflow, s.Name)
+		}
+		if s.JobID <= 0 {
+			return fmt.Errorf("%w: job_id of step %q is required", errors.ErrIllegalWorkflow, s.Name)
+		}
+		names[s.Name] = true
+	}
+	edges := make(map[[2]string]bool, len(d.Edges))
+	for i := range d.Edges {
+		e := &d.Edges[i]
+		e.From, e.To = strings.TrimSpace(e.From), strings.TrimSpace(e.To)
+		if e.On == "" {
+			e.On = WorkflowOnSuccess
+		}
+		if !names[e.From] || !names[e.To] {
+			return fmt.Errorf("%w: edge %s -> %s refers to unknown step", errors.ErrIllegalWorkflow, e.From, e.To)
+		}
+		if e.From == e.To {
+			return fmt.Errorf("%w: step %q depends on itself", errors.ErrIllegalWorkflow, e.From)
+		}
+		if edges[[2]string{e.From, e.To}] {
+			return fmt.Errorf("%w: duplicate edge %s -> %s", errors.ErrIllegalWorkflow, e.From, e.To)
+		}
+		switch e.On {
+		case WorkflowOnSuccess, WorkflowOnFailure, WorkflowOnAlways:
+		default:
+			return fmt.Errorf("%w: unknown condition %q of edge %s -> %s", errors.ErrIllegalWorkflow, e.On, e.From, e.To)
+		}
+		edges[[2]string{e.From, e.To}] = true
+	}
+	// 按拓扑顺序逐个移除入度为 0 的步骤, 剩下的步骤都在环上
+	indegree := make(map[string]int, len(d.Steps))
+	for _, e := range d.Edges {
+		indegree[e.To]++
+	}
+	queue := make([]string, 0, len(d.Steps))
+	for _, s := range d.Steps {
+		if indegree[s.Name] == 0 {
+			queue = append(queue, s.Name)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, e := range d.Edges {
+			if e.From != queue[i] {
+				continue
+			}
+			if indegree[e.To]--; indegree[e.To] == 0 {
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	if len(queue) < len(d.Steps) {
+		var cycle []string
+		for _, s := range d.Steps {
+			if indegree[s.Name] > 0 {
+				cycle = append(cycle, s.Name)
+			}
+		}
+		return fmt.Errorf("%w: steps %v form a cycle", errors.ErrIllegalWorkflow, cycle)
+	}
+	return nil
+}
+
+// Step 返回指定名称的步骤
+func (d *WorkflowDag) Step(name string) (*WorkflowStep, bool) {
+	for i := range d.Steps {
+		if d.Steps[i].Name == name {
+			return &d.Steps[i], true
+		}
+	}
+	return nil, false
+}
+
+// Descendants 返回 names 及其全部下游步骤
+func (d *WorkflowDag) Descendants(names []string) map[string]bool {
+	set := make(map[string]bool, len(d.Steps))
+	queue := append([]string(nil), names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if set[name] {
+			continue
+		}
+		set[name] = true
+		for _, e := range d.Edges {
+			if e.From == name {
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return set
+}
+
+// Resolve 根据各步骤的状态找出可以执行和需要跳过的步骤, 并更新 status
+// 步骤的全部上游都结束后才会判断: 所有入边的条件都满足时执行, 否则跳过; 被跳过的上游不满足任何条件
+// 跳过会沿连线向下游传递, 直到没有新的步骤可以判断
+func (d *WorkflowDag) Resolve(status map[string]int) (run, skip []string) {
+	for changed := true; changed; {
+		changed = false
+		for _, s := range d.Steps {
+			if status[s.Name] != WorkflowStatusPending {
+				continue
+			}
+			ready, ok := true, true
+			for _, e := range d.Edges {
+				if e.To != s.Name {
+					continue
+				}
+				switch from := status[e.From]; from {
+				case WorkflowStatusPending, WorkflowStatusRunning:
+					ready = false
+				default:
+					ok = ok && edgeSatisfied(e.On, from)
+				}
+			}
+			if !ready {
+				continue
+			}
+			if ok {
+				status[s.Name] = WorkflowStatusRunning
+				run = append(run, s.Name)
+			} else {
+				status[s.Name] = WorkflowStatusSkipped
+				skip = append(skip, s.Name)
+				changed = true
+			}
+		}
+	}
+	return
+}
+
+// Finished 判断全部步骤是否都已结束, 结束时任一步骤失败则工作流运行失败
+func (d *WorkflowDag) Finished(status map[string]int) (done, success bool) {
+	success = true
+	for _, s := range d.Steps {
+		switch status[s.Name] {
+		case WorkflowStatusPending, WorkflowStatusRunning:
+			return false, false
+		case WorkflowStatusFailed:
+			success = false
+		}
+	}
+	return true, success
+}
+
+// edgeSatisfied 判断上游状态为 from 时条件 on 是否满足
+func edgeSatisfied(on string, from int) bool {
+	switch on {
+	case WorkflowOnFailure:
+		return from == WorkflowStatusFailed
+	case WorkflowOnAlways:
+		return from == WorkflowStatusSuccess || from == WorkflowStatusFailed
+	}
+	return from == WorkflowStatusSuccess
+}
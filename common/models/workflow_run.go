@@ -0,0 +1,99 @@
+package models
+
+import (
+	"crony/common/pkg/dbclient"
+	"encoding/json"
+)
+
+// WorkflowRun 是工作流的一次运行, 是其中各步骤 job_log 的上级记录
+type WorkflowRun struct {
+	ID         int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                                      // 运行ID
+	WorkflowID int    `json:"workflow_id" gorm:"column:workflow_id;not null;index:idx_workflow_run_workflow"`      // 工作流ID
+	Name       string `json:"name" gorm:"size:64;column:name;not null"`                                            // 工作流名称
+	Status     int    `json:"status" gorm:"size:1;column:status;not null;default:0;index:idx_workflow_run_status"` // 状态
+	Trigger    string `json:"trigger" gorm:"size:16;column:trigger_type;not null"`                                 // 触发方式
+	Retries    int    `json:"retries" gorm:"column:retries;not null;default:0"`                                    // 重试失败子图的次数
+	DagSpec    []byte `json:"-" gorm:"type:text;column:dag;default:null"`                                          // 步骤和连线的快照（字节数组）
+	FireTime   int64  `json:"fire_time" gorm:"column:fire_time;default:0"`                                         // 调度时刻, 手动触发时为 0
+	StartTime  int64  `json:"start_time" gorm:"column:start_time;not null"`                                        // 开始时间
+	EndTime    int64  `json:"end_time" gorm:"column:end_time;default:0"`                                           // 结束时间
+
+	Dag   *WorkflowDag      `json:"dag" gorm:"-"`   // 步骤和连线的快照
+	Steps []WorkflowRunStep `json:"steps" gorm:"-"` // 各步骤的状态, 只在查询单个运行时返回
+}
+
+// WorkflowRunStep 是工作流运行中一个步骤的状态
+type WorkflowRunStep struct {
+	ID        int    `json:"id" gorm:"column:id;primary_key;auto_increment"`                             // 主键，自增
+	RunID     int    `json:"run_id" gorm:"column:run_id;not null;uniqueIndex:idx_workflow_run_step"`     // 所属的工作流运行ID
+	Step      string `json:"step" gorm:"size:64;column:step;not null;uniqueIndex:idx_workflow_run_step"` // 步骤名称
+	JobID     int    `json:"job_id" gorm:"column:job_id;not null"`                                       // 任务ID
+	Status    int    `json:"status" gorm:"size:1;column:status;not null;default:0"`                      // 状态
+	Attempt   int    `json:"attempt" gorm:"column:attempt;not null;default:0"`                           // 第几次执行, 重试时加 1, 用于丢弃过期的结果
+	NodeUUID  string `json:"node_uuid" gorm:"size:128;column:node_uuid;default:''"`                      // 执行节点
+	JobLogID  int    `json:"job_log_id" gorm:"column:job_log_id;default:0"`                              // 对应的任务日志ID
+	Output    string `json:"output" gorm:"size:512;column:output"`                                       // 执行输出
+	Error     string `json:"error" gorm:"size:512;column:error"`                                         // 失败原因
+	StartTime int64  `json:"start_time" gorm:"column:start_time;default:0"`                              // 开始时间
+	EndTime   int64  `json:"end_time" gorm:"column:end_time;default:0"`                                  // 结束时间
+}
+
+// WorkflowStepTrigger 是步骤的触发, 写入 /crony/step/<run_id>/<step>
+type WorkflowStepTrigger struct {
+	RunID   int    `json:"run_id"`  // 工作流运行ID
+	Step    string `json:"step"`    // 步骤名称
+	JobID   int    `json:"job_id"`  // 任务ID
+	Attempt int    `json:"attempt"` // 第几次执行
+	Target  string `json:"target"`  // 执行节点的 UUID, 为 "any" 时由任意一个在线节点执行
+}
+
+// WorkflowStepResult 是步骤的执行结果, 写入 /crony/step-result/<run_id>/<step>
+type WorkflowStepResult struct {
+	RunID     int    `json:"run_id"`     // 工作流运行ID
+	Step      string `json:"step"`       // 步骤名称
+	Attempt   int    `json:"attempt"`    // 第几次执行
+	NodeUUID  string `json:"node_uuid"`  // 执行节点
+	JobLogID  int    `json:"job_log_id"` // 对应的任务日志ID
+	Success   bool   `json:"success"`    // 是否成功
+	Output    string `json:"output"`     // 执行输出
+	Error     string `json:"error"`      // 错误信息
+	StartTime int64  `json:"start_time"` // 开始时间
+	EndTime   int64  `json:"end_time"`   // 结束时间
+}
+
+// FindById 根据ID查找工作流运行
+func (r *WorkflowRun) FindById() error {
+	return dbclient.GetMysqlDB().Table(CronyWorkflowRunTableName).Where("id = ?", r.ID).First(r).Error
+}
+
+// TableName 返回表名
+func (r *WorkflowRun) TableName() string {
+	return CronyWorkflowRunTableName
+}
+
+// Marshal 序列化步骤和连线的快照, 以便写入数据库
+func (r *WorkflowRun) Marshal() (err error) {
+	r.DagSpec, err = json.Marshal(r.Dag)
+	return
+}
+
+// Unmarshal 反序列化步骤和连线的快照
+func (r *WorkflowRun) Unmarshal() error {
+	r.Dag = new(WorkflowDag)
+	if len(r.DagSpec) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.DagSpec, r.Dag)
+}
+
+// FindSteps 查询工作流运行的全部步骤
+func (r *WorkflowRun) FindSteps() ([]WorkflowRunStep, error) {
+	steps := make([]WorkflowRunStep, 0)
+	err := dbclient.GetMysqlDB().Table(CronyWorkflowRunStepTableName).Where("run_id = ?", r.ID).Order("id").Find(&steps).Error
+	return steps, err
+}
+
+// TableName 返回表名
+func (s *WorkflowRunStep) TableName() string {
+	return CronyWorkflowRunStepTableName
+}
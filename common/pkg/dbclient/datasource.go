@@ -0,0 +1,46 @@
+package dbclient
+
+import (
+	"database/sql"
+	"sync"
+
+	// 注册 database/sql 的 mysql 驱动, 其他驱动需要在使用方以匿名导入的方式注册
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DefaultDatasourceDriver 是数据源未指定驱动时使用的驱动
+const DefaultDatasourceDriver = "mysql"
+
+var (
+	datasourceMu sync.Mutex
+	datasources  = make(map[string]*sql.DB)
+)
+
+// GetDatasource 函数返回指定名称的数据源的连接池, 首次使用时创建, 之后复用
+//
+// @param name string: 数据源名称
+// @param driver string: database/sql 的驱动名, 为空时使用 mysql
+// @param dsn string: 数据源名称(Data Source Name)
+// @param maxIdleConns int: 连接池中最大空闲连接数, 为 0 时使用 database/sql 的默认值
+// @param maxOpenConns int: 连接池中最大打开连接数, 为 0 时不限制
+func GetDatasource(name, driver, dsn string, maxIdleConns, maxOpenConns int) (*sql.DB, error) {
+	datasourceMu.Lock()
+	defer datasourceMu.Unlock()
+	if db, ok := datasources[name]; ok {
+		return db, nil
+	}
+	if driver == "" {
+		driver = DefaultDatasourceDriver
+	}
+	// sql.Open 只校验参数, 连接在第一次执行语句时建立
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if maxIdleConns > 0 {
+		db.SetMaxIdleConns(maxIdleConns)
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	datasources[name] = db
+	return db, nil
+}
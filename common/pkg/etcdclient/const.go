@@ -21,9 +21,38 @@ const (
 	KeyEtcdOnceProfile = keyEtcdProfile + "once/"
 	KeyEtcdOnce        = KeyEtcdOnceProfile + "%d"
 
+	// key /crony/once-result/<jobID>/<node_uuid>
+	KeyEtcdOnceResultProfile    = keyEtcdProfile + "once-result/"
+	KeyEtcdJobOnceResultProfile = KeyEtcdOnceResultProfile + "%d/"
+	KeyEtcdOnceResult           = KeyEtcdJobOnceResultProfile + "%s"
+
+	// key /crony/calendar/<calendar_id>
+	KeyEtcdCalendarProfile = keyEtcdProfile + "calendar/"
+	KeyEtcdCalendar        = KeyEtcdCalendarProfile + "%d"
+
+	// key /crony/workflow/<workflow_id>
+	KeyEtcdWorkflowProfile = keyEtcdProfile + "workflow/"
+	KeyEtcdWorkflow        = KeyEtcdWorkflowProfile + "%d"
+
+	// key /crony/step/<run_id>/<step>
+	KeyEtcdStepProfile = keyEtcdProfile + "step/"
+	KeyEtcdStep        = KeyEtcdStepProfile + "%d/%s"
+
+	// key /crony/step-result/<run_id>/<step>
+	KeyEtcdStepResultProfile = keyEtcdProfile + "step-result/"
+	KeyEtcdStepResult        = KeyEtcdStepResultProfile + "%d/%s"
+
+	// key /crony/fire/<job_id>, 值为任务最近一次调度时刻的 unix 秒
+	KeyEtcdFireProfile = keyEtcdProfile + "fire/"
+	KeyEtcdFire        = KeyEtcdFireProfile + "%d"
+
 	KeyEtcdLockProfile = keyEtcdProfile + "lock/"
 	KeyEtcdLock        = KeyEtcdLockProfile + "%s"
 
+	// key /crony/election/<name>/<lease_id>
+	KeyEtcdElectionProfile = keyEtcdProfile + "election/"
+	KeyEtcdElection        = KeyEtcdElectionProfile + "%s"
+
 	// key /crony/system/<node_uuid>
 	KeyEtcdSystemProfile = keyEtcdProfile + "system/"
 	KeyEtcdSystemSwitch  = KeyEtcdSystemProfile + "switch/" + "%s"
@@ -0,0 +1,175 @@
+package etcdclient
+
+import (
+	"context"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// Election 是基于租约的领导者选举
+// 每个参与者持有一个绑定租约的会话, 并在 /crony/election/<name>/ 下创建自己的 key,
+// 创建版本最小的 key 的持有者即为领导者; 会话租约过期时其 key 被删除, 排在后面的参与者自动当选
+type Election struct {
+	Client *Client // 封装了 etcd 客户端连接的自定义结构体
+	Name   string  // 选举名称
+	Ttl    int64   // 会话租约的有效期(秒)
+
+	mu       sync.Mutex
+	session  *concurrency.Session  // 当前会话, 租约失效后需要重新创建
+	election *concurrency.Election // 绑定在当前会话上的选举
+	cancel   context.CancelFunc    // 取消当前的领导者 context
+}
+
+// NewElection 是 Election 的构造函数
+func NewElection(name string, ttl int64) *Election {
+	return &Election{
+		Client: _defaultEtcd,
+		Name:   name,
+		Ttl:    ttl,
+	}
+}
+
+// Campaign 参与选举, 阻塞直到当选、ctx 被取消或出错
+// 当选后返回一个领导者 context: 调用 Resign、Close, 或会话租约丢失时该 context 会被取消,
+// 领导者应当在它被取消后立即停止只允许单实例执行的工作
+// value 是当选后对外公布的领导者信息, 可以通过 Leader 或 Observe 读取
+func (e *Election) Campaign(ctx context.Context, value string) (context.Context, error) {
+	session, election, err := e.ensureSession()
+	if err != nil {
+		return nil, err
+	}
+	// 等待期间会话失效时同样放弃本次竞选
+	campaignCtx, campaignCancel := context.WithCancel(ctx)
+	defer campaignCancel()
+	go func() {
+		select {
+		case <-session.Done():
+			campaignCancel()
+		case <-campaignCtx.Done():
+		}
+	}()
+	if err = election.Campaign(campaignCtx, value); err != nil {
+		return nil, err
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	e.mu.Lock()
+	e.cancel = cancel
+	e.mu.Unlock()
+	// 会话租约丢失意味着领导者身份已经失去
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-leaderCtx.Done():
+		}
+	}()
+	return leaderCtx, nil
+}
+
+// Resign 主动放弃领导者身份, 领导者 context 会被取消, 排在后面的参与者随即当选
+func (e *Election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	election, cancel := e.election, e.cancel
+	e.cancel = nil
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if election == nil {
+		return nil
+	}
+	return election.Resign(ctx)
+}
+
+// Close 放弃领导者身份并撤销会话租约
+func (e *Election) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Client.reqTimeout)
+	defer cancel()
+	err := e.Resign(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session != nil {
+		if closeErr := e.session.Close(); err == nil {
+			err = closeErr
+		}
+		e.session, e.election = nil, nil
+	}
+	return err
+}
+
+// Leader 返回当前领导者公布的信息, 没有领导者时返回 ErrNotFound
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	resp, err := e.Client.Get(ctx, e.prefix(), clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", errors.ErrNotFound
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Observe 返回一个通道, 每当领导者发生变化时写入新领导者公布的信息, 没有领导者时写入空字符串
+// 不参与选举的组件也可以通过它感知当前的领导者, ctx 被取消后通道关闭
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		rch := e.Client.Watch(ctx, e.prefix(), clientv3.WithPrefix())
+		var (
+			last  string
+			first = true
+		)
+		for {
+			leader, err := e.Leader(ctx)
+			if err != nil && err != errors.ErrNotFound {
+				if ctx.Err() != nil {
+					return
+				}
+			} else if first || leader != last {
+				first, last = false, leader
+				select {
+				case ch <- leader:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// 等待选举前缀下的下一次变化
+			if _, ok := <-rch; !ok {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// prefix 返回参与者 key 的公共前缀
+func (e *Election) prefix() string {
+	return fmt.Sprintf(KeyEtcdElection, e.Name) + "/"
+}
+
+// ensureSession 返回一个有效的会话, 上一个会话的租约已失效时重新创建
+func (e *Election) ensureSession() (*concurrency.Session, *concurrency.Election, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session != nil {
+		select {
+		case <-e.session.Done():
+			e.session, e.election = nil, nil
+		default:
+			return e.session, e.election, nil
+		}
+	}
+	session, err := concurrency.NewSession(e.Client.Client, concurrency.WithTTL(int(e.Ttl)))
+	if err != nil {
+		return nil, nil, err
+	}
+	e.session = session
+	e.election = concurrency.NewElection(session, fmt.Sprintf(KeyEtcdElection, e.Name))
+	return e.session, e.election, nil
+}
@@ -0,0 +1,108 @@
+package etcdclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElectionCampaignAndResign(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	e1, e2 := NewElection("test", 5), NewElection("test", 5)
+	defer e1.Close()
+	defer e2.Close()
+
+	leader1, err := e1.Campaign(ctx, "node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader, _ := e1.Leader(ctx); leader != "node-1" {
+		t.Fatalf("want leader node-1, got %q", leader)
+	}
+
+	// 第二个参与者会一直阻塞, 直到第一个放弃领导者身份
+	elected := make(chan context.Context)
+	go func() {
+		leader2, err := e2.Campaign(ctx, "node-2")
+		if err != nil {
+			t.Error(err)
+		}
+		elected <- leader2
+	}()
+	select {
+	case <-elected:
+		t.Fatal("two leaders at the same time")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err = e1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-leader1.Done():
+	default:
+		t.Fatal("leader context is not cancelled after resign")
+	}
+	select {
+	case <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second candidate is not elected after resign")
+	}
+	if leader, _ := e2.Leader(ctx); leader != "node-2" {
+		t.Fatalf("want leader node-2, got %q", leader)
+	}
+}
+
+func TestElectionLeaseLost(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	e := NewElection("lease-lost", 5)
+	defer e.Close()
+
+	leaderCtx, err := e.Campaign(ctx, "node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟租约丢失
+	if _, err = e.Client.Revoke(ctx, e.session.Lease()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("leader context is not cancelled after the lease is lost")
+	}
+
+	// 租约丢失后可以使用新的会话重新竞选
+	if _, err = e.Campaign(ctx, "node-1"); err != nil {
+		t.Fatal(err)
+	}
+	if leader, _ := e.Leader(ctx); leader != "node-1" {
+		t.Fatalf("want leader node-1, got %q", leader)
+	}
+}
+
+func TestElectionObserve(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := NewElection("observe", 5)
+	defer e.Close()
+
+	ch := NewElection("observe", 5).Observe(ctx)
+	if leader := <-ch; leader != "" {
+		t.Fatalf("want no leader, got %q", leader)
+	}
+	if _, err := e.Campaign(ctx, "node-1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case leader := <-ch:
+		if leader != "node-1" {
+			t.Fatalf("want leader node-1, got %q", leader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("leader change is not observed")
+	}
+}
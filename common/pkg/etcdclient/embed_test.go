@@ -0,0 +1,54 @@
+package etcdclient
+
+import (
+	"crony/common/pkg/logger"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// freeURL 返回一个本机空闲端口的 URL
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// startEmbedEtcd 启动一个本地嵌入式 etcd, 并用它初始化默认客户端
+func startEmbedEtcd(t *testing.T) {
+	dir := t.TempDir()
+	logger.Init(dir, "error", "console", "", "logs", false, "", "", false)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir + "/etcd"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("embedded etcd is not ready")
+	}
+	cli, err := Init([]string{clientURL.Host}, 5, 5)
+	if err != nil {
+		e.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cli.Close()
+		e.Close()
+	})
+}
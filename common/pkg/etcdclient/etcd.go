@@ -117,6 +117,27 @@ func PutWithModRev(key, val string, rev int64) (*clientv3.PutResponse, error) {
 	return &resp, nil
 }
 
+// DeleteWithModRev 只有当 key 的当前 ModRevision 与传入的 rev 相同时才删除
+// 用于避免误删其他客户端在此之后重新写入的值
+func DeleteWithModRev(key string, rev int64) error {
+	if _defaultEtcd == nil {
+		return errors.ErrEtcdNotInit
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), _defaultEtcd.reqTimeout)
+	defer cancel()
+	tresp, err := _defaultEtcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !tresp.Succeeded {
+		return errors.ErrValueMayChanged
+	}
+	return nil
+}
+
 func Get(key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
 	if _defaultEtcd == nil {
 		return nil, errors.ErrEtcdNotInit
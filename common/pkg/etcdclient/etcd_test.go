@@ -0,0 +1,38 @@
+package etcdclient
+
+import (
+	"context"
+	"crony/common/pkg/utils/errors"
+	"testing"
+)
+
+func TestDeleteWithModRev(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	cli := GetEtcdClient()
+	resp, err := cli.Put(ctx, "/crony/once/1", "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := resp.Header.Revision
+	// 触发 key 被重新写入后, 旧版本号不能删除新值
+	if _, err = cli.Put(ctx, "/crony/once/1", "any"); err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteWithModRev("/crony/once/1", rev); err != errors.ErrValueMayChanged {
+		t.Fatalf("expect ErrValueMayChanged, got %v", err)
+	}
+	get, err := cli.Get(ctx, "/crony/once/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.Count != 1 {
+		t.Fatal("key is deleted with a stale revision")
+	}
+	if err = DeleteWithModRev("/crony/once/1", get.Kvs[0].ModRevision); err != nil {
+		t.Fatal(err)
+	}
+	if get, err = cli.Get(ctx, "/crony/once/1"); err != nil || get.Count != 0 {
+		t.Fatalf("key is not deleted: %v", err)
+	}
+}
@@ -1,6 +1,15 @@
 package etcdclient
 
-import "github.com/coreos/etcd/clientv3"
+import (
+	"context"
+	"crony/common/pkg/logger"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+)
 
 // ServerReg 结构体用于管理一个服务在 etcd 上的注册信息和生命周期
 type ServerReg struct {
@@ -11,8 +20,16 @@ type ServerReg struct {
 	KeepAliveChan <-chan *clientv3.LeaseKeepAliveResponse // 接收 etcd 服务端对租约续约请求响应的只读通道
 	// time-to-live
 	Ttl int64 // 租约的有效期
+
+	key     string     // 注册的 key
+	value   string     // 注册的 value
+	stopped bool       // 是否已经调用过 Stop
+	mu      sync.Mutex // 保护 leaseId、cancelFunc、KeepAliveChan 和 stopped
 }
 
+// errRegStopped 表示注册已经停止, 不再申请新的租约
+var errRegStopped = errors.New("server registration is stopped")
+
 // NewServerReg 是 ServerReg 的构造函数
 func NewServerReg(ttl int64) *ServerReg {
 	return &ServerReg{
@@ -22,3 +39,138 @@ func NewServerReg(ttl int64) *ServerReg {
 		stop:   make(chan error), // 初始化用于停止信号的通道
 	}
 }
+
+// Register 将 key/value 绑定到一个新租约上写入 etcd, 并在后台持续续约
+// 租约丢失(例如 etcd 短暂不可用导致租约过期)时会自动重新申请租约并重新写入
+func (s *ServerReg) Register(key, value string) error {
+	s.key = key
+	s.value = value
+	if err := s.grantAndPut(); err != nil {
+		return err
+	}
+	go s.keepAliveListen()
+	return nil
+}
+
+// LeaseID 返回当前使用的租约 ID
+func (s *ServerReg) LeaseID() clientv3.LeaseID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leaseId
+}
+
+// Stop 停止续约并撤销租约, 与租约绑定的 key 会被 etcd 立即删除
+func (s *ServerReg) Stop() error {
+	close(s.stop)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 置位后 grantAndPut 不再写入, 正在进行中的 grantAndPut 会撤销它申请到的租约
+	s.stopped = true
+	if s.cancelFunc != nil {
+		s.cancelFunc()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Client.reqTimeout)
+	defer cancel()
+	_, err := s.Client.Revoke(ctx, s.leaseId)
+	return err
+}
+
+// grantAndPut 申请一个新租约, 将 key/value 绑定到该租约上写入, 并开启续约
+func (s *ServerReg) grantAndPut() error {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		return errRegStopped
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Client.reqTimeout)
+	defer cancel()
+	// 1. 申请租约
+	leaseResp, err := s.Client.Grant(ctx, s.Ttl)
+	if err != nil {
+		return err
+	}
+	// 2. 将 key/value 绑定到租约上写入
+	if _, err = s.Client.Put(ctx, s.key, s.value, clientv3.WithLease(leaseResp.ID)); err != nil {
+		return err
+	}
+	// 3. 开启自动续约, 续约的生命周期由 keepAliveCtx 控制
+	keepAliveCtx, keepAliveCancel := context.WithCancel(context.Background())
+	ch, err := s.Client.KeepAlive(keepAliveCtx, leaseResp.ID)
+	if err != nil {
+		keepAliveCancel()
+		return err
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		// 申请租约期间调用了 Stop, Stop 撤销的是上一个租约, 这个租约需要在这里撤销
+		s.mu.Unlock()
+		keepAliveCancel()
+		revokeCtx, revokeCancel := context.WithTimeout(context.Background(), s.Client.reqTimeout)
+		defer revokeCancel()
+		_, _ = s.Client.Revoke(revokeCtx, leaseResp.ID)
+		return errRegStopped
+	}
+	// 取消上一个租约的续约
+	if s.cancelFunc != nil {
+		s.cancelFunc()
+	}
+	s.leaseId = leaseResp.ID
+	s.cancelFunc = keepAliveCancel
+	s.KeepAliveChan = ch
+	s.mu.Unlock()
+	return nil
+}
+
+// keepAliveListen 消费续约响应
+// 续约通道被关闭说明租约已失效, 此时不断重试重新注册, 直到成功或收到停止信号
+func (s *ServerReg) keepAliveListen() {
+	for {
+		s.mu.Lock()
+		ch := s.KeepAliveChan
+		s.mu.Unlock()
+
+		select {
+		case <-s.stop:
+			return
+		case resp, ok := <-ch:
+			if ok && resp != nil {
+				continue
+			}
+			logger.GetLogger().Warn(fmt.Sprintf("lease of key[%s] is lost, try to register again", s.key))
+			if !s.reRegister() {
+				return
+			}
+			logger.GetLogger().Info(fmt.Sprintf("key[%s] registered again with lease[%x]", s.key, s.LeaseID()))
+		}
+	}
+}
+
+// reRegister 以递增的间隔重试 grantAndPut, 最大间隔不超过一个 TTL
+// 返回 false 表示在重试过程中收到了停止信号
+func (s *ServerReg) reRegister() bool {
+	interval := time.Second
+	maxInterval := time.Duration(s.Ttl) * time.Second
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	for {
+		err := s.grantAndPut()
+		if err == nil {
+			return true
+		}
+		if errors.Is(err, errRegStopped) {
+			return false
+		}
+		logger.GetLogger().Warn(fmt.Sprintf("register key[%s] err: %s", s.key, err.Error()))
+		select {
+		case <-s.stop:
+			return false
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package etcdclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestServerRegReRegister(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	reg := NewServerReg(2)
+	if err := reg.Register("/crony/node/test", "value"); err != nil {
+		t.Fatal(err)
+	}
+	oldLease := reg.LeaseID()
+
+	// 模拟 etcd 侧租约丢失, key 会被删除
+	if _, err := reg.Client.Revoke(ctx, oldLease); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := reg.Client.Get(ctx, "/crony/node/test")
+		if err == nil && resp.Count == 1 && reg.LeaseID() != oldLease {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key is not registered again after the lease is lost")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Stop 撤销租约后 key 立即被删除
+	if err := reg.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := reg.Client.Get(ctx, "/crony/node/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 0 {
+		t.Fatal("key still exists after stop")
+	}
+}
+
+func TestServerRegKeepAlive(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	reg := NewServerReg(1)
+	if err := reg.Register("/crony/node/keep", "value"); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	lease := reg.LeaseID()
+
+	// 续约正常时, 超过 ttl 之后 key 仍然存在且租约不变
+	time.Sleep(3 * time.Second)
+	resp, err := reg.Client.Get(ctx, "/crony/node/keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 1 {
+		t.Fatal("key expired while keep-alive is running")
+	}
+	if reg.LeaseID() != lease || resp.Kvs[0].Lease != int64(lease) {
+		t.Fatalf("lease changed from %d to %d without losing it", lease, reg.LeaseID())
+	}
+}
+
+func TestServerRegStopBeforeReRegister(t *testing.T) {
+	startEmbedEtcd(t)
+	ctx := context.Background()
+	reg := NewServerReg(2)
+	if err := reg.Register("/crony/node/stopped", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// 停止之后的重新注册不能再申请租约写入 key
+	if reg.reRegister() {
+		t.Fatal("re-register succeeded after stop")
+	}
+	resp, err := reg.Client.Get(ctx, "/crony/node/stopped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 0 {
+		t.Fatal("key is registered again after stop")
+	}
+}
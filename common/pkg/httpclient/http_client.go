@@ -2,6 +2,7 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
 	"crony/common/pkg/logger"
 	"fmt"
 	"io"
@@ -13,11 +14,16 @@ import (
 // url: 目标请求的 URL
 // timeout: 请求的超时时间
 func Get(url string, timeout int64) (result string, err error) {
+	return GetContext(context.Background(), url, timeout)
+}
+
+// GetContext 函数与 Get 相同, ctx 被取消时请求随之中断
+func GetContext(ctx context.Context, url string, timeout int64) (result string, err error) {
 	// 创建一个 HTTP 客户端实例
 	var client = &http.Client{}
 	// 使用 "GET" 方法和指定的 URL 创建一个新的 HTTP 请求对象
 	// 第三个参数时请求体
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return
 	}
@@ -92,12 +98,17 @@ func PostParams(url string, params string, timeout int64) (result string, err er
 }
 
 func PostJson(url string, body string, timeout int64) (result string, err error) {
+	return PostJsonContext(context.Background(), url, body, timeout)
+}
+
+// PostJsonContext 函数与 PostJson 相同, ctx 被取消时请求随之中断
+func PostJsonContext(ctx context.Context, url string, body string, timeout int64) (result string, err error) {
 	// 创建一个新的 http.Client 实例
 	var client = &http.Client{}
 	// 将输入的 JSON 字符串 `body` 转换成一个 `io.Reader`
 	buf := bytes.NewBufferString(body)
 	// 使用 "POST" 方法, URL, 和请求体(buf)创建一个新的 HTTP 请求对象
-	req, err := http.NewRequest("POST", url, buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, buf)
 	if err != nil {
 		return
 	}
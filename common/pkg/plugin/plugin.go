@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion 是当前的插件协议版本
+const ProtocolVersion = 1
+
+// ValidateTimeout 是校验任务参数时等待插件响应的时间
+const ValidateTimeout = 10 * time.Second
+
+// 插件需要执行的动作
+const (
+	ActionRun      = "run"      // 执行任务
+	ActionValidate = "validate" // 校验任务参数, 不执行任务
+)
+
+// Request 是写入插件标准输入的请求
+type Request struct {
+	Protocol int             `json:"protocol"`       // 协议版本
+	Action   string          `json:"action"`         // 需要执行的动作
+	Job      json.RawMessage `json:"job"`            // 任务定义, 与保存在 etcd 中的 JSON 相同
+	Node     string          `json:"node,omitempty"` // 执行任务的节点UUID, 校验时为空
+}
+
+// Response 是插件写入标准输出的响应, 标准输出中只能有这一个 JSON 对象
+// 插件自己的日志应当写入标准错误, 节点会将其追加到任务的输出中
+type Response struct {
+	Success bool   `json:"success"` // 是否执行成功或校验通过
+	Output  string `json:"output"`  // 任务的输出
+	Error   string `json:"error"`   // 失败原因
+}
+
+// NewRequest 构造一个请求, job 会被编码为 JSON
+func NewRequest(action string, job interface{}, node string) ([]byte, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Request{Protocol: ProtocolVersion, Action: action, Job: data, Node: node})
+}
+
+// ParseResponse 解析插件的标准输出
+func ParseResponse(stdout []byte) (*Response, error) {
+	stdout = bytes.TrimSpace(stdout)
+	if len(stdout) == 0 {
+		return nil, fmt.Errorf("plugin writes no response to stdout")
+	}
+	resp := new(Response)
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	if err := dec.Decode(resp); err != nil {
+		return nil, fmt.Errorf("decode plugin response: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("plugin writes more than one response to stdout")
+	}
+	return resp, nil
+}
+
+// Err 返回响应表示的错误, 执行成功时返回 nil
+func (r *Response) Err() error {
+	if r.Success {
+		return nil
+	}
+	if r.Error == "" {
+		return fmt.Errorf("plugin reports failure without error")
+	}
+	return fmt.Errorf("%s", r.Error)
+}
+
+// Call 执行插件并等待响应, 插件的退出码不为 0 且没有响应时返回包含标准错误的错误
+func Call(ctx context.Context, path string, args []string, req []byte) (*Response, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	resp, err := ParseResponse(stdout.Bytes())
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("run plugin %s: %w: %s", path, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Validate 调用插件校验任务参数, 返回插件给出的错误
+func Validate(path string, args []string, job interface{}) error {
+	req, err := NewRequest(ActionValidate, job, "")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ValidateTimeout)
+	defer cancel()
+	resp, err := Call(ctx, path, args, req)
+	if err != nil {
+		return err
+	}
+	return resp.Err()
+}
@@ -0,0 +1,401 @@
+package schedule
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakecoffman/cron"
+)
+
+// SpecError 是定时表达式的解析错误, 指出出错的位置和字段
+type SpecError struct {
+	Spec  string // 定时表达式
+	Pos   int    // 出错位置在表达式中的字节偏移, 从 0 开始
+	Field string // 出错的字段, 描述符出错时为空
+	Msg   string // 错误原因
+}
+
+func (e *SpecError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid spec %q at column %d: %s", e.Spec, e.Pos+1, e.Msg)
+	}
+	return fmt.Sprintf("invalid spec %q at column %d (%s): %s", e.Spec, e.Pos+1, e.Field, e.Msg)
+}
+
+// Unwrap 使 errors.Is(err, errors.ErrIllegalSpec) 成立
+func (e *SpecError) Unwrap() error { return errors.ErrIllegalSpec }
+
+// field 描述定时表达式中一个字段的取值范围
+type field struct {
+	name     string
+	min, max uint
+	names    map[string]uint // 可以使用的名称, 例如 JAN、MON
+}
+
+var (
+	secondField = field{name: "second", min: 0, max: 59}
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 星期的 0 和 7 都表示周日
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors 是预定义的描述符对应的 6 段表达式
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// starBit 表示字段为 * 或 ?, 用于决定日期和星期的组合方式
+const starBit = 1 << 63
+
+// SpecSchedule 是解析后的定时表达式, 每个字段是取值的位图
+type SpecSchedule struct {
+	Second, Minute, Hour, Dom, Month, Dow uint64
+}
+
+// ParseSpec 解析定时表达式, 支持以下格式:
+//  1. 6 段: 秒 分 时 日 月 星期
+//  2. 描述符: @yearly、@annually、@monthly、@weekly、@daily、@midnight、@hourly 和 @every <时长>
+//  3. 5 段: 秒 分 时 日 月, 星期不限, 与之前使用的 cron.Parse 相同, 保证已经保存的任务按原来的时刻调度
+//
+// 每个字段支持 *、?(仅日期和星期)、列表 1,2、范围 1-5、步长 */5 和 10/5, 月份和星期可以使用英文缩写
+// 解析失败时返回 *SpecError; 校验新的表达式使用 CheckSpec, 它不接受有歧义的 5 段表达式
+func ParseSpec(spec string) (cron.Schedule, error) {
+	start := len(spec) - len(strings.TrimLeft(spec, " \t"))
+	trimmed := strings.TrimSpace(spec)
+	if trimmed == "" {
+		return nil, &SpecError{Spec: spec, Pos: len(spec), Msg: "spec is empty"}
+	}
+	if trimmed[0] == '@' {
+		return parseDescriptor(spec, start, trimmed)
+	}
+
+	var (
+		fields  []string
+		offsets []int
+	)
+	for i := 0; i < len(spec); {
+		if spec[i] == ' ' || spec[i] == '\t' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(spec) && spec[j] != ' ' && spec[j] != '\t' {
+			j++
+		}
+		fields, offsets = append(fields, spec[i:j]), append(offsets, i)
+		i = j
+	}
+	var layout []field
+	switch len(fields) {
+	case 5:
+		layout = []field{secondField, minuteField, hourField, domField, monthField}
+	case 6:
+		layout = []field{secondField, minuteField, hourField, domField, monthField, dowField}
+	default:
+		pos := len(spec)
+		if len(fields) > 6 {
+			pos = offsets[6]
+		}
+		return nil, &SpecError{Spec: spec, Pos: pos, Msg: fmt.Sprintf("expected 5 or 6 fields, found %d", len(fields))}
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, f := range layout {
+		b, err := parseField(spec, fields[i], offsets[i], f)
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	if len(bits) == 5 {
+		// 与 cron.Parse 相同, 缺少的星期字段按 * 处理
+		dow, _ := parseField(spec, "*", len(spec), dowField)
+		bits = append(bits, dow)
+	}
+	s := &SpecSchedule{Second: bits[0], Minute: bits[1], Hour: bits[2], Dom: bits[3], Month: bits[4], Dow: bits[5]}
+	// 星期 7 与 0 相同, 都表示周日
+	if s.Dow&(1<<7) > 0 {
+		s.Dow = s.Dow&^(1<<7) | 1<<0
+	}
+	return s, nil
+}
+
+// LegacySpec 判断 spec 是否为 5 段表达式, 是时返回按之前的读法(秒 分 时 日 月)等价的 6 段表达式
+func LegacySpec(spec string) (string, bool) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 || strings.HasPrefix(fields[0], "@") {
+		return spec, false
+	}
+	return strings.Join(fields, " ") + " *", true
+}
+
+// CheckSpec 校验新保存的定时表达式并返回解析后的调度
+// 5 段表达式在标准 crontab 中是 分 时 日 月 星期, 在之前的版本中是 秒 分 时 日 月, 有歧义, 要求改用 6 段表达式
+func CheckSpec(spec string) (cron.Schedule, error) {
+	if legacy, ok := LegacySpec(spec); ok {
+		return nil, &SpecError{
+			Spec: spec,
+			Pos:  len(spec) - len(strings.TrimLeft(spec, " \t")),
+			Msg: fmt.Sprintf(`5-field specs are ambiguous, use 6 fields "sec min hour dom month dow": `+
+				`%q as crontab "min hour dom month dow", or %q as the legacy "sec min hour dom month"`,
+				"0 "+strings.Join(strings.Fields(spec), " "), legacy),
+		}
+	}
+	return ParseSpec(spec)
+}
+
+// parseDescriptor 解析以 @ 开头的描述符, start 为描述符在 spec 中的偏移
+func parseDescriptor(spec string, start int, descriptor string) (cron.Schedule, error) {
+	if expr, ok := descriptors[strings.ToLower(descriptor)]; ok {
+		return ParseSpec(expr)
+	}
+	const every = "@every"
+	if !strings.HasPrefix(strings.ToLower(descriptor), every) {
+		return nil, &SpecError{Spec: spec, Pos: start, Msg: fmt.Sprintf("unknown descriptor %q", strings.Fields(descriptor)[0])}
+	}
+	rest := descriptor[len(every):]
+	arg := strings.TrimSpace(rest)
+	pos := start + len(every) + len(rest) - len(strings.TrimLeft(rest, " \t"))
+	if arg == "" || len(rest) == len(strings.TrimLeft(rest, " \t")) {
+		return nil, &SpecError{Spec: spec, Pos: pos, Msg: "@every requires a duration such as @every 5m"}
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return nil, &SpecError{Spec: spec, Pos: pos, Msg: fmt.Sprintf("invalid duration %q", arg)}
+	}
+	if d < time.Second {
+		return nil, &SpecError{Spec: spec, Pos: pos, Msg: fmt.Sprintf("duration %s is less than 1s", arg)}
+	}
+	return cron.Every(d), nil
+}
+
+// parseField 解析一个字段, offset 为字段在 spec 中的偏移
+func parseField(spec, expr string, offset int, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := parseRange(spec, part, offset, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+		offset += len(part) + 1
+	}
+	return bits, nil
+}
+
+// parseRange 解析字段中以逗号分隔的一项: *、?、N、N-M, 以及它们带 /步长 的形式
+func parseRange(spec, part string, offset int, f field) (uint64, error) {
+	fail := func(pos int, format string, args ...interface{}) error {
+		return &SpecError{Spec: spec, Pos: pos, Field: f.name, Msg: fmt.Sprintf(format, args...)}
+	}
+	if part == "" {
+		return 0, fail(offset, "empty value")
+	}
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	var (
+		start, end uint
+		extra      uint64
+	)
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		if rangePart == "?" && f.name != domField.name && f.name != dowField.name {
+			return 0, fail(offset, "? is only allowed in day of month and day of week")
+		}
+		start, end, extra = f.min, f.max, starBit
+		if f.name == dowField.name {
+			end = 6
+		}
+	default:
+		low, high, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if start, err = parseValue(low, f); err != nil {
+			return 0, fail(offset, "%s", err.Error())
+		}
+		end = start
+		if isRange {
+			if end, err = parseValue(high, f); err != nil {
+				return 0, fail(offset+len(low)+1, "%s", err.Error())
+			}
+			if end < start {
+				return 0, fail(offset, "range %s is reversed", rangePart)
+			}
+		} else if hasStep {
+			// N/step 表示从 N 到最大值每隔 step 取一次
+			end = f.max
+			if f.name == dowField.name {
+				end = 6
+			}
+		}
+	}
+	step := uint(1)
+	if hasStep {
+		pos := offset + len(rangePart) + 1
+		n, err := strconv.ParseUint(stepPart, 10, 32)
+		if err != nil || n == 0 {
+			return 0, fail(pos, "step %q must be a positive number", stepPart)
+		}
+		if uint(n) > f.max-f.min+1 {
+			return 0, fail(pos, "step %d is larger than the range of %s", n, f.name)
+		}
+		step = uint(n)
+		extra = 0
+	}
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+// parseValue 解析一个数值或名称, 并检查取值范围
+func parseValue(s string, f field) (uint, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if uint(n) < f.min || uint(n) > f.max {
+		return 0, fmt.Errorf("%d is out of range [%d, %d]", n, f.min, f.max)
+	}
+	return uint(n), nil
+}
+
+// Next 返回 t 之后的下一次触发时间, 5 年内没有满足的时刻时返回零值
+// 按 t 所在时区的墙上时间计算, 需要按任务时区触发时使用 InZone 包装
+func (s *SpecSchedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	loc := t.Location()
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for 1<<uint(t.Month())&s.Month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Hour())&s.Hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Minute())&s.Minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Second())&s.Second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+	return t
+}
+
+// dayMatches 判断日期是否满足表达式
+// 与 crontab 相同: 日期和星期都有限制时满足其一即可, 其中一个为 * 或 ? 时两者都要满足
+func (s *SpecSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.Dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.Dow > 0
+	if s.Dom&starBit > 0 || s.Dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// LoadLocation 加载 IANA 时区, 为空时返回本地时区
+// time.LoadLocation 把 "Local" 解释为本地时区, 各节点的本地时区可能不同, 这里只接受 IANA 名称
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("%q is not an IANA time zone name", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// MaxNextRuns 是 NextRuns 一次最多返回的触发时间数
+const MaxNextRuns = 100
+
+// NextRuns 返回定时表达式在时区 tz 中从现在开始的后 n 次触发时间, tz 为空时使用本地时区
+// 夏令时跳过的调度时刻按 dst_gap 的默认值 run_once 处理
+func NextRuns(spec, tz string, n int) ([]time.Time, error) {
+	return nextRuns(spec, tz, n, time.Now())
+}
+
+// nextRuns 返回 from 之后的后 n 次触发时间
+func nextRuns(spec, tz string, n int, from time.Time) ([]time.Time, error) {
+	if n <= 0 || n > MaxNextRuns {
+		return nil, fmt.Errorf("%w: n must be in [1, %d]", errors.ErrIllegalSpec, MaxNextRuns)
+	}
+	loc, err := LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errors.ErrIllegalTimeZone, err.Error())
+	}
+	s, err := CheckSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	s = InZone(s, loc, false)
+	runs := make([]time.Time, 0, n)
+	for t := from; len(runs) < n; {
+		if t = s.Next(t); t.IsZero() {
+			break
+		}
+		runs = append(runs, t.In(loc))
+	}
+	return runs, nil
+}
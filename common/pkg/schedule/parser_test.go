@@ -0,0 +1,124 @@
+package schedule
+
+import (
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	// 2024-06-07 是周五
+	from := utc("2024-06-07T10:00:00Z")
+	cases := []struct {
+		spec   string
+		expect []string
+	}{
+		{"0 0 9 * * 1-5", []string{"2024-06-10T09:00:00Z", "2024-06-11T09:00:00Z"}},
+		{"30 0 9 * * MON-FRI", []string{"2024-06-10T09:00:30Z", "2024-06-11T09:00:30Z"}},
+		{"0 */20 10 * * *", []string{"2024-06-07T10:20:00Z", "2024-06-07T10:40:00Z", "2024-06-08T10:00:00Z"}},
+		{"0 0 0 1,15 * *", []string{"2024-06-15T00:00:00Z", "2024-07-01T00:00:00Z"}},
+		// 日期和星期都有限制时满足其一即可
+		{"0 0 0 13 * 5", []string{"2024-06-13T00:00:00Z", "2024-06-14T00:00:00Z", "2024-06-21T00:00:00Z"}},
+		{"0 0 0 * * 7", []string{"2024-06-09T00:00:00Z"}},
+		{"0 0 12 29 feb ?", []string{"2028-02-29T12:00:00Z"}},
+		{"@daily", []string{"2024-06-08T00:00:00Z"}},
+		{"@weekly", []string{"2024-06-09T00:00:00Z"}},
+		{"@every 90m", []string{"2024-06-07T11:30:00Z", "2024-06-07T13:00:00Z"}},
+	}
+	for _, c := range cases {
+		runs, err := nextRuns(c.spec, "UTC", len(c.expect), from)
+		if err != nil {
+			t.Errorf("spec %q: %v", c.spec, err)
+			continue
+		}
+		for i, e := range c.expect {
+			if !runs[i].Equal(utc(e)) {
+				t.Errorf("spec %q run %d: %s, expect %s", c.spec, i, runs[i].Format(time.RFC3339), e)
+			}
+		}
+	}
+
+	runs, err := nextRuns("0 0 9 * * *", "Asia/Tokyo", 1, from)
+	if err != nil || runs[0].Format(time.RFC3339) != "2024-06-08T09:00:00+09:00" {
+		t.Fatalf("runs %v err %v", runs, err)
+	}
+	if _, err = nextRuns("0 0 9 * * *", "Local", 1, from); !errors.Is(err, cronyErrors.ErrIllegalTimeZone) {
+		t.Fatalf("expect ErrIllegalTimeZone, got %v", err)
+	}
+}
+
+func TestParseSpecError(t *testing.T) {
+	cases := []struct {
+		spec  string
+		pos   int
+		field string
+	}{
+		{"0 0 9 * 13 1-5", 8, "month"},
+		{"0 0 9 * * 1-8", 12, "day of week"},
+		{"0 0 25 * * *", 4, "hour"},
+		{"60 0 9 * * *", 0, "second"},
+		{"0 0 9 * * 5-1", 10, "day of week"},
+		{"0 */0 * * * *", 4, "minute"},
+		{"0 0 9 1,,2 * *", 8, "day of month"},
+		{"0 ? 9 * * *", 2, "minute"},
+		{"0 9 * *", 7, ""},
+		{"0 0 9 * * * *", 12, ""},
+		{"  @every 5x", 9, ""},
+		{"@every 100ms", 7, ""},
+		{"@fortnightly", 0, ""},
+		{"", 0, ""},
+	}
+	for _, c := range cases {
+		_, err := ParseSpec(c.spec)
+		var specErr *SpecError
+		if !errors.As(err, &specErr) || !errors.Is(err, cronyErrors.ErrIllegalSpec) {
+			t.Errorf("spec %q: expect SpecError, got %v", c.spec, err)
+			continue
+		}
+		if specErr.Pos != c.pos || specErr.Field != c.field {
+			t.Errorf("spec %q: error at %d (%s), expect %d (%s): %v", c.spec, specErr.Pos, specErr.Field, c.pos, c.field, err)
+		}
+	}
+}
+
+func TestLegacySpec(t *testing.T) {
+	// 5 段表达式按之前的 cron.Parse 读作 秒 分 时 日 月, 已经保存的任务调度时刻不变
+	from := utc("2024-06-07T10:00:00Z")
+	s, err := ParseSpec("0 9 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1-5 月每小时的第 9 分钟
+	if next := s.Next(from); !next.Equal(utc("2025-01-01T00:09:00Z")) {
+		t.Fatalf("legacy spec next run %s", next.Format(time.RFC3339))
+	}
+	legacy, ok := LegacySpec(" 0 9 * * 1-5 ")
+	if !ok || legacy != "0 9 * * 1-5 *" {
+		t.Fatalf("legacy spec %q %v", legacy, ok)
+	}
+	l, _ := ParseSpec(legacy)
+	for i, t1, t2 := 0, from, from; i < 100; i++ {
+		if t1, t2 = s.Next(t1), l.Next(t2); !t1.Equal(t2) {
+			t.Fatalf("rewritten spec runs at %s, legacy spec at %s", t2, t1)
+		}
+	}
+	for _, spec := range []string{"0 0 9 * * 1-5", "@every 5m", "@daily", "0 9 * *"} {
+		if _, ok = LegacySpec(spec); ok {
+			t.Errorf("spec %q is not a 5-field spec", spec)
+		}
+	}
+
+	// 新保存的表达式不接受 5 段表达式, 即使按两种读法都合法
+	for _, spec := range []string{"0 9 * * 1-5", "0 9 * * MON"} {
+		if _, err = CheckSpec(spec); !errors.Is(err, cronyErrors.ErrIllegalSpec) {
+			t.Errorf("spec %q: expect ambiguous spec error, got %v", spec, err)
+		}
+		if _, err = nextRuns(spec, "UTC", 1, from); !errors.Is(err, cronyErrors.ErrIllegalSpec) {
+			t.Errorf("spec %q: expect ambiguous spec error from next runs, got %v", spec, err)
+		}
+	}
+	if _, err = CheckSpec("0 0 9 * * 1-5"); err != nil {
+		t.Fatal(err)
+	}
+}
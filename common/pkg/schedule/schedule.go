@@ -0,0 +1,167 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jakecoffman/cron"
+)
+
+// maxSearch 是计算下一次触发时间时最多尝试的调度时刻数, 防止无法满足的表达式导致死循环
+const maxSearch = 1 << 16
+
+// Parse 解析定时表达式, 返回在时区 loc 中按墙上时间触发的调度
+// skipGap 为 true 时跳过落在夏令时跳过时间段中的调度时刻, 否则在跳变后的第一个时刻执行一次
+// 表达式的格式见 ParseSpec, 解析失败时返回 *SpecError
+func Parse(spec string, loc *time.Location, skipGap bool) (cron.Schedule, error) {
+	s, err := ParseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return InZone(s, loc, skipGap), nil
+}
+
+// InZone 让调度 s 在时区 loc 中按墙上时间触发
+// @every 这类固定间隔的调度与时区无关, 原样返回
+func InZone(s cron.Schedule, loc *time.Location, skipGap bool) cron.Schedule {
+	if _, ok := s.(cron.ConstantDelaySchedule); ok {
+		return s
+	}
+	return &zonedSchedule{inner: s, loc: loc, skipGap: skipGap}
+}
+
+// zonedSchedule 在没有夏令时的 UTC 中计算墙上时间, 再把墙上时间转换为 loc 中的时刻
+// 这样调度的结果不受节点本地时区影响, 夏令时前后的行为也是确定的:
+//  1. 墙上时间不存在(夏令时开始)时, skipGap 为 true 则跳过, 否则在跳变的时刻执行一次
+//  2. 墙上时间出现两次(夏令时结束)时, 只在第一次出现时执行
+type zonedSchedule struct {
+	inner   cron.Schedule
+	loc     *time.Location
+	skipGap bool
+}
+
+// Next 返回 t 之后的下一次触发时间, 没有时返回零值
+func (s *zonedSchedule) Next(t time.Time) time.Time {
+	w := wallClock(t.In(s.loc))
+	for i := 0; i < maxSearch; i++ {
+		w = s.inner.Next(w)
+		if w.IsZero() {
+			return w
+		}
+		next, ok := toInstant(w, s.loc)
+		if !ok && s.skipGap {
+			continue
+		}
+		// 重复出现的时间段中, 已经过去的第一次出现不再补执行
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// wallClock 把 t 的墙上时间表示为 UTC 中的同一个日期和时刻
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// toInstant 把以 UTC 表示的墙上时间 w 转换为 loc 中的时刻
+// 墙上时间出现两次时返回较早的一次; 不存在时返回跳变的时刻, ok 为 false
+func toInstant(w time.Time, loc *time.Location) (time.Time, bool) {
+	wu := w.Unix()
+	before, after := offsetAt(wu-26*3600, loc), offsetAt(wu+26*3600, loc)
+	var (
+		best  int64
+		found bool
+	)
+	for _, off := range []int64{before, after, offsetAt(wu, loc)} {
+		u := wu - off
+		if offsetAt(u, loc) == off && (!found || u < best) {
+			best, found = u, true
+		}
+	}
+	if found {
+		return time.Unix(best, int64(w.Nanosecond())).In(loc), true
+	}
+	// 跳变发生在 (wu-after, wu-before] 之间, 二分查找偏移量变为 after 的第一秒
+	lo, hi := wu-after, wu-before
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if offsetAt(mid, loc) == after {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return time.Unix(hi, 0).In(loc), false
+}
+
+// offsetAt 返回时刻 u 在 loc 中相对 UTC 的偏移秒数
+func offsetAt(u int64, loc *time.Location) int64 {
+	_, off := time.Unix(u, 0).In(loc).Zone()
+	return int64(off)
+}
+
+// lookback 是创建顺延调度时向前查找的时长, 节点在节假日期间重启时, 此前被跳过的调度仍会顺延执行
+const lookback = 14 * 24 * time.Hour
+
+// Shift 在调度 s 的基础上, 额外在每个调度时刻经 shift 顺延后的时刻触发
+// 原调度时刻仍然触发, 由任务在执行时判断是否跳过; 多个调度时刻顺延到同一时刻时只触发一次
+func Shift(s cron.Schedule, shift func(time.Time) time.Time) cron.Schedule {
+	return &shiftedSchedule{inner: s, shift: shift}
+}
+
+// shiftedSchedule 记录已经计算出但尚未到达的顺延时刻
+type shiftedSchedule struct {
+	inner   cron.Schedule
+	shift   func(time.Time) time.Time
+	mu      sync.Mutex
+	started bool
+	pending []time.Time
+}
+
+// Next 返回 t 之后原调度时刻与顺延时刻中最早的一个
+func (s *shiftedSchedule) Next(t time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.started = true
+		f := t.Add(-lookback)
+		for i := 0; i < maxSearch; i++ {
+			if f = s.inner.Next(f); f.IsZero() || f.After(t) {
+				break
+			}
+			s.addPending(f)
+		}
+	}
+	next := s.inner.Next(t)
+	if !next.IsZero() {
+		s.addPending(next)
+	}
+	kept := s.pending[:0]
+	for _, p := range s.pending {
+		if !p.After(t) {
+			continue
+		}
+		kept = append(kept, p)
+		if next.IsZero() || p.Before(next) {
+			next = p
+		}
+	}
+	s.pending = kept
+	return next
+}
+
+// addPending 记录调度时刻 f 顺延后的时刻
+func (s *shiftedSchedule) addPending(f time.Time) {
+	p := s.shift(f)
+	if !p.After(f) {
+		return
+	}
+	for _, q := range s.pending {
+		if q.Equal(p) {
+			return
+		}
+	}
+	s.pending = append(s.pending, p)
+}
@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jakecoffman/cron"
+)
+
+// minutes 是测试用的调度, 在墙上时间的时和分满足条件时触发
+type minutes func(hour, min int) bool
+
+func (m minutes) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < 7*24*60; i++ {
+		if m(t.Hour(), t.Minute()) {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+func dailyAt(hour, min int) minutes {
+	return func(h, m int) bool { return h == hour && m == min }
+}
+
+func every15(_, m int) bool { return m%15 == 0 }
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestZonedSchedule(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	cases := []struct {
+		name    string
+		s       cron.Schedule
+		from    string
+		expect  []string
+		comment string
+	}{
+		{"new york", InZone(dailyAt(9, 0), newYork, false), "2024-01-10T12:00:00Z",
+			[]string{"2024-01-10T14:00:00Z", "2024-01-11T14:00:00Z"}, "09:00 EST"},
+		{"gap run once", InZone(dailyAt(2, 30), berlin, false), "2024-03-30T12:00:00Z",
+			[]string{"2024-03-31T01:00:00Z", "2024-04-01T00:30:00Z"}, "02:30 does not exist on 03-31, run at 03:00 CEST"},
+		{"gap skip", InZone(dailyAt(2, 30), berlin, true), "2024-03-30T12:00:00Z",
+			[]string{"2024-04-01T00:30:00Z"}, "02:30 does not exist on 03-31, skip it"},
+		{"gap collapses", InZone(minutes(every15), berlin, false), "2024-03-31T00:50:00Z",
+			[]string{"2024-03-31T01:00:00Z", "2024-03-31T01:15:00Z"}, "02:00-02:45 run once at 03:00 CEST"},
+		{"overlap", InZone(dailyAt(2, 30), berlin, false), "2024-10-26T12:00:00Z",
+			[]string{"2024-10-27T00:30:00Z", "2024-10-28T01:30:00Z"}, "02:30 occurs twice on 10-27, run at the first one"},
+		{"overlap second pass", InZone(minutes(every15), berlin, false), "2024-10-27T01:10:00Z",
+			[]string{"2024-10-27T02:00:00Z"}, "02:15-02:45 CET already ran in CEST"},
+	}
+	for _, c := range cases {
+		next := utc(c.from)
+		for _, e := range c.expect {
+			next = c.s.Next(next)
+			if !next.Equal(utc(e)) {
+				t.Errorf("%s (%s): next is %s, expect %s", c.name, c.comment, next.UTC().Format(time.RFC3339), e)
+				break
+			}
+		}
+	}
+
+	every := cron.Every(time.Hour)
+	if s := InZone(every, berlin, false); s != every {
+		t.Fatalf("constant delay schedule should not be zoned, got %#v", s)
+	}
+}
+
+func TestShiftedSchedule(t *testing.T) {
+	// 周末的调度顺延到周一的同一时刻
+	toMonday := func(f time.Time) time.Time {
+		for f.Weekday() == time.Saturday || f.Weekday() == time.Sunday {
+			f = f.AddDate(0, 0, 1)
+		}
+		return f
+	}
+	// 每月 1 日 09:00, 2024-06-01 是周六
+	monthly := minutes(func(h, m int) bool { return h == 9 && m == 0 })
+	first := func(f time.Time) bool { return f.Day() == 1 }
+	s := Shift(filter{monthly, first}, toMonday)
+	next := utc("2024-05-20T00:00:00Z")
+	for _, e := range []string{"2024-06-01T09:00:00Z", "2024-06-03T09:00:00Z", "2024-07-01T09:00:00Z"} {
+		if next = s.Next(next); !next.Equal(utc(e)) {
+			t.Fatalf("next is %s, expect %s", next.Format(time.RFC3339), e)
+		}
+	}
+
+	// 每天的调度: 周六和周日顺延后与周一本身的调度重合, 只触发一次
+	daily := Shift(dailyAt(9, 0), toMonday)
+	next = utc("2024-06-07T10:00:00Z")
+	for _, e := range []string{"2024-06-08T09:00:00Z", "2024-06-09T09:00:00Z", "2024-06-10T09:00:00Z", "2024-06-11T09:00:00Z"} {
+		if next = daily.Next(next); !next.Equal(utc(e)) {
+			t.Fatalf("next is %s, expect %s", next.Format(time.RFC3339), e)
+		}
+	}
+
+	// 节点在周日启动时, 周六被跳过的调度仍会顺延
+	s = Shift(filter{monthly, first}, toMonday)
+	if next = s.Next(utc("2024-06-02T12:00:00Z")); !next.Equal(utc("2024-06-03T09:00:00Z")) {
+		t.Fatalf("next is %s after restart", next.Format(time.RFC3339))
+	}
+}
+
+// filter 只保留满足条件的调度时刻
+type filter struct {
+	s  cron.Schedule
+	ok func(time.Time) bool
+}
+
+func (f filter) Next(t time.Time) time.Time {
+	for i := 0; i < 1000; i++ {
+		if t = f.s.Next(t); t.IsZero() || f.ok(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/notify"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Init 是各个服务进程共用的启动流程
+// 按顺序加载配置, 并初始化日志、MySQL、etcd 和通知组件, 最后注册插件任务类型
+// serverName: 服务名称, 同时也是配置目录和日志目录所在的文件夹
+// configFileName: 不含扩展名的配置文件名
+func Init(serverName, configFileName string) (*models.Config, error) {
+	// 1. 读取全局环境变量, 决定加载哪一个环境的配置
+	env, err := config.NewGlobalEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	// 2. 加载配置文件
+	conf, err := config.LoadConfig(env.String(), serverName, configFileName)
+	if err != nil {
+		return nil, err
+	}
+	// 3. 初始化日志
+	logger.Init(serverName, conf.Log.Level, conf.Log.Format, conf.Log.Prefix, conf.Log.Director, conf.Log.ShowLine, conf.Log.EncodeLevel, conf.Log.StacktraceKey, conf.Log.LogInConsole)
+	// 4. 初始化 MySQL
+	if _, err = dbclient.Init(conf.Mysql.Dsn(), conf.Mysql.LogMode, conf.Mysql.MaxIdleConns, conf.Mysql.MaxOpenConns); err != nil {
+		return nil, fmt.Errorf("init mysql err: %s", err.Error())
+	}
+	// 5. 初始化 etcd
+	if _, err = etcdclient.Init(conf.Etcd.Endpoints, conf.Etcd.DialTimeout, conf.Etcd.ReqTimeout); err != nil {
+		return nil, fmt.Errorf("init etcd err: %s", err.Error())
+	}
+	// 6. 初始化通知组件, 并在后台消费通知队列
+	notify.Init(&notify.Mail{
+		Port:     conf.Email.Port,
+		From:     conf.Email.From,
+		Host:     conf.Email.Host,
+		Secret:   conf.Email.Secret,
+		Nickname: conf.Email.Nickname,
+	}, &notify.WebHook{
+		Kind: conf.WebHook.Kind,
+		Url:  conf.WebHook.Url,
+	})
+	go notify.Serve()
+	// 7. 注册配置中的插件任务类型, admin 和节点校验任务时都需要知道这些类型
+	if err = models.RegisterPlugins(conf.Plugins); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// WaitForSignal 阻塞当前 goroutine, 直到进程收到退出信号
+func WaitForSignal() os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	return <-ch
+}
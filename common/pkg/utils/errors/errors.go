@@ -10,13 +10,50 @@ var (
 
 	ErrNotFound = errors.New("Record not found.")
 
-	ErrEmptyJobName        = errors.New("Name of job is empty.")
-	ErrEmptyJobCommand     = errors.New("Command of job is empty.")
-	ErrIllegalJobId        = errors.New("Invalid id that includes illegal characters such as '/' '\\'.")
-	ErrIllegalJobGroupName = errors.New("Invalid job group name that includes illegal characters such as '/' '\\'.")
+	ErrEmptyJobName         = errors.New("Name of job is empty.")
+	ErrEmptyJobCommand      = errors.New("Command of job is empty.")
+	ErrIllegalConcurrency   = errors.New("Unknown concurrency policy of job.")
+	ErrJobKilled            = errors.New("Job is killed.")
+	ErrUnknownJobType       = errors.New("Unknown type of job.")
+	ErrUnknownInterpreter   = errors.New("Unknown interpreter of shell job.")
+	ErrIllegalEnv           = errors.New("Invalid environment variables of job.")
+	ErrIllegalUmask         = errors.New("Invalid umask of job, it must be an octal number like 022.")
+	ErrIllegalResourceLimit = errors.New("Invalid resource limits of job.")
+	ErrRunAsNotPermitted    = errors.New("Node is not privileged to run the job as the given user or group.")
+	ErrIllegalContainerSpec = errors.New("Invalid container spec of job.")
+	ErrIllegalSQLSpec       = errors.New("Invalid sql spec of job.")
+	ErrIllegalGRPCSpec      = errors.New("Invalid grpc spec of job.")
+	ErrIllegalPluginParams  = errors.New("Invalid params of plugin job.")
+	ErrIllegalPlugin        = errors.New("Invalid plugin config.")
+	ErrIllegalJobHook       = errors.New("Invalid hook of job.")
+	ErrIllegalRetryPolicy   = errors.New("Invalid retry policy of job.")
+	ErrIllegalTimeZone      = errors.New("Invalid time zone of job.")
+	ErrIllegalSpec          = errors.New("Invalid spec of job.")
+	ErrIllegalMisfire       = errors.New("Invalid misfire policy of job.")
+	ErrIllegalJobCalendar   = errors.New("Invalid calendar rule of job.")
+	ErrIllegalHttpSpec      = errors.New("Invalid http spec of job.")
+	ErrIllegalOnceTarget    = errors.New("Target of once execution must be \"any\" or node uuids.")
+	ErrIllegalJobId         = errors.New("Invalid id that includes illegal characters such as '/' '\\'.")
+	ErrIllegalJobGroupName  = errors.New("Invalid job group name that includes illegal characters such as '/' '\\'.")
 
 	ErrEmptyScriptName    = errors.New("Name of script is empty.")
 	ErrEmptyScriptCommand = errors.New("Command of script is empty.")
 	ErrEmptyNodeGroupName = errors.New("Name of node group is empty.")
+	ErrEmptyCalendarName  = errors.New("Name of calendar is empty.")
+	ErrIllegalCalendar    = errors.New("Invalid calendar.")
+	ErrCalendarInUse      = errors.New("Calendar is still used by jobs.")
+	ErrEmptyWorkflowName  = errors.New("Name of workflow is empty.")
+	ErrIllegalWorkflow    = errors.New("Invalid workflow.")
+	ErrJobInWorkflow      = errors.New("Job is still used by workflows.")
+	ErrWorkflowRunning    = errors.New("Workflow run is still running.")
 	ErrIllegalNodeGroupId = errors.New("Invalid node group id that includes illegal characters such as '/'.")
+
+	ErrNodeNotFound    = errors.New("Node not found.")
+	ErrNodeIsAlive     = errors.New("Node is still alive.")
+	ErrEmptyUserName   = errors.New("Name of user is empty.")
+	ErrEmptyPassword   = errors.New("Password of user is empty.")
+	ErrUserNameExisted = errors.New("Name of user already exists.")
+
+	ErrNoAvailableNode      = errors.New("No available node to allocate the job.")
+	ErrUnknownAllocStrategy = errors.New("Unknown allocation strategy.")
 )
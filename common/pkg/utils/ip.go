@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"errors"
+	"net"
+)
+
+// LocalIP 返回本机第一个非回环的 IPv4 地址
+func LocalIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		// 只关心 IP 网段类型的地址, 并跳过回环地址
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		// 只返回 IPv4 地址
+		if ip := ipNet.IP.To4(); ip != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", errors.New("no available local ipv4 address")
+}
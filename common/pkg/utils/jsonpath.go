@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath 是解析后的 JSONPath 表达式, 支持 $、.key、['key'] 和 [index] 这几种写法
+// 例如: $.data.items[0].name 或 $['data']['status']
+type JSONPath struct {
+	expr  string
+	steps []interface{} // string 表示对象的 key, int 表示数组下标
+}
+
+// ParseJSONPath 解析 JSONPath 表达式
+func ParseJSONPath(expr string) (*JSONPath, error) {
+	p := &JSONPath{expr: expr}
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with '$'", expr)
+	}
+	s = s[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonpath %q has an empty key", expr)
+			}
+			p.steps = append(p.steps, s[:end])
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q has an unclosed '['", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.steps = append(p.steps, inner[1:len(inner)-1])
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("jsonpath %q has an invalid index [%s]", expr, inner)
+			}
+			p.steps = append(p.steps, index)
+		default:
+			return nil, fmt.Errorf("jsonpath %q has an unexpected character %q", expr, s[0])
+		}
+	}
+	return p, nil
+}
+
+// Lookup 在 json.Unmarshal 得到的数据中查找表达式对应的值, 不存在时 ok 为 false
+func (p *JSONPath) Lookup(data interface{}) (value interface{}, ok bool) {
+	value = data
+	for _, step := range p.steps {
+		switch key := step.(type) {
+		case string:
+			m, isMap := value.(map[string]interface{})
+			if !isMap {
+				return nil, false
+			}
+			if value, ok = m[key]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, isArr := value.([]interface{})
+			if !isArr || key >= len(arr) {
+				return nil, false
+			}
+			value = arr[key]
+		}
+	}
+	return value, true
+}
+
+// String 返回原始表达式
+func (p *JSONPath) String() string {
+	return p.expr
+}
@@ -0,0 +1,14 @@
+package utils
+
+import "unicode/utf8"
+
+// Truncate 把 s 截断到不超过 n 字节, 不会截断在多字节字符的中间
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s      string
+		n      int
+		expect string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc"},
+		// "中" 占 3 个字节, 不截断在字符中间
+		{"a中文", 2, "a"},
+		{"a中文", 4, "a中"},
+	}
+	for _, c := range cases {
+		if got := Truncate(c.s, c.n); got != c.expect {
+			t.Fatalf("Truncate(%q, %d) = %q, expect %q", c.s, c.n, got, c.expect)
+		}
+	}
+}
@@ -11,7 +11,13 @@ const (
 	TimeFormatDateV4 = "2006/01/02 - 15:04:05.000"
 )
 
+// GetTodayUnix 返回本地时区今天零点的时间戳
 func GetTodayUnix() int64 {
-	currentTime := time.Now()
-	return time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), 0, 0, 0, 0, currentTime.Location()).Unix()
+	return GetTodayUnixIn(time.Local)
+}
+
+// GetTodayUnixIn 返回时区 loc 中今天零点的时间戳
+func GetTodayUnixIn(loc *time.Location) int64 {
+	currentTime := time.Now().In(loc)
+	return time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), 0, 0, 0, 0, loc).Unix()
 }
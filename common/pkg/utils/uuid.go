@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LoadOrCreateUUID 从指定文件读取 UUID, 文件不存在时生成一个新的 UUID 并写入该文件
+// 节点依靠它在重启后保持同一个身份, 从而继续认领 etcd 中分配给自己的任务
+func LoadOrCreateUUID(path string) (string, error) {
+	if Exists(path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		// 文件内容合法时直接复用
+		if id, err := uuid.Parse(strings.TrimSpace(string(data))); err == nil {
+			return id.String(), nil
+		}
+	}
+	id := uuid.New().String()
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crony/common/pkg/logger"
+	"crony/common/pkg/server"
+	"crony/node/internal/handler"
+	"crony/node/internal/service"
+	"fmt"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// ServerName 是节点服务的名称, 配置文件位于 node/conf/<env>/ 下
+const ServerName = "node"
+
+// 命令行参数
+var opts struct {
+	ConfigFile string `short:"c" long:"config" default:"main" description:"配置文件名(不含扩展名)"`
+}
+
+func main() {
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+	// 加载配置并初始化各个基础组件
+	conf, err := server.Init(ServerName, opts.ConfigFile)
+	if err != nil {
+		fmt.Printf("init %s server err: %s\n", ServerName, err.Error())
+		os.Exit(1)
+	}
+	defer logger.Shutdown()
+	// 为配置中的插件任务类型注册处理器
+	handler.RegisterPlugins(conf.Plugins)
+
+	nodeServer, err := service.NewNodeServer()
+	if err != nil {
+		logger.GetLogger().Error(fmt.Sprintf("new node server err: %s", err.Error()))
+		os.Exit(1)
+	}
+	// 注册节点
+	if err = nodeServer.Register(); err != nil {
+		logger.GetLogger().Error(fmt.Sprintf("register %s err: %s", nodeServer.String(), err.Error()))
+		os.Exit(1)
+	}
+	// 加载任务并开始调度
+	if err = nodeServer.Run(); err != nil {
+		logger.GetLogger().Error(fmt.Sprintf("run %s err: %s", nodeServer.String(), err.Error()))
+		nodeServer.Stop()
+		os.Exit(1)
+	}
+	logger.GetLogger().Info(fmt.Sprintf("%s started", nodeServer.String()))
+
+	// 等待退出信号
+	sig := server.WaitForSignal()
+	logger.GetLogger().Info(fmt.Sprintf("%s received signal %s, stopping", nodeServer.String(), sig.String()))
+	nodeServer.Stop()
+}
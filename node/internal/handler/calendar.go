@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/utils"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// maxShiftDays 是顺延到下一个工作日时最多查找的天数
+const maxShiftDays = 366
+
+// calendars 是节点已加载的日历, key 为日历ID
+// 由 service 包在启动时加载, 并随 /crony/calendar/ 的变化更新
+var calendars = struct {
+	sync.RWMutex
+	m map[int]*models.Calendar
+}{m: make(map[int]*models.Calendar)}
+
+// LoadCalendars 从 etcd 中读取全部日历, 替换已加载的日历, 返回读取时 etcd 的版本号
+// 无效的日历记录日志后跳过, 引用它的任务按日历不存在跳过调度, 不影响节点启动和其他任务
+func LoadCalendars() (int64, error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdCalendarProfile, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	m := make(map[int]*models.Calendar, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		c, err := parseCalendar(kv.Value)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("calendar[%s] is invalid: %s", string(kv.Key), err.Error()))
+			continue
+		}
+		m[c.ID] = c
+	}
+	calendars.Lock()
+	calendars.m = m
+	calendars.Unlock()
+	return resp.Header.Revision, nil
+}
+
+// WatchCalendars 从版本号 rev 之后监听 /crony/calendar/ 下日历的变化, rev 为 0 时从当前版本开始
+func WatchCalendars(rev int64) clientv3.WatchChan {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	return etcdclient.Watch(etcdclient.KeyEtcdCalendarProfile, opts...)
+}
+
+// PutCalendar 解析 etcd 中的日历并保存, 返回日历ID
+func PutCalendar(value []byte) (int, error) {
+	c, err := parseCalendar(value)
+	if err != nil {
+		return 0, err
+	}
+	calendars.Lock()
+	calendars.m[c.ID] = c
+	calendars.Unlock()
+	return c.ID, nil
+}
+
+// parseCalendar 解析并校验 etcd 中的日历
+func parseCalendar(value []byte) (*models.Calendar, error) {
+	c := new(models.Calendar)
+	if err := json.Unmarshal(value, c); err != nil {
+		return nil, err
+	}
+	if err := c.Check(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DeleteCalendar 删除已加载的日历
+func DeleteCalendar(id int) {
+	calendars.Lock()
+	delete(calendars.m, id)
+	calendars.Unlock()
+}
+
+// getCalendar 返回已加载的日历
+func getCalendar(id int) (*models.Calendar, bool) {
+	calendars.RLock()
+	defer calendars.RUnlock()
+	c, ok := calendars.m[id]
+	return c, ok
+}
+
+// UsesCalendar 判断任务是否引用了日历
+func (j *Job) UsesCalendar(id int) bool {
+	for _, r := range j.Calendars {
+		if r.CalendarID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// HasShift 判断任务是否有顺延到下一个工作日的规则
+func (j *Job) HasShift() bool {
+	for _, r := range j.Calendars {
+		if r.Rule == models.CalendarNextBusinessDay {
+			return true
+		}
+	}
+	return false
+}
+
+// location 返回任务的时区, 任务已经通过校验, 时区不会非法
+func (j *Job) location() *time.Location {
+	loc, err := j.Location()
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// ShiftFire 返回调度时刻 fire 顺延后的时刻: 按任务时区的同一墙上时间逐日推迟,
+// 直到对全部 next_business_day 规则引用的日历都是工作日; 不需要顺延或找不到工作日时返回 fire
+func (j *Job) ShiftFire(fire time.Time) time.Time {
+	loc := j.location()
+	t := fire.In(loc)
+	for i := 0; i <= maxShiftDays; i++ {
+		business := true
+		for _, r := range j.Calendars {
+			if r.Rule != models.CalendarNextBusinessDay {
+				continue
+			}
+			c, ok := getCalendar(r.CalendarID)
+			if !ok {
+				return fire
+			}
+			if !c.IsBusinessDay(c.In(t, loc)) {
+				business = false
+				break
+			}
+		}
+		if business {
+			return t
+		}
+		t = t.AddDate(0, 0, 1)
+	}
+	return fire
+}
+
+// checkCalendars 按任务引用的日历判断调度时刻 fire 是否执行, 需要跳过时返回跳过原因
+// 引用的日历不存在时同样跳过, 宁可不执行也不在节假日执行
+func (j *Job) checkCalendars(fire time.Time) string {
+	loc := j.location()
+	for _, r := range j.Calendars {
+		c, ok := getCalendar(r.CalendarID)
+		if !ok {
+			return fmt.Sprintf("skipped: calendar#%d of job#%d is not found", r.CalendarID, j.ID)
+		}
+		t := c.In(fire, loc)
+		switch r.Rule {
+		case models.CalendarSkipHoliday:
+			if name, holiday := c.Holiday(t); holiday {
+				return fmt.Sprintf("skipped: %s is holiday %q in calendar %s", t.Format(utils.TimeFormatDateV1), name, c.Name)
+			}
+		case models.CalendarNextBusinessDay:
+			if !c.IsBusinessDay(t) {
+				shifted := j.ShiftFire(fire)
+				if !shifted.After(fire) {
+					return fmt.Sprintf("skipped: %s is not a business day in calendar %s, no business day within %d days",
+						t.Format(utils.TimeFormatDateV1), c.Name, maxShiftDays)
+				}
+				return fmt.Sprintf("skipped: %s is not a business day in calendar %s, shifted to %s",
+					t.Format(utils.TimeFormatDateV1), c.Name, shifted.Format(utils.TimeFormatSecond+" MST"))
+			}
+		case models.CalendarSkipBlackout:
+			if b, in := c.Blackout(t); in {
+				return fmt.Sprintf("skipped: %s is in blackout [%s, %s) %s of calendar %s",
+					t.Format(utils.TimeFormatMinute), b.Start, b.End, b.Note, c.Name)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useCalendars 替换节点已加载的日历
+func useCalendars(t *testing.T, values ...string) {
+	t.Helper()
+	calendars.Lock()
+	old := calendars.m
+	calendars.m = make(map[int]*models.Calendar)
+	calendars.Unlock()
+	t.Cleanup(func() {
+		calendars.Lock()
+		calendars.m = old
+		calendars.Unlock()
+	})
+	for _, v := range values {
+		if _, err := PutCalendar([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckCalendars(t *testing.T) {
+	useCalendars(t,
+		`{"id": 1, "name": "bank", "time_zone": "America/New_York", "holidays": [{"date": "2024-12-25", "name": "Christmas"}]}`,
+		`{"id": 2, "name": "ops", "blackouts": [{"start": "2024-12-20 22:00", "end": "2024-12-21 02:00", "note": "db upgrade"}]}`,
+	)
+	job := &Job{Job: &models.Job{ID: 1, TimeZone: "Asia/Shanghai", Calendars: []models.JobCalendar{
+		{CalendarID: 1, Rule: models.CalendarNextBusinessDay},
+		{CalendarID: 2, Rule: models.CalendarSkipBlackout},
+	}}}
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	cases := []struct {
+		fire   time.Time
+		expect string
+	}{
+		// 上海 12-26 09:00 是纽约 12-25 20:00
+		{time.Date(2024, 12, 26, 9, 0, 0, 0, shanghai), "2024-12-25 is not a business day in calendar bank, shifted to 2024-12-27 09:00:00 CST"},
+		// 纽约的周六, 顺延到周一
+		{time.Date(2024, 12, 29, 9, 0, 0, 0, shanghai), "2024-12-28 is not a business day in calendar bank, shifted to 2024-12-31 09:00:00 CST"},
+		{time.Date(2024, 12, 20, 23, 30, 0, 0, shanghai), "2024-12-20 23:30 is in blackout [2024-12-20 22:00, 2024-12-21 02:00) db upgrade of calendar ops"},
+		{time.Date(2024, 12, 21, 2, 0, 0, 0, shanghai), ""},
+	}
+	for _, c := range cases {
+		reason := job.checkCalendars(c.fire)
+		if c.expect == "" && reason != "" || c.expect != "" && reason != "skipped: "+c.expect {
+			t.Errorf("fire at %s: reason %q, expect %q", c.fire, reason, c.expect)
+		}
+	}
+
+	job.Calendars = []models.JobCalendar{{CalendarID: 1, Rule: models.CalendarSkipHoliday}}
+	if reason := job.checkCalendars(time.Date(2024, 12, 26, 9, 0, 0, 0, shanghai)); !strings.Contains(reason, `holiday "Christmas"`) {
+		t.Fatalf("reason is %q", reason)
+	}
+	if reason := job.checkCalendars(time.Date(2024, 12, 29, 9, 0, 0, 0, shanghai)); reason != "" {
+		t.Fatalf("skip_holiday should not skip weekends, reason %q", reason)
+	}
+	job.Calendars = []models.JobCalendar{{CalendarID: 3, Rule: models.CalendarSkipHoliday}}
+	if reason := job.checkCalendars(time.Now()); !strings.Contains(reason, "calendar#3 of job#1 is not found") {
+		t.Fatalf("reason is %q", reason)
+	}
+}
+
+func TestCalendarCheck(t *testing.T) {
+	invalid := []*models.Calendar{
+		{Name: "a", TimeZone: "Nowhere/City"},
+		{Name: "a", Holidays: []models.Holiday{{Date: "2024-02-30"}}},
+		{Name: "a", BusinessDays: []int{7}},
+		{Name: "a", Blackouts: []models.Blackout{{Start: "2024-01-02 10:00", End: "2024-01-02 09:00"}}},
+		{Name: "a", Blackouts: []models.Blackout{{Start: "2024-01-02", End: "2024-01-03"}}},
+	}
+	for _, c := range invalid {
+		if err := c.Check(); !errors.Is(err, cronyErrors.ErrIllegalCalendar) {
+			t.Errorf("calendar %+v: expect ErrIllegalCalendar, got %v", c, err)
+		}
+	}
+	if err := (&models.Calendar{Name: " "}).Check(); err != cronyErrors.ErrEmptyCalendarName {
+		t.Fatalf("expect ErrEmptyCalendarName, got %v", err)
+	}
+	job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, Calendars: []models.JobCalendar{{CalendarID: 1, Rule: "weekends"}}}
+	if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalJobCalendar) {
+		t.Fatalf("expect ErrIllegalJobCalendar, got %v", err)
+	}
+}
+
+func TestWatchCalendarsFromRev(t *testing.T) {
+	startEmbedEtcd(t)
+	rev, err := LoadCalendars()
+	if err != nil || rev == 0 {
+		t.Fatalf("rev %d err %v", rev, err)
+	}
+	if _, err = etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdCalendar, 1), `{"id":1,"name":"c"}`); err != nil {
+		t.Fatal(err)
+	}
+	cch := WatchCalendars(rev)
+	select {
+	case wresp := <-cch:
+		if len(wresp.Events) != 1 {
+			t.Fatalf("events %v", wresp.Events)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("calendar written after rev is not watched")
+	}
+}
+
+func TestLoadCalendarsSkipInvalid(t *testing.T) {
+	startEmbedEtcd(t)
+	if _, err := etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdCalendar, 1), `{"id":1,"name":"c"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdCalendar, 2), `{"id":2,"name":""}`); err != nil {
+		t.Fatal(err)
+	}
+	// 一个无效的日历不影响其他日历的加载
+	if _, err := LoadCalendars(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getCalendar(1); !ok {
+		t.Fatal("valid calendar is not loaded")
+	}
+	if _, ok := getCalendar(2); ok {
+		t.Fatal("invalid calendar is loaded")
+	}
+}
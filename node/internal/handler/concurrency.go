@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// ReplaceWaitTimeout 是 Replace 策略下等待上一次执行退出的最长时间
+const ReplaceWaitTimeout = time.Minute
+
+// ConcurrencyLockTtl 是并发策略锁的租约时长(秒)
+// 持有期间持续续约, 持有锁的节点崩溃后锁在租约到期后释放
+const ConcurrencyLockTtl = 10
+
+// concurrencyLockKey 返回任务并发策略锁的名称
+func concurrencyLockKey(jobId int) string {
+	return fmt.Sprintf("concurrency-%d", jobId)
+}
+
+// applyConcurrency 按任务的并发策略处理上一次尚未结束的执行
+// reason 不为空表示本次调度需要跳过; 否则在本次调度结束(包括全部重试)后需要调用 release
+// 检查进程记录和登记本次调度的进程记录之间持有集群内的并发策略锁, 多个节点同时调度时只有一个节点能通过检查:
+// Forbid 和 Replace 在 holdProc 登记覆盖整次调度的进程记录后释放锁, Queue 持有锁直到本次调度结束
+// ctx 在本次调度被终止(Replace 策略下被新的调度替换)时取消, 之后不再重试
+func (j *Job) applyConcurrency() (ctx context.Context, release func(), reason string) {
+	ctx, release = context.Background(), func() {}
+	switch j.Concurrency {
+	case models.ConcurrencyForbid:
+		unlock, ok, err := lockConcurrency(context.Background(), j.ID, false)
+		if err != nil {
+			return ctx, release, fmt.Sprintf("skipped: get concurrency lock of job#%d err: %s", j.ID, err.Error())
+		}
+		if !ok {
+			return ctx, release, fmt.Sprintf("skipped: job#%d is starting on another node", j.ID)
+		}
+		defer unlock()
+		procs, _, err := GetJobProcs(j.ID)
+		if err != nil {
+			return ctx, release, fmt.Sprintf("skipped: get procs of job#%d err: %s", j.ID, err.Error())
+		}
+		if len(procs) > 0 {
+			return ctx, release, fmt.Sprintf("skipped: job#%d is still running on node[%s] pid[%d]", j.ID, procs[0].NodeUUID, procs[0].ID)
+		}
+		return j.holdProc()
+	case models.ConcurrencyQueue:
+		// 持有锁的执行结束后才轮到下一个, 再等待不受并发策略约束的执行(如立即执行)结束
+		unlock, _, err := lockConcurrency(context.Background(), j.ID, true)
+		if err != nil {
+			return ctx, release, fmt.Sprintf("skipped: get concurrency lock of job#%d err: %s", j.ID, err.Error())
+		}
+		if err = WaitJobProcs(context.Background(), j.ID); err != nil {
+			unlock()
+			return ctx, release, fmt.Sprintf("skipped: wait procs of job#%d err: %s", j.ID, err.Error())
+		}
+		return ctx, unlock, ""
+	case models.ConcurrencyReplace:
+		wctx, cancel := context.WithTimeout(context.Background(), ReplaceWaitTimeout)
+		defer cancel()
+		unlock, _, err := lockConcurrency(wctx, j.ID, true)
+		if err != nil {
+			return ctx, release, fmt.Sprintf("skipped: get concurrency lock of job#%d err: %s", j.ID, err.Error())
+		}
+		defer unlock()
+		procs, _, err := GetJobProcs(j.ID)
+		if err != nil {
+			return ctx, release, fmt.Sprintf("skipped: get procs of job#%d err: %s", j.ID, err.Error())
+		}
+		for _, proc := range procs {
+			if err = proc.Kill(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("kill proc[%s] err: %s", proc.Key(), err.Error()))
+			}
+		}
+		if len(procs) > 0 {
+			if err = WaitJobProcs(wctx, j.ID); err != nil {
+				return ctx, release, fmt.Sprintf("skipped: wait killed procs of job#%d err: %s", j.ID, err.Error())
+			}
+		}
+		return j.holdProc()
+	}
+	return
+}
+
+// holdProc 登记一条覆盖本次调度全部尝试(包括重试之间的等待)的虚拟进程记录, release 时删除
+// 每次尝试自己的进程记录在尝试结束时就删除了, 这条记录让重试等待期间的其他调度仍能看到本次调度尚未结束;
+// 记录被终止时取消 ctx, 本次调度不再重试
+func (j *Job) holdProc() (ctx context.Context, release func(), reason string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	proc := &JobProc{
+		JobProc: &models.JobProc{
+			ID:       nextVirtualProcId(),
+			JobID:    j.ID,
+			NodeUUID: j.RunOn,
+			JobProcVal: models.JobProcVal{
+				Time: time.Now(),
+			},
+		},
+	}
+	rc := &runningCmd{done: make(chan struct{})}
+	rc.setStop(func(time.Duration) error {
+		cancel()
+		return nil
+	})
+	runningCmds.Store(proc.ID, rc)
+	if err := proc.Start(); err != nil {
+		runningCmds.Delete(proc.ID)
+		cancel()
+		return ctx, func() {}, fmt.Sprintf("skipped: register proc of job#%d err: %s", j.ID, err.Error())
+	}
+	return ctx, func() {
+		proc.Stop()
+		close(rc.done)
+		runningCmds.Delete(proc.ID)
+		cancel()
+	}, ""
+}
+
+// lockConcurrency 获取任务的并发策略锁, unlock 可以重复调用
+// wait 为 false 时锁已被持有则立即返回 ok 为 false; 否则等待锁被释放, 直到 ctx 结束
+func lockConcurrency(ctx context.Context, jobId int, wait bool) (unlock func(), ok bool, err error) {
+	name := concurrencyLockKey(jobId)
+	for {
+		lease, err := etcdclient.Grant(ConcurrencyLockTtl)
+		if err != nil {
+			return nil, false, err
+		}
+		ok, err = etcdclient.GetLock(name, lease.ID)
+		if err == nil && ok {
+			kctx, cancel := context.WithCancel(context.Background())
+			ch, err := etcdclient.GetEtcdClient().KeepAlive(kctx, lease.ID)
+			if err != nil {
+				cancel()
+				_, _ = etcdclient.Revoke(lease.ID)
+				return nil, false, err
+			}
+			go func() {
+				for range ch {
+				}
+			}()
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					cancel()
+					// 撤销租约后锁的 key 随之删除
+					if _, err := etcdclient.Revoke(lease.ID); err != nil {
+						logger.GetLogger().Warn(fmt.Sprintf("release concurrency lock of job#%d err: %s", jobId, err.Error()))
+					}
+				})
+			}, true, nil
+		}
+		_, _ = etcdclient.Revoke(lease.ID)
+		if err != nil || !wait {
+			return nil, false, err
+		}
+		if err = waitLockRelease(ctx, name); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// waitLockRelease 等待名为 name 的锁被释放, 锁不存在时立即返回
+func waitLockRelease(ctx context.Context, name string) error {
+	key := fmt.Sprintf(etcdclient.KeyEtcdLock, name)
+	resp, err := etcdclient.Get(key)
+	if err != nil {
+		return err
+	}
+	if resp.Count == 0 {
+		return nil
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rch := etcdclient.GetEtcdClient().Watch(wctx, key, clientv3.WithRev(resp.Header.Revision+1), clientv3.WithFilterPut())
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case wresp, ok := <-rch:
+			if !ok {
+				return ctx.Err()
+			}
+			if err = wresp.Err(); err != nil {
+				return err
+			}
+			if len(wresp.Events) > 0 {
+				return nil
+			}
+		}
+	}
+}
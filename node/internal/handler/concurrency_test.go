@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// startEmbedEtcd 启动一个本地嵌入式 etcd, 并用它初始化默认客户端和节点配置
+func startEmbedEtcd(t *testing.T) {
+	dir := t.TempDir()
+	logger.Init(dir, "error", "console", "", "logs", false, "", "", false)
+	if config.GetConfigModels() == nil {
+		if _, err := config.LoadConfig("testing", "../..", "main"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return url.URL{Scheme: "http", Host: l.Addr().String()}
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = dir + "/etcd"
+	clientURL, peerURL := freeURL(), freeURL()
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("embedded etcd is not ready")
+	}
+	cli, err := etcdclient.Init([]string{clientURL.Host}, 5, 5)
+	if err != nil {
+		e.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cli.Close()
+		e.Close()
+	})
+}
+
+// raceFires 模拟 n 个节点在同一时刻调度同一个任务, 返回实际执行的次数和同时执行的最大数量
+func raceFires(t *testing.T, job *Job, n int, hold time.Duration) (ran, maxActive int32) {
+	var (
+		wg     sync.WaitGroup
+		active int32
+		start  = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(node int) {
+			defer wg.Done()
+			<-start
+			_, release, reason := job.applyConcurrency()
+			if reason != "" {
+				return
+			}
+			defer release()
+			proc := &JobProc{JobProc: &models.JobProc{
+				ID:         nextVirtualProcId(),
+				JobID:      job.ID,
+				NodeUUID:   fmt.Sprintf("node-%d", node),
+				JobProcVal: models.JobProcVal{Time: time.Now()},
+			}}
+			if err := proc.Start(); err != nil {
+				t.Error(err)
+				return
+			}
+			defer proc.Stop()
+			atomic.AddInt32(&ran, 1)
+			cur := atomic.AddInt32(&active, 1)
+			for {
+				old := atomic.LoadInt32(&maxActive)
+				if cur <= old || atomic.CompareAndSwapInt32(&maxActive, old, cur) {
+					break
+				}
+			}
+			time.Sleep(hold)
+			atomic.AddInt32(&active, -1)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return
+}
+
+func TestConcurrencyForbidRace(t *testing.T) {
+	startEmbedEtcd(t)
+	job := &Job{Job: &models.Job{ID: 1, Concurrency: models.ConcurrencyForbid}}
+	for round := 0; round < 5; round++ {
+		if ran, _ := raceFires(t, job, 4, 200*time.Millisecond); ran != 1 {
+			t.Fatalf("round %d: forbid job ran %d times at the same tick, expect 1", round, ran)
+		}
+	}
+}
+
+func TestConcurrencyQueueRace(t *testing.T) {
+	startEmbedEtcd(t)
+	job := &Job{Job: &models.Job{ID: 2, Concurrency: models.ConcurrencyQueue}}
+	ran, maxActive := raceFires(t, job, 3, 100*time.Millisecond)
+	if ran != 3 || maxActive != 1 {
+		t.Fatalf("queue job ran %d times with %d at the same time, expect 3 and 1", ran, maxActive)
+	}
+}
+
+func TestConcurrencyHoldThroughRetries(t *testing.T) {
+	startEmbedEtcd(t)
+	job := &Job{Job: &models.Job{ID: 3, Concurrency: models.ConcurrencyForbid}}
+	ctx, release, reason := job.applyConcurrency()
+	if reason != "" {
+		t.Fatal(reason)
+	}
+	// 重试等待期间没有尝试的进程记录, 其他调度仍然被拒绝
+	if _, _, reason = job.applyConcurrency(); reason == "" {
+		t.Fatal("forbid job fired again while the last fire is waiting to retry")
+	}
+
+	// 模拟节点的 watchProcs: 进程记录被标记为终止时结束对应的执行
+	rch := WatchProc(job.RunOn)
+	go func() {
+		for wresp := range rch {
+			for _, ev := range wresp.Events {
+				proc, err := GetProcFromKey(string(ev.Kv.Key))
+				if err != nil || json.Unmarshal(ev.Kv.Value, &proc.JobProcVal) != nil || !proc.Killed {
+					continue
+				}
+				_ = KillCmd(proc.ID)
+			}
+		}
+	}()
+	// Replace 终止上一次调度的记录后, 上一次调度的 ctx 被取消, 不再重试
+	job.Concurrency = models.ConcurrencyReplace
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+		release()
+	}()
+	_, release2, reason := job.applyConcurrency()
+	if reason != "" {
+		t.Fatal(reason)
+	}
+	defer release2()
+	if !<-cancelled {
+		t.Fatal("replaced fire is not cancelled")
+	}
+}
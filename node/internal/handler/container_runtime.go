@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultContainerRuntime 是未配置 System.ContainerRuntime 时使用的运行时命令行
+const DefaultContainerRuntime = "docker"
+
+// ContainerOptions 是创建容器的参数, 与具体的运行时无关
+type ContainerOptions struct {
+	Name    string                  // 容器名称
+	Image   string                  // 镜像
+	Command []string                // 容器内执行的命令, 为空时使用镜像的默认命令
+	Env     []string                // 环境变量, 格式为 KEY=VALUE
+	Mounts  []models.ContainerMount // 挂载到容器内的宿主机目录
+	WorkDir string                  // 容器内的工作目录
+	User    string                  // 执行用户, 格式为 user 或 user:group
+	Labels  map[string]string       // 容器标签, 用于识别节点创建的容器
+	Pull    string                  // 镜像拉取策略
+	Network string                  // 网络模式
+
+	CpuQuota  int   // CPU 配额, 单位为一个核的百分比
+	MemoryMax int64 // 内存上限, 单位 MB
+	PidsMax   int   // 进程数上限
+	IoWeight  int   // IO 权重, 取值 1-10000
+}
+
+// ContainerRuntime 是容器运行时的抽象, 节点通过它创建、运行和清理容器
+type ContainerRuntime interface {
+	// Create 创建容器但不启动, 返回容器ID
+	Create(ctx context.Context, opts *ContainerOptions) (string, error)
+	// Start 启动容器
+	Start(ctx context.Context, id string) error
+	// Logs 持续将容器的标准输出和标准错误写入 w, 直到容器退出或 ctx 被取消
+	Logs(ctx context.Context, id string, w io.Writer) error
+	// Wait 等待容器退出, 返回退出码
+	Wait(ctx context.Context, id string) (int, error)
+	// Stop 停止容器, 先发送 SIGTERM, 超过 grace 后强制结束
+	Stop(ctx context.Context, id string, grace time.Duration) error
+	// Remove 强制删除容器
+	Remove(ctx context.Context, id string) error
+}
+
+// newContainerRuntime 返回节点使用的容器运行时, 测试时可以替换为假的实现
+var newContainerRuntime = func() ContainerRuntime {
+	bin := DefaultContainerRuntime
+	if c := config.GetConfigModels(); c != nil && c.System.ContainerRuntime != "" {
+		bin = c.System.ContainerRuntime
+	}
+	return &CLIRuntime{Bin: bin}
+}
+
+// CLIRuntime 通过 docker 兼容的命令行(docker、podman、nerdctl)操作容器
+type CLIRuntime struct {
+	Bin string // 命令行的可执行文件
+}
+
+// Create 执行 `<bin> create`, 其标准输出为容器ID
+func (r *CLIRuntime) Create(ctx context.Context, opts *ContainerOptions) (string, error) {
+	out, err := r.output(ctx, createArgs(opts)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Start 执行 `<bin> start`
+func (r *CLIRuntime) Start(ctx context.Context, id string) error {
+	_, err := r.output(ctx, "start", id)
+	return err
+}
+
+// Logs 执行 `<bin> logs -f`
+func (r *CLIRuntime) Logs(ctx context.Context, id string, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, r.Bin, "logs", "-f", id)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// Wait 执行 `<bin> wait`, 其标准输出为容器的退出码
+func (r *CLIRuntime) Wait(ctx context.Context, id string) (int, error) {
+	out, err := r.output(ctx, "wait", id)
+	if err != nil {
+		return -1, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return -1, fmt.Errorf("unexpected exit code %q of container %s", strings.TrimSpace(out), id)
+	}
+	return code, nil
+}
+
+// Stop 执行 `<bin> stop -t`
+func (r *CLIRuntime) Stop(ctx context.Context, id string, grace time.Duration) error {
+	_, err := r.output(ctx, "stop", "-t", strconv.Itoa(int(grace.Seconds())), id)
+	return err
+}
+
+// Remove 执行 `<bin> rm -f`
+func (r *CLIRuntime) Remove(ctx context.Context, id string) error {
+	_, err := r.output(ctx, "rm", "-f", id)
+	return err
+}
+
+// output 执行命令行并返回标准输出, 失败时错误中带上标准错误的内容
+func (r *CLIRuntime) output(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.Bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("%s %s: %w: %s", r.Bin, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// createArgs 返回 `create` 子命令的参数
+func createArgs(opts *ContainerOptions) []string {
+	args := []string{"create", "--name", opts.Name}
+	keys := make([]string, 0, len(opts.Labels))
+	for k := range opts.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+opts.Labels[k])
+	}
+	if opts.Pull != "" {
+		args = append(args, "--pull", opts.Pull)
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+	for _, kv := range opts.Env {
+		args = append(args, "-e", kv)
+	}
+	for _, m := range opts.Mounts {
+		v := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			v += ":ro"
+		}
+		args = append(args, "-v", v)
+	}
+	if opts.WorkDir != "" {
+		args = append(args, "-w", opts.WorkDir)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.CpuQuota > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(float64(opts.CpuQuota)/100, 'f', -1, 64))
+	}
+	if opts.MemoryMax > 0 {
+		args = append(args, "--memory", strconv.FormatInt(opts.MemoryMax, 10)+"m")
+	}
+	if opts.PidsMax > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(opts.PidsMax))
+	}
+	if opts.IoWeight > 0 {
+		// blkio-weight 的取值范围是 10-1000, 按比例换算 io.weight 的 1-10000
+		weight := opts.IoWeight / 10
+		if weight < 10 {
+			weight = 10
+		}
+		args = append(args, "--blkio-weight", strconv.Itoa(weight))
+	}
+	args = append(args, opts.Image)
+	return append(args, opts.Command...)
+}
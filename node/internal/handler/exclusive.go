@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/utils"
+	"fmt"
+	"time"
+)
+
+// ExclusiveLockTtl 是独占锁的租约时长(秒)
+// 锁的 key 中已经包含了调度时刻, 这里只需覆盖各节点时钟偏差和调度延迟即可, 不需要主动释放
+const ExclusiveLockTtl = 30
+
+// exclusiveLockKey 返回任务在某个调度时刻的锁名称
+func exclusiveLockKey(jobId int, fireTime time.Time) string {
+	return fmt.Sprintf("job-%d-%d", jobId, fireTime.Unix())
+}
+
+// TryExclusive 尝试获取任务在 fireTime 这一调度时刻的执行权
+// 同一个任务被复制到多个节点时, 每个调度时刻只有一个节点能拿到锁
+func (j *Job) TryExclusive(fireTime time.Time) (bool, error) {
+	lease, err := etcdclient.Grant(ExclusiveLockTtl)
+	if err != nil {
+		return false, err
+	}
+	ok, err := etcdclient.GetLock(exclusiveLockKey(j.ID, fireTime), lease.ID)
+	if err != nil || !ok {
+		// 没有拿到锁时租约已经没有用处, 直接撤销
+		_, _ = etcdclient.Revoke(lease.ID)
+	}
+	return ok, err
+}
+
+// Skip 为本次未执行的调度写入一条跳过记录, catchUp 表示被跳过的是否为补执行
+func (j *Job) Skip(fireTime time.Time, catchUp bool, reason string) error {
+	jobLog := &models.JobLog{
+		Name:      j.Name,
+		JobId:     j.ID,
+		Command:   j.Command,
+		IP:        j.Ip,
+		Hostname:  j.Hostname,
+		NodeUUID:  j.RunOn,
+		Spec:      j.Spec,
+		TimeZone:  j.ZoneName(),
+		Status:    models.JobLogStatusSkipped,
+		Output:    utils.Truncate(reason, models.JobLogOutputSize),
+		FireTime:  fireTime.Unix(),
+		CatchUp:   catchUp,
+		StartTime: fireTime.Unix(),
+		EndTime:   time.Now().Unix(),
+	}
+	_, err := jobLog.Insert()
+	return err
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// credential 是任务的执行身份
+type credential struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32 // 附加用户组
+	user   *user.User
+}
+
+// lookupCredential 根据任务的 RunAsUser 和 RunAsGroup 查找执行身份, 未设置时返回 nil
+func lookupCredential(job *Job) (*credential, error) {
+	if job.RunAsUser == "" && job.RunAsGroup == "" {
+		return nil, nil
+	}
+	var (
+		u   *user.User
+		err error
+	)
+	if job.RunAsUser != "" {
+		u, err = lookupUser(job.RunAsUser)
+	} else {
+		u, err = user.Current()
+	}
+	if err != nil {
+		return nil, err
+	}
+	cred := &credential{user: u}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %s of user %s", u.Uid, u.Username)
+	}
+	cred.uid = uint32(uid)
+
+	gidStr := u.Gid
+	if job.RunAsGroup != "" {
+		g, err := lookupGroup(job.RunAsGroup)
+		if err != nil {
+			return nil, err
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.ParseUint(gidStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %s", gidStr)
+	}
+	cred.gid = uint32(gid)
+
+	// 只有用户组未被显式指定时才带上用户的附加组
+	if job.RunAsGroup == "" {
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+					cred.groups = append(cred.groups, uint32(g))
+				}
+			}
+		}
+	}
+	return cred, nil
+}
+
+// lookupUser 按用户名或 uid 查找用户
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+// lookupGroup 按组名或 gid 查找用户组
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// checkPrivilege 检查节点是否有权限以 cred 的身份执行任务
+// 非 root 进程只能以自身的 uid 和 gid 执行
+func (cred *credential) checkPrivilege() error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	if int(cred.uid) != os.Geteuid() || int(cred.gid) != os.Getegid() {
+		return fmt.Errorf("%w: node runs as uid %d gid %d, job requires uid %d gid %d",
+			errors.ErrRunAsNotPermitted, os.Geteuid(), os.Getegid(), cred.uid, cred.gid)
+	}
+	return nil
+}
+
+// dedicated 判断任务是否以专用用户执行, 即显式指定了既不是 root 也不是节点自身的执行用户
+// 按用户统计的限制(例如 RLIMIT_NPROC)只有在专用用户下才不会受到其他进程的影响
+func (cred *credential) dedicated() bool {
+	if cred == nil || cred.user == nil || cred.uid == 0 {
+		return false
+	}
+	return int(cred.uid) != os.Geteuid()
+}
+
+// wrapUmask 在设置了 umask 时通过 /bin/sh 设置 umask 后再 exec 原命令
+// umask 是进程级别的属性, 不能只对子进程设置
+func wrapUmask(job *Job, name string, args []string) (string, []string, error) {
+	umask, err := job.ParseUmask()
+	if err != nil || umask < 0 {
+		return name, args, err
+	}
+	wrapped := []string{"-c", fmt.Sprintf(`umask %04o && exec "$0" "$@"`, umask), name}
+	return "/bin/sh", append(wrapped, args...), nil
+}
+
+// buildEnv 根据任务的环境变量模式返回子进程的环境变量
+// 以其他用户执行时, 未显式指定的 HOME、USER、LOGNAME 会被设置为该用户的值
+func buildEnv(job *Job, cred *credential) []string {
+	env := make([]string, 0)
+	if job.EnvMode == models.EnvInherit {
+		env = append(env, os.Environ()...)
+	}
+	if cred != nil && job.RunAsUser != "" {
+		env = append(env, "HOME="+cred.user.HomeDir, "USER="+cred.user.Username, "LOGNAME="+cred.user.Username)
+	}
+	// 后出现的同名变量覆盖前面的值
+	return dedupEnv(append(env, job.EnvList...))
+}
+
+// dedupEnv 去掉重复的环境变量, 保留最后一次出现的值
+func dedupEnv(env []string) []string {
+	index := make(map[string]int, len(env))
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		key := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			key = kv[:i]
+		}
+		if i, ok := index[key]; ok {
+			out[i] = kv
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, kv)
+	}
+	return out
+}
+
+// applyExecOptions 将任务的执行身份、工作目录和环境变量设置到命令上
+func applyExecOptions(cmd *exec.Cmd, job *Job, cred *credential) error {
+	if job.WorkDir != "" {
+		info, err := os.Stat(job.WorkDir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("work dir %s is not a directory", job.WorkDir)
+		}
+		cmd.Dir = job.WorkDir
+	}
+	cmd.Env = buildEnv(job, cred)
+	if cred == nil {
+		return nil
+	}
+	if err := cred.checkPrivilege(); err != nil {
+		return err
+	}
+	return setCredential(cmd, cred)
+}
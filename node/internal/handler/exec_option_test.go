@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildEnv(t *testing.T) {
+	t.Setenv("CRONY_TEST_ENV", "node")
+	job := &Job{Job: &models.Job{EnvList: []string{"CRONY_TEST_ENV=job", "FOO=bar"}}}
+
+	env := buildEnv(job, nil)
+	if !containsEnv(env, "CRONY_TEST_ENV=job") || !containsEnv(env, "FOO=bar") || containsEnv(env, "CRONY_TEST_ENV=node") {
+		t.Fatalf("inherit env is %v", env)
+	}
+	if os.Getenv("PATH") != "" && !containsEnv(env, "PATH="+os.Getenv("PATH")) {
+		t.Fatal("inherit env does not contain PATH")
+	}
+
+	job.EnvMode = models.EnvClean
+	env = buildEnv(job, nil)
+	if len(env) != 2 || env[0] != "CRONY_TEST_ENV=job" || env[1] != "FOO=bar" {
+		t.Fatalf("clean env is %v", env)
+	}
+}
+
+func TestJobExecOptionsCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, EnvMode: 3},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, EnvList: []string{"=x"}},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, EnvList: []string{"NOVALUE"}},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Umask: "089"},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Umask: "1777"},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); err == nil {
+			t.Errorf("job %+v should be invalid", job)
+		}
+	}
+}
+
+func TestWrapUmaskAndWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	job := &Job{Job: &models.Job{Umask: "027", WorkDir: dir}}
+	name, args, err := wrapUmask(job, "/bin/sh", []string{"-c", "umask; pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(name, args...)
+	if err = applyExecOptions(cmd, job, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	real, _ := filepath.EvalSymlinks(dir)
+	if lines := strings.Fields(string(out)); len(lines) != 2 || lines[0] != "0027" || (lines[1] != dir && lines[1] != real) {
+		t.Fatalf("output is %q", out)
+	}
+
+	job.WorkDir = filepath.Join(dir, "missing")
+	if err = applyExecOptions(exec.Command("true"), job, nil); err == nil {
+		t.Fatal("expect error for missing work dir")
+	}
+}
+
+func TestRunAsUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err = lookupCredential(&Job{Job: &models.Job{RunAsUser: "crony-no-such-user"}}); err == nil {
+		t.Fatal("expect error for unknown user")
+	}
+	cred, err := lookupCredential(&Job{Job: &models.Job{RunAsUser: current.Username}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 以自身身份执行总是允许的
+	if err = cred.checkPrivilege(); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Geteuid() != 0 {
+		root, err := lookupCredential(&Job{Job: &models.Job{RunAsUser: "0"}})
+		if err != nil {
+			t.Skip(err)
+		}
+		if err = root.checkPrivilege(); !errors.Is(err, cronyErrors.ErrRunAsNotPermitted) {
+			t.Fatalf("expect ErrRunAsNotPermitted, got %v", err)
+		}
+		return
+	}
+
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+	job := &Job{Job: &models.Job{RunAsUser: "nobody", EnvMode: models.EnvClean}}
+	cred, err = lookupCredential(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("/bin/sh", "-c", "id -u; echo $USER")
+	if err = applyExecOptions(cmd, job, cred); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := strings.Fields(string(out)); len(fields) != 2 || fields[0] != nobody.Uid || fields[1] != "nobody" {
+		t.Fatalf("output is %q", out)
+	}
+}
+
+func containsEnv(env []string, kv string) bool {
+	for _, e := range env {
+		if e == kv {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,11 @@
 package handler
 
-import "crony/common/models"
+import (
+	"crony/common/models"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"sync"
+)
 
 // Handler 是一个接口，定义了所有具体的任务处理器需要实现的方法
 type Handler interface {
@@ -8,22 +13,40 @@ type Handler interface {
 	Run(job *Job) (string, error)
 }
 
+// HandlerFactory 为一个任务创建处理器
+type HandlerFactory func(j *Job) Handler
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[models.JobType]HandlerFactory)
+)
+
+// 内置的任务类型
+func init() {
+	RegisterHandler(models.JobTypeCmd, func(*Job) Handler { return new(CMDHandler) })
+	RegisterHandler(models.JobTypeHttp, func(*Job) Handler { return new(HTTPHandler) })
+	RegisterHandler(models.JobTypeShell, func(*Job) Handler { return new(ShellHandler) })
+	RegisterHandler(models.JobTypeContainer, func(*Job) Handler { return new(ContainerHandler) })
+	RegisterHandler(models.JobTypeSQL, func(*Job) Handler { return new(SQLHandler) })
+	RegisterHandler(models.JobTypeGRPC, func(*Job) Handler { return new(GRPCHandler) })
+}
+
+// RegisterHandler 注册任务类型的处理器, 重复注册时后注册的覆盖先注册的
+// 任务类型还需要通过 models.RegisterJobType 注册, 才能通过 Job.Check 的校验
+func RegisterHandler(t models.JobType, factory HandlerFactory) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[t] = factory
+}
+
 // CreateHandler 函数用于创建一个Handler实例
-// 接收一个Job对象，并根据Job的类型返回一个实现Handler接口的处理器
-func CreateHandler(j *Job) Handler {
-	var handler Handler = nil // 初始化handler变量为nil
-	// 使用switch豫剧检查作业的类型
-	switch j.Type {
-	// 如果是命令类型（JobTypeCmd）的作业
-	case models.JobTypeCmd:
-		// 创建一个新的CMDHanlder实例
-		handler = new(CMDHandler)
-	// 如果是HTTP请求类型（JobTypeHttp）的作业
-	case models.JobTypeHttp:
-		// 创建一个新的HTTPHanlder实例
-		handler = new(HTTPHandler)
+// 接收一个Job对象，并根据Job的类型返回已注册的处理器, 类型未注册时返回 ErrUnknownJobType
+func CreateHandler(j *Job) (Handler, error) {
+	handlersMu.RLock()
+	factory, ok := handlers[j.Type]
+	handlersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", errors.ErrUnknownJobType, j.Type)
 	}
-	// 返回创建好的具体处理器实例
-	return handler
-
+	return factory(j), nil
 }
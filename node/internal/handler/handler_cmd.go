@@ -4,44 +4,190 @@ import (
 	"bytes"
 	"context"
 	"crony/common/models"
+	"crony/common/pkg/config"
 	"crony/common/pkg/logger"
+	"crony/common/pkg/utils/errors"
 	"fmt"
+	"io"
 	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// DefaultKillGracePeriod 是未配置 System.KillGracePeriod 时, 发送 SIGTERM 后等待进程退出的时间
+const DefaultKillGracePeriod = 10 * time.Second
+
 // CMDHandler 结构体用于处理命令执行
 type CMDHandler struct{}
 
+// runningCmd 是当前节点上一条正在执行的命令或容器
+type runningCmd struct {
+	cmd    *exec.Cmd
+	killed int32         // 是否已被要求终止
+	done   chan struct{} // 命令退出后关闭
+
+	mu   sync.Mutex
+	stop func(grace time.Duration) error // 容器任务用于停止容器, 设置后代替向进程组发送信号
+}
+
+// setStop 设置停止容器的方法
+// 设置之前已经收到终止请求时立即停止, 避免终止请求在执行开始前到达而被忽略
+func (rc *runningCmd) setStop(stop func(grace time.Duration) error) {
+	rc.mu.Lock()
+	rc.stop = stop
+	rc.mu.Unlock()
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		go func() {
+			if err := stop(killGracePeriod()); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("stop killed job err: %s", err.Error()))
+			}
+		}()
+	}
+}
+
+// runningCmds 记录当前节点上正在执行的命令, key 为进程ID
+var runningCmds sync.Map
+
+// KillCmd 函数终止当前节点上指定进程ID的命令
+// 先向整个进程组发送 SIGTERM, 超过宽限期仍未退出时再发送 SIGKILL
+func KillCmd(pid int) error {
+	v, ok := runningCmds.Load(pid)
+	if !ok {
+		return errors.ErrNotFound
+	}
+	return v.(*runningCmd).kill(pid, killGracePeriod())
+}
+
+// kill 方法终止命令, grace 为发送 SIGTERM 后等待进程退出的时间
+func (rc *runningCmd) kill(pid int, grace time.Duration) error {
+	if !atomic.CompareAndSwapInt32(&rc.killed, 0, 1) {
+		return nil
+	}
+	rc.mu.Lock()
+	stop := rc.stop
+	rc.mu.Unlock()
+	if stop != nil {
+		// 容器运行时自己负责先发送 SIGTERM, 超过宽限期再强制结束
+		go func() {
+			if err := stop(grace); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("stop container of pid[%d] err: %s", pid, err.Error()))
+			}
+		}()
+		return nil
+	}
+	if rc.cmd == nil || rc.cmd.Process == nil {
+		// 尚未启动, 由执行方在启动前检查 killed 标记
+		return nil
+	}
+	if err := signalGroup(rc.cmd, syscall.SIGTERM); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-rc.done:
+		case <-time.After(grace):
+			logger.GetLogger().Warn(fmt.Sprintf("pid[%d] is still running after SIGTERM, send SIGKILL", pid))
+			if err := signalGroup(rc.cmd, syscall.SIGKILL); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("send SIGKILL to pid[%d] err: %s", pid, err.Error()))
+			}
+		}
+	}()
+	return nil
+}
+
+// killGracePeriod 返回发送 SIGTERM 后等待进程退出的时间
+func killGracePeriod() time.Duration {
+	if period := config.GetConfigModels().System.KillGracePeriod; period > 0 {
+		return time.Duration(period) * time.Second
+	}
+	return DefaultKillGracePeriod
+}
+
 // Run 方法负责执行一个job
 func (c *CMDHandler) Run(job *Job) (result string, err error) {
+	return runCommand(job, job.Cmd[0], job.Cmd[1:]...)
+}
+
+// runCommand 函数执行一条外部命令, 标准输出和标准错误合并为任务的输出
+func runCommand(job *Job, name string, args ...string) (result string, err error) {
+	// 创建一个bytes.Buffer，用于捕获命令的标准输出和标准错误
+	var b bytes.Buffer
+	err = execCommand(job, nil, &b, &b, name, args...)
+	return b.String(), err
+}
+
+// execCommand 函数执行一条外部命令, 并负责超时控制、进程登记和终止处理
+// stdin 为 nil 时命令的标准输入为空
+func execCommand(job *Job, stdin io.Reader, stdout, stderr io.Writer, name string, args ...string) (err error) {
 	var (
-		cmd  *exec.Cmd // 用于表示一个外部命令
-		proc *JobProc  // 用于追踪正在运行的工作进程
+		cmd  *exec.Cmd       // 用于表示一个外部命令
+		proc *JobProc        // 用于追踪正在运行的工作进程
+		ctx  context.Context // 设置了超时时间时用于判断是否超时
 	)
+	// 解析任务的执行身份和 umask, 失败时不启动命令
+	cred, err := lookupCredential(job)
+	if err != nil {
+		return
+	}
+	if name, args, err = wrapUmask(job, name, args); err != nil {
+		return
+	}
 	// 如果设定了超时时间，则创建一个带有超时的context
 	if job.Timeout > 0 {
 		// 建立一个带有超时的context
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(job.Timeout)*time.Second)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(job.Timeout)*time.Second)
 		defer cancel() // 确保在函数结束时取消context，释放资源
-		// 使用带有context的CommandContext来创建命令，如果context被取消，命令也被终止
-		cmd = exec.CommandContext(ctx, job.Cmd[0], job.Cmd[1:]...)
-	} else {
-		// 如果没有设置超时，则创建一个常规的命令
-		cmd = exec.Command(job.Cmd[0], job.Cmd[1:]...)
 	}
-	// 创建一个bytes.Buffer，用于捕获命令的标准输出和标准错误
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	// newCmd 创建命令, 在 cgroup 中启动失败时需要重新创建
+	newCmd := func() (*exec.Cmd, error) {
+		var cmd *exec.Cmd
+		if ctx != nil {
+			// 使用带有context的CommandContext来创建命令，如果context被取消，命令也被终止
+			cmd = exec.CommandContext(ctx, name, args...)
+			cmd.Cancel = func() error {
+				return signalGroup(cmd, syscall.SIGKILL)
+			}
+		} else {
+			// 如果没有设置超时，则创建一个常规的命令
+			cmd = exec.Command(name, args...)
+		}
+		// 在独立的进程组中运行, 超时或被终止时连同子进程一起结束
+		setProcessGroup(cmd)
+		// 设置执行用户、工作目录和环境变量
+		if err := applyExecOptions(cmd, job, cred); err != nil {
+			return nil, err
+		}
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd, nil
+	}
+	if cmd, err = newCmd(); err != nil {
+		return
+	}
+	// 设置了资源限制时, 优先让进程在独立的 cgroup 中运行, cgroup 不可用时退化为 rlimit
+	var cg *cgroup
+	if job.HasResourceLimits() {
+		if cg, err = createCgroup(cgroupSliceDir(), job); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job#%d create cgroup err: %s, fall back to rlimit", job.ID, err.Error()))
+			cg, err = nil, nil
+			limitWithoutCgroup(cmd, job, cred)
+		} else {
+			cg.apply(cmd)
+		}
+	}
 
 	// 异步启动命令
-	err = cmd.Start()
-	// 即使 Start() 出错，缓冲区中也可能已经有输出
-	result = b.String()
+	cmd, cg, err = startCommand(job, cred, newCmd, cmd, cg)
+	if cg != nil {
+		defer cg.destroy()
+	}
 	if err != nil {
 		// 若果启动命令时出错，记录错误并返回
-		logger.GetLogger().Error(fmt.Sprintf("%s\n%s", b.String(), err.Error()))
+		logger.GetLogger().Error(fmt.Sprintf("job#%d start %s err: %s", job.ID, name, err.Error()))
 		return
 	}
 
@@ -57,19 +203,54 @@ func (c *CMDHandler) Run(job *Job) (result string, err error) {
 			},
 		},
 	}
+	// 先登记正在执行的命令再发布进程记录, 发布后立即到达的终止请求也能找到命令
+	rc := &runningCmd{cmd: cmd, done: make(chan struct{})}
+	runningCmds.Store(proc.ID, rc)
+	defer runningCmds.Delete(proc.ID)
 	// 启动进程追踪
 	err = proc.Start()
 	if err != nil {
 		return // 如果追踪失败，则返回错误
 	}
 	defer proc.Stop() // 确保在函数退出时停止进程追踪
-	if err = cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	close(rc.done)
+	// 记录本次执行的峰值内存和 CPU 时间
+	if cg != nil {
+		job.usage = cg.usage(cmd.ProcessState)
+	} else {
+		job.usage = processUsage(cmd.ProcessState)
+	}
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		// 被要求终止的命令无论退出码如何都记为终止, 而不是失败
+		logger.GetLogger().Info(fmt.Sprintf("job#%d pid[%d] is killed", job.ID, proc.ID))
+		return errors.ErrJobKilled
+	}
+	if err != nil {
+		if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+			err = &timeoutError{fmt.Errorf("job#%d timeout after %ds: %w", job.ID, job.Timeout, err)}
+		}
 		// 如果命令执行出错，记录错误
-		logger.GetLogger().Error(fmt.Sprintf("%s%s", b.String(), err.Error()))
-		// 返回输出和错误
-		return b.String(), err
+		logger.GetLogger().Error(fmt.Sprintf("job#%d pid[%d] exit with err: %s", job.ID, proc.ID, err.Error()))
+		return err
 	}
-	return b.String(), nil
+	return nil
+}
+
+// startCommand 函数启动命令, 返回实际启动的命令和使用的 cgroup
+// 在 cgroup 中启动失败时(例如内核不支持 clone3 或 CLONE_INTO_CGROUP), 删除 cgroup 并重新创建命令, 退化为 rlimit 后再启动一次
+func startCommand(job *Job, cred *credential, newCmd func() (*exec.Cmd, error), cmd *exec.Cmd, cg *cgroup) (*exec.Cmd, *cgroup, error) {
+	err := cmd.Start()
+	if err == nil || cg == nil {
+		return cmd, cg, err
+	}
+	logger.GetLogger().Warn(fmt.Sprintf("job#%d start in cgroup err: %s, retry without cgroup", job.ID, err.Error()))
+	cg.destroy()
+	if cmd, err = newCmd(); err != nil {
+		return nil, nil, err
+	}
+	limitWithoutCgroup(cmd, job, cred)
+	return cmd, nil, cmd.Start()
 }
 
 // RunPresetScript 函数用于执行一个预设的脚本
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContainerLogDrainTimeout 是容器退出后等待日志读取结束的最长时间
+const ContainerLogDrainTimeout = 5 * time.Second
+
+// ContainerHandler 是在容器中执行任务的处理器
+type ContainerHandler struct{}
+
+// Run 方法在容器中执行任务, 容器的输出作为任务的输出
+func (c *ContainerHandler) Run(job *Job) (result string, err error) {
+	proc := &JobProc{
+		JobProc: &models.JobProc{
+			ID:       nextVirtualProcId(), // 容器任务没有节点上的进程ID
+			JobID:    job.ID,
+			NodeUUID: job.RunOn,
+			JobProcVal: models.JobProcVal{
+				Time: time.Now(),
+			},
+		},
+	}
+	rc := &runningCmd{done: make(chan struct{})}
+	runningCmds.Store(proc.ID, rc)
+	defer runningCmds.Delete(proc.ID)
+	if err = proc.Start(); err != nil {
+		return
+	}
+	defer proc.Stop()
+	return runContainer(newContainerRuntime(), job, rc)
+}
+
+// runContainer 创建并运行容器, 负责超时控制、终止处理和容器清理
+func runContainer(rt ContainerRuntime, job *Job, rc *runningCmd) (string, error) {
+	defer close(rc.done)
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if job.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(job.Timeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	id, err := rt.Create(ctx, containerOptions(job))
+	if err != nil {
+		return "", fmt.Errorf("create container: %w", err)
+	}
+	// 无论以何种方式结束都删除容器, 使用独立的 context 避免超时后无法清理
+	defer func() {
+		if err := rt.Remove(context.Background(), id); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job#%d remove container %s err: %s", job.ID, id, err.Error()))
+		}
+	}()
+	rc.setStop(func(grace time.Duration) error {
+		return rt.Stop(context.Background(), id, grace)
+	})
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		return "", errors.ErrJobKilled
+	}
+	if err = rt.Start(ctx, id); err != nil {
+		return "", fmt.Errorf("start container: %w", err)
+	}
+	// 启动前到达的终止请求只停止了尚未运行的容器, 这里再停止一次
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		_ = rt.Stop(context.Background(), id, 0)
+	}
+
+	var b lockedBuffer
+	logCtx, cancelLogs := context.WithCancel(context.Background())
+	defer cancelLogs()
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		_ = rt.Logs(logCtx, id, &b)
+	}()
+
+	code, err := rt.Wait(ctx, id)
+	if ctx.Err() == context.DeadlineExceeded {
+		// 超时后不再等待宽限期, 直接结束容器
+		if serr := rt.Stop(context.Background(), id, 0); serr != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job#%d stop container %s err: %s", job.ID, id, serr.Error()))
+		}
+		err = &timeoutError{fmt.Errorf("container of job#%d timeout after %ds", job.ID, job.Timeout)}
+	}
+	select {
+	case <-logsDone:
+	case <-time.After(ContainerLogDrainTimeout):
+		cancelLogs()
+		<-logsDone
+	}
+	output := b.String()
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		return output, errors.ErrJobKilled
+	}
+	if err != nil {
+		return output, err
+	}
+	if code != 0 {
+		return output, &exitCodeError{what: "container", code: code}
+	}
+	return output, nil
+}
+
+// containerOptions 根据任务生成创建容器的参数
+func containerOptions(job *Job) *ContainerOptions {
+	spec := job.Container
+	if spec == nil {
+		spec = new(models.ContainerSpec)
+	}
+	user := job.RunAsUser
+	if job.RunAsGroup != "" {
+		user += ":" + job.RunAsGroup
+	}
+	return &ContainerOptions{
+		Name:    fmt.Sprintf("crony-job-%d-%d", job.ID, time.Now().UnixNano()),
+		Image:   spec.Image,
+		Command: job.Cmd,
+		Env:     dedupEnv(job.EnvList),
+		Mounts:  spec.Mounts,
+		WorkDir: job.WorkDir,
+		User:    user,
+		Labels: map[string]string{
+			"crony.job":  strconv.Itoa(job.ID),
+			"crony.node": job.RunOn,
+		},
+		Pull:      spec.Pull,
+		Network:   spec.Network,
+		CpuQuota:  job.CpuQuota,
+		MemoryMax: job.MemoryMax,
+		PidsMax:   job.PidsMax,
+		IoWeight:  job.IoWeight,
+	}
+}
+
+// lockedBuffer 是可以并发读写的 bytes.Buffer
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.b.Write(p)
+}
+
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.b.String()
+}
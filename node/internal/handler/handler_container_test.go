@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRuntime 是测试用的容器运行时, 容器在 run 返回或被停止后退出
+type fakeRuntime struct {
+	mu      sync.Mutex
+	opts    *ContainerOptions
+	logs    string
+	code    int
+	run     time.Duration // 容器的运行时间
+	stopped chan struct{}
+	stops   int
+	removed bool
+}
+
+func newFakeRuntime(logs string, code int, run time.Duration) *fakeRuntime {
+	return &fakeRuntime{logs: logs, code: code, run: run, stopped: make(chan struct{})}
+}
+
+func (f *fakeRuntime) Create(ctx context.Context, opts *ContainerOptions) (string, error) {
+	f.opts = opts
+	return "c1", nil
+}
+
+func (f *fakeRuntime) Start(ctx context.Context, id string) error {
+	return nil
+}
+
+func (f *fakeRuntime) Logs(ctx context.Context, id string, w io.Writer) error {
+	for _, line := range strings.SplitAfter(f.logs, "\n") {
+		io.WriteString(w, line)
+	}
+	return nil
+}
+
+func (f *fakeRuntime) Wait(ctx context.Context, id string) (int, error) {
+	select {
+	case <-time.After(f.run):
+		return f.code, nil
+	case <-f.stopped:
+		return 137, nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+func (f *fakeRuntime) Stop(ctx context.Context, id string, grace time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stops == 0 {
+		close(f.stopped)
+	}
+	f.stops++
+	return nil
+}
+
+func (f *fakeRuntime) Remove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = true
+	return nil
+}
+
+func newContainerJob(timeout int64) *Job {
+	return &Job{Job: &models.Job{
+		ID:         9,
+		Type:       models.JobTypeContainer,
+		RunOn:      "node-1",
+		Timeout:    timeout,
+		Cmd:        []string{"sh", "-c", "echo hi"},
+		EnvList:    []string{"A=1"},
+		WorkDir:    "/work",
+		RunAsUser:  "1000",
+		RunAsGroup: "1000",
+		MemoryMax:  128,
+		Container: &models.ContainerSpec{
+			Image:  "alpine:3",
+			Pull:   models.ContainerPullNever,
+			Mounts: []models.ContainerMount{{Source: "/data", Target: "/data", ReadOnly: true}},
+		},
+	}}
+}
+
+func TestRunContainer(t *testing.T) {
+	rt := newFakeRuntime("line1\nline2\n", 0, 0)
+	output, err := runContainer(rt, newContainerJob(0), &runningCmd{done: make(chan struct{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "line1\nline2\n" {
+		t.Fatalf("output is %q", output)
+	}
+	if !rt.removed {
+		t.Fatal("container is not removed")
+	}
+	if rt.opts.Image != "alpine:3" || rt.opts.User != "1000:1000" || rt.opts.Labels["crony.job"] != "9" {
+		t.Fatalf("options are %+v", rt.opts)
+	}
+
+	rt = newFakeRuntime("boom\n", 2, 0)
+	output, err = runContainer(rt, newContainerJob(0), &runningCmd{done: make(chan struct{})})
+	if err == nil || !strings.Contains(err.Error(), "code 2") || output != "boom\n" {
+		t.Fatalf("output %q err %v", output, err)
+	}
+}
+
+func TestRunContainerTimeoutAndKill(t *testing.T) {
+	rt := newFakeRuntime("", 0, time.Minute)
+	_, err := runContainer(rt, newContainerJob(1), &runningCmd{done: make(chan struct{})})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expect timeout error, got %v", err)
+	}
+	if rt.stops == 0 || !rt.removed {
+		t.Fatalf("container is not cleaned up: stops %d removed %v", rt.stops, rt.removed)
+	}
+
+	rt = newFakeRuntime("", 0, time.Minute)
+	rc := &runningCmd{done: make(chan struct{})}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		rc.kill(-1, time.Second)
+	}()
+	if _, err = runContainer(rt, newContainerJob(0), rc); !errors.Is(err, cronyErrors.ErrJobKilled) {
+		t.Fatalf("expect ErrJobKilled, got %v", err)
+	}
+	if !rt.removed {
+		t.Fatal("container is not removed after kill")
+	}
+}
+
+func TestCreateArgs(t *testing.T) {
+	args := createArgs(containerOptions(newContainerJob(0)))
+	name := args[2]
+	expect := []string{"create", "--name", name, "--label", "crony.job=9", "--label", "crony.node=node-1",
+		"--pull", "never", "-e", "A=1", "-v", "/data:/data:ro", "-w", "/work", "--user", "1000:1000",
+		"--memory", "128m", "alpine:3", "sh", "-c", "echo hi"}
+	if !reflect.DeepEqual(args, expect) {
+		t.Fatalf("args are %q", args)
+	}
+}
+
+func TestContainerSpecCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeContainer},
+		{Name: "a", Command: "ls", Type: models.JobTypeContainer, Container: &models.ContainerSpec{}},
+		{Name: "a", Command: "ls", Type: models.JobTypeContainer, Container: &models.ContainerSpec{Image: "a", Pull: "sometimes"}},
+		{Name: "a", Command: "ls", Type: models.JobTypeContainer, Container: &models.ContainerSpec{
+			Image: "a", Mounts: []models.ContainerMount{{Source: "data", Target: "/data"}}}},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalContainerSpec) {
+			t.Errorf("job %+v: expect ErrIllegalContainerSpec, got %v", job, err)
+		}
+	}
+}
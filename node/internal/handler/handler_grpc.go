@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/utils/errors"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCExecTimeout 是未设置超时时间时 gRPC 调用的超时时间, 单位秒
+const GRPCExecTimeout = 300
+
+// GRPCHandler 是调用 gRPC unary 方法的处理器
+type GRPCHandler struct{}
+
+// Run 方法调用任务定义的 gRPC 方法, 响应以 JSON 格式作为任务的输出
+func (g *GRPCHandler) Run(job *Job) (result string, err error) {
+	proc := &JobProc{
+		JobProc: &models.JobProc{
+			ID:       nextVirtualProcId(), // gRPC任务没有操作系统进程ID
+			JobID:    job.ID,
+			NodeUUID: job.RunOn,
+			JobProcVal: models.JobProcVal{
+				Time: time.Now(),
+			},
+		},
+	}
+	rc := &runningCmd{done: make(chan struct{})}
+	runningCmds.Store(proc.ID, rc)
+	defer runningCmds.Delete(proc.ID)
+	if err = proc.Start(); err != nil {
+		return
+	}
+	defer proc.Stop()
+	return runGRPC(job, rc)
+}
+
+// runGRPC 连接服务并调用方法, 调用的截止时间由任务的超时时间决定
+func runGRPC(job *Job, rc *runningCmd) (string, error) {
+	defer close(rc.done)
+	spec := job.GRPC
+	if spec == nil {
+		return "", fmt.Errorf("%w: grpc is required", errors.ErrIllegalGRPCSpec)
+	}
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = GRPCExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	// 终止时取消 context, 正在进行的调用以 Canceled 结束
+	rc.setStop(func(grace time.Duration) error {
+		cancel()
+		return nil
+	})
+
+	output, err := invokeGRPC(ctx, job.Command, spec)
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		return output, errors.ErrJobKilled
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = &timeoutError{fmt.Errorf("grpc job#%d timeout after %ds: %w", job.ID, timeout, err)}
+	}
+	return output, err
+}
+
+// invokeGRPC 解析方法定义, 将 JSON 请求转换为消息后发起调用
+func invokeGRPC(ctx context.Context, target string, spec *models.GRPCSpec) (string, error) {
+	service, method, err := spec.ParseMethod()
+	if err != nil {
+		return "", err
+	}
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if spec.TLS {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))}
+	}
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return "", fmt.Errorf("dial %s: %w", target, err)
+	}
+	defer conn.Close()
+
+	var files *protoregistry.Files
+	if spec.DescriptorSet != "" {
+		files, err = descriptorSetFiles(spec.DescriptorSet)
+	} else {
+		files, err = reflectionFiles(ctx, conn, service)
+	}
+	if err != nil {
+		return "", err
+	}
+	md, err := findMethod(files, service, method)
+	if err != nil {
+		return "", err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return "", fmt.Errorf("method %s/%s is not unary", service, method)
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if spec.Body != "" {
+		if err = protojson.Unmarshal([]byte(spec.Body), req); err != nil {
+			return "", fmt.Errorf("decode request body: %w", err)
+		}
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+	if len(spec.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(spec.Metadata))
+	}
+	err = conn.Invoke(ctx, fmt.Sprintf("/%s/%s", service, method), req, resp)
+	st := status.Convert(err)
+	output := st.Code().String() + ": " + st.Message()
+	if err == nil {
+		data, merr := protojson.Marshal(resp)
+		if merr != nil {
+			return "", fmt.Errorf("encode response: %w", merr)
+		}
+		output = string(data)
+	}
+	if !spec.IsSuccess(st.Code()) {
+		return output, fmt.Errorf("grpc status %s: %s", st.Code(), st.Message())
+	}
+	return output, nil
+}
+
+// findMethod 在文件描述中查找方法
+func findMethod(files *protoregistry.Files, service, method string) (protoreflect.MethodDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", method, service)
+	}
+	return md, nil
+}
+
+// descriptorSetFiles 解析 base64 编码的 FileDescriptorSet
+// 需要使用 protoc --include_imports --descriptor_set_out 生成, 以包含全部依赖
+func descriptorSetFiles(encoded string) (*protoregistry.Files, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: descriptor_set is not valid base64", errors.ErrIllegalGRPCSpec)
+	}
+	set := new(descriptorpb.FileDescriptorSet)
+	if err = proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("decode descriptor set: %w", err)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// reflectionFiles 通过服务端反射获取包含 symbol 的文件及其依赖
+// 服务端没有返回的依赖(例如 google/protobuf 下的公共类型)从本进程已注册的文件中补全
+func reflectionFiles(ctx context.Context, conn *grpc.ClientConn, symbol string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	defer stream.CloseSend()
+
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	requested := make(map[string]bool)
+	pending := []*rpb.ServerReflectionRequest{{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}}
+	for len(pending) > 0 {
+		req := pending[0]
+		pending = pending[1:]
+		if err = stream.Send(req); err != nil {
+			return nil, fmt.Errorf("server reflection: %w", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("server reflection: %w", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection: %s", e.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err = proto.Unmarshal(b, fd); err != nil {
+				return nil, fmt.Errorf("decode file descriptor: %w", err)
+			}
+			protos[fd.GetName()] = fd
+			for _, dep := range fd.GetDependency() {
+				if _, ok := protos[dep]; ok || requested[dep] {
+					continue
+				}
+				if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					continue
+				}
+				requested[dep] = true
+				pending = append(pending, &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				})
+			}
+		}
+	}
+	addGlobalDependencies(protos)
+	set := new(descriptorpb.FileDescriptorSet)
+	for _, fd := range protos {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// addGlobalDependencies 将缺少的依赖从本进程已注册的文件中补全
+func addGlobalDependencies(protos map[string]*descriptorpb.FileDescriptorProto) {
+	for _, fd := range protos {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := protos[dep]; ok {
+				continue
+			}
+			if gfd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				protos[dep] = protodesc.ToFileDescriptorProto(gfd)
+				// 新加入的文件可能还有依赖, 重新检查一遍
+				addGlobalDependencies(protos)
+				return
+			}
+		}
+	}
+}
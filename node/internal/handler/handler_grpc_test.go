@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// echoFileProto 是测试服务的定义:
+//
+//	service Echo { rpc Say(EchoRequest) returns (EchoReply); }
+//	message EchoRequest { string name = 1; }
+//	message EchoReply { string message = 1; string token = 2; }
+var echoFileProto = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("crony/test/echo.proto"),
+	Package: proto.String("crony.test"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{Name: proto.String("EchoRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+			stringField("name", 1),
+		}},
+		{Name: proto.String("EchoReply"), Field: []*descriptorpb.FieldDescriptorProto{
+			stringField("message", 1),
+			stringField("token", 2),
+		}},
+	},
+	Service: []*descriptorpb.ServiceDescriptorProto{{
+		Name: proto.String("Echo"),
+		Method: []*descriptorpb.MethodDescriptorProto{{
+			Name:       proto.String("Say"),
+			InputType:  proto.String(".crony.test.EchoRequest"),
+			OutputType: proto.String(".crony.test.EchoReply"),
+		}},
+	}},
+}
+
+var (
+	echoFileOnce sync.Once
+	echoFile     protoreflect.FileDescriptor
+)
+
+func stringField(name string, number int32) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+	}
+}
+
+// startEchoServer 启动一个进程内的 gRPC 服务, 并注册服务端反射
+func startEchoServer(t *testing.T) string {
+	echoFileOnce.Do(func() {
+		fd, err := protodesc.NewFile(echoFileProto, protoregistry.GlobalFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 服务端反射从全局注册表中读取文件描述
+		if err = protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+			t.Fatal(err)
+		}
+		echoFile = fd
+	})
+	input := echoFile.Messages().ByName("EchoRequest")
+	output := echoFile.Messages().ByName("EchoReply")
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "crony.test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Say",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := dynamicpb.NewMessage(input)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				name := req.Get(input.Fields().ByName("name")).String()
+				if name == "" {
+					return nil, status.Error(codes.InvalidArgument, "name is empty")
+				}
+				reply := dynamicpb.NewMessage(output)
+				reply.Set(output.Fields().ByName("message"), protoreflect.ValueOfString("hello "+name))
+				if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("x-token")) > 0 {
+					reply.Set(output.Fields().ByName("token"), protoreflect.ValueOfString(md.Get("x-token")[0]))
+				}
+				return reply, nil
+			},
+		}},
+		Metadata: "crony/test/echo.proto",
+	}, struct{}{})
+	reflection.Register(srv)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func newGRPCJob(addr string, spec *models.GRPCSpec) *Job {
+	if err := spec.Check(); err != nil {
+		panic(err)
+	}
+	return &Job{Job: &models.Job{ID: 5, Type: models.JobTypeGRPC, Command: addr, Timeout: 5, GRPC: spec}}
+}
+
+func TestRunGRPCReflection(t *testing.T) {
+	addr := startEchoServer(t)
+	job := newGRPCJob(addr, &models.GRPCSpec{
+		Method:   "crony.test.Echo/Say",
+		Body:     `{"name":"crony"}`,
+		Metadata: map[string]string{"x-token": "abc"},
+	})
+	output, err := runGRPC(job, &runningCmd{done: make(chan struct{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, `"message":"hello crony"`) || !strings.Contains(output, `"token":"abc"`) {
+		t.Fatalf("output is %s", output)
+	}
+}
+
+func TestRunGRPCDescriptorSetAndStatus(t *testing.T) {
+	addr := startEchoServer(t)
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{echoFileProto}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := base64.StdEncoding.EncodeToString(data)
+
+	output, err := runGRPC(newGRPCJob(addr, &models.GRPCSpec{Method: "crony.test.Echo.Say", Body: `{"name":"set"}`, DescriptorSet: set}),
+		&runningCmd{done: make(chan struct{})})
+	if err != nil || !strings.Contains(output, "hello set") {
+		t.Fatalf("output %s err %v", output, err)
+	}
+
+	// 默认只有 OK 视为成功
+	output, err = runGRPC(newGRPCJob(addr, &models.GRPCSpec{Method: "crony.test.Echo/Say", DescriptorSet: set}),
+		&runningCmd{done: make(chan struct{})})
+	if err == nil || !strings.Contains(output, "InvalidArgument") {
+		t.Fatalf("expect InvalidArgument, output %s err %v", output, err)
+	}
+	spec := &models.GRPCSpec{Method: "crony.test.Echo/Say", DescriptorSet: set, SuccessCodes: []string{"OK", "invalid_argument"}}
+	if _, err = runGRPC(newGRPCJob(addr, spec), &runningCmd{done: make(chan struct{})}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = runGRPC(newGRPCJob(addr, &models.GRPCSpec{Method: "crony.test.Echo/Missing", DescriptorSet: set}),
+		&runningCmd{done: make(chan struct{})}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expect method not found, got %v", err)
+	}
+}
+
+func TestGRPCSpecCheck(t *testing.T) {
+	invalid := []*models.GRPCSpec{
+		{Method: "Say"},
+		{Method: "crony.test.Echo/"},
+		{Method: "crony.test.Echo/Say", Body: "{"},
+		{Method: "crony.test.Echo/Say", DescriptorSet: "%%%"},
+		{Method: "crony.test.Echo/Say", SuccessCodes: []string{"MAYBE"}},
+	}
+	for _, spec := range invalid {
+		if err := spec.Check(); err == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+	service, method, err := (&models.GRPCSpec{Method: "/crony.test.Echo/Say"}).ParseMethod()
+	if err != nil || service != "crony.test.Echo" || method != "Say" {
+		t.Fatalf("parse method: %s %s %v", service, method, err)
+	}
+}
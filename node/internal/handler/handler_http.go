@@ -1,9 +1,21 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"crony/common/models"
 	"crony/common/pkg/httpclient"
+	"crony/common/pkg/utils"
+	"crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
@@ -19,7 +31,7 @@ func (h *HTTPHandler) Run(job *Job) (result string, err error) {
 	// 初始化一个JobProc来追踪此次HTTP任务的执行状态
 	proc = &JobProc{
 		JobProc: &models.JobProc{
-			ID:       0, // HTTP任务没有操作系统进程ID
+			ID:       nextVirtualProcId(), // HTTP任务没有操作系统进程ID
 			JobID:    job.ID,
 			NodeUUID: job.RunOn,
 			JobProcVal: models.JobProcVal{
@@ -27,6 +39,9 @@ func (h *HTTPHandler) Run(job *Job) (result string, err error) {
 			},
 		},
 	}
+	rc := &runningCmd{done: make(chan struct{})}
+	runningCmds.Store(proc.ID, rc)
+	defer runningCmds.Delete(proc.ID)
 
 	// 记录任务开始执行
 	err = proc.Start()
@@ -35,15 +50,36 @@ func (h *HTTPHandler) Run(job *Job) (result string, err error) {
 	}
 	// 使用defer确保函数退出时，会调用proc.Stop()来清理执行记录
 	defer proc.Stop()
-	// 检查并修正任务的超时设置
+	return runHttp(job, rc)
+}
+
+// httpTimeout 返回请求的超时时间(秒), 未设置或超过 HttpExecTimeout 时为 HttpExecTimeout
+// job.Job 由同一任务的各次执行共享, 修正后的值不能写回任务
+func httpTimeout(job *Job) int64 {
 	if job.Timeout <= 0 || job.Timeout > HttpExecTimeout {
-		job.Timeout = HttpExecTimeout
+		return HttpExecTimeout
 	}
-	// 根据job中定义的HTTP方法执行不同的逻辑
-	if job.HttpMethod == models.HttpMethodGet {
+	return job.Timeout
+}
+
+// runHttp 发送任务的请求, 被终止时取消请求
+func runHttp(job *Job, rc *runningCmd) (result string, err error) {
+	defer close(rc.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 终止时取消 context, 正在进行的请求以 context.Canceled 结束
+	rc.setStop(func(grace time.Duration) error {
+		cancel()
+		return nil
+	})
+
+	// 设置了请求定义时按定义发送请求, 否则沿用旧的 GET / JSON POST 行为
+	if job.Http != nil {
+		result, err = runHttpSpec(ctx, job)
+	} else if job.HttpMethod == models.HttpMethodGet {
 		// 如果是GET请求，直接调用httpclient的Get方法
 		// job.Command字段此时应包含完整的URL（包括查询参数）
-		result, err = httpclient.Get(job.Command, job.Timeout)
+		result, err = httpclient.GetContext(ctx, job.Command, httpTimeout(job))
 	} else {
 		// 否则，默认为POST请求
 		// 在Command字段中，使用'?'来分割URL和POST的body数据
@@ -55,8 +91,157 @@ func (h *HTTPHandler) Run(job *Job) (result string, err error) {
 
 		}
 		// 调用httpclient的PostJson方法发送请求
-		result, err = httpclient.PostJson(url, body, job.Timeout)
+		result, err = httpclient.PostJsonContext(ctx, url, body, httpTimeout(job))
+	}
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		return result, errors.ErrJobKilled
+	}
+	return
+}
+
+// runHttpSpec 按 job.Http 的定义发送请求, 并根据断言判定本次执行是否成功
+// 返回值 result 始终为响应体, 断言失败时 err 描述未满足的条件
+func runHttpSpec(ctx context.Context, job *Job) (result string, err error) {
+	// Check 会补全默认值, 在副本上校验, 不修改各次执行共享的请求定义
+	spec := job.Http.Clone()
+	if err = spec.Check(); err != nil {
+		return
+	}
+	req, err := newHttpRequest(ctx, job, spec)
+	if err != nil {
+		return
+	}
+	resp, err := newHttpClient(spec, time.Duration(httpTimeout(job))*time.Second).Do(req)
+	if err != nil {
+		return
 	}
-	// 返回result和err
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	result = string(data)
+	err = checkHttpResponse(spec.Assert, resp.StatusCode, data)
 	return
 }
+
+// newHttpRequest 根据请求定义构造请求, 请求地址为 job.Command
+func newHttpRequest(ctx context.Context, job *Job, spec *models.HttpSpec) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSpace(job.Command))
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Query) > 0 {
+		q := u.Query()
+		for k, v := range spec.Query {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var body io.Reader
+	if spec.Body != "" {
+		tmpl, err := template.New("body").Parse(spec.Body)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		data := &models.HttpTemplateData{
+			JobID:    job.ID,
+			JobName:  job.Name,
+			NodeUUID: job.RunOn,
+			Hostname: job.Hostname,
+			IP:       job.Ip,
+			Unix:     time.Now().Unix(),
+		}
+		if err = tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		body = &b
+	}
+	req, err := http.NewRequestWithContext(ctx, spec.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range spec.Headers {
+		req.Header.Set(k, v)
+	}
+	// 有请求体但没有指定类型时, 与旧的 POST 行为一致按 JSON 发送
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if spec.Auth != nil {
+		switch spec.Auth.Type {
+		case models.HttpAuthBasic:
+			req.SetBasicAuth(spec.Auth.Username, spec.Auth.Password)
+		case models.HttpAuthBearer:
+			req.Header.Set("Authorization", "Bearer "+spec.Auth.Token)
+		}
+	}
+	return req, nil
+}
+
+// newHttpClient 根据重定向策略和超时时间创建客户端
+func newHttpClient(spec *models.HttpSpec, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if spec.NoRedirect {
+				// 返回最后一次的 3xx 响应, 由断言决定是否成功
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= spec.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", spec.MaxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// checkHttpResponse 检查响应是否满足全部断言
+func checkHttpResponse(assert *models.HttpAssert, status int, body []byte) error {
+	if status < assert.StatusMin || status > assert.StatusMax {
+		return &httpStatusError{status: status, min: assert.StatusMin, max: assert.StatusMax}
+	}
+	if assert.BodyRegex != "" {
+		re, err := regexp.Compile(assert.BodyRegex)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("response body does not match %q", assert.BodyRegex)
+		}
+	}
+	if assert.JSONPath != "" {
+		path, err := utils.ParseJSONPath(assert.JSONPath)
+		if err != nil {
+			return err
+		}
+		var data interface{}
+		if err = json.Unmarshal(body, &data); err != nil {
+			return fmt.Errorf("response body is not json: %s", err.Error())
+		}
+		value, ok := path.Lookup(data)
+		if !ok || value == nil {
+			return fmt.Errorf("json path %s is not found in response body", assert.JSONPath)
+		}
+		if assert.JSONValue != "" {
+			if actual := jsonValueString(value); actual != assert.JSONValue {
+				return fmt.Errorf("json path %s is %s, expect %s", assert.JSONPath, actual, assert.JSONValue)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonValueString 将 JSON 中的值转换为用于比较的字符串, 字符串原样返回, 其他类型按 JSON 编码
+func jsonValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/utils/errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHttpJob(url string, spec *models.HttpSpec) *Job {
+	return &Job{Job: &models.Job{
+		ID:      7,
+		Name:    "sync",
+		Command: url,
+		Type:    models.JobTypeHttp,
+		Timeout: 5,
+		RunOn:   "node-1",
+		Http:    spec,
+	}}
+}
+
+func TestRunHttpSpecRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method is %s", r.Method)
+		}
+		if r.URL.Query().Get("a") != "1" || r.URL.Query().Get("b") != "2" {
+			t.Errorf("query is %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("X-Token") != "abc" {
+			t.Errorf("header X-Token is %q", r.Header.Get("X-Token"))
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			t.Errorf("basic auth is %s:%s", user, pass)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"job":7,"node":"node-1"}` {
+			t.Errorf("body is %s", body)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("content type is %q", r.Header.Get("Content-Type"))
+		}
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	job := newHttpJob(srv.URL+"/api?a=1", &models.HttpSpec{
+		Method:  "put",
+		Query:   map[string]string{"b": "2"},
+		Headers: map[string]string{"X-Token": "abc"},
+		Body:    `{"job":{{.JobID}},"node":"{{.NodeUUID}}"}`,
+		Auth:    &models.HttpAuth{Type: "basic", Username: "admin", Password: "secret"},
+	})
+	result, err := runHttpSpec(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "done" {
+		t.Fatalf("result is %q", result)
+	}
+}
+
+func TestRunHttpSpecBearerAndRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("new"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	auth := &models.HttpAuth{Type: "bearer", Token: "t0k"}
+	result, err := runHttpSpec(context.Background(), newHttpJob(srv.URL+"/old", &models.HttpSpec{Auth: auth}))
+	if err != nil || result != "new" {
+		t.Fatalf("follow redirect: result %q err %v", result, err)
+	}
+
+	// 不跟随重定向时 302 不在默认的 2xx 范围内
+	if _, err = runHttpSpec(context.Background(), newHttpJob(srv.URL+"/old", &models.HttpSpec{Auth: auth, NoRedirect: true})); err == nil {
+		t.Fatal("expect status assertion error without following redirect")
+	}
+	spec := &models.HttpSpec{Auth: auth, NoRedirect: true, Assert: &models.HttpAssert{StatusMin: 300, StatusMax: 399}}
+	if _, err = runHttpSpec(context.Background(), newHttpJob(srv.URL+"/old", spec)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunHttpSpecAssert(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{"code":0,"data":{"items":[{"state":"ok","count":3}]}}`))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name   string
+		path   string
+		assert *models.HttpAssert
+		ok     bool
+	}{
+		{"default status", "/", nil, true},
+		{"status out of range", "/fail", nil, false},
+		{"status in custom range", "/fail", &models.HttpAssert{StatusMin: 500, StatusMax: 599}, true},
+		{"regex matched", "/", &models.HttpAssert{BodyRegex: `"state":"ok"`}, true},
+		{"regex not matched", "/", &models.HttpAssert{BodyRegex: `"state":"failed"`}, false},
+		{"json path exists", "/", &models.HttpAssert{JSONPath: "$.data.items[0].state"}, true},
+		{"json path missing", "/", &models.HttpAssert{JSONPath: "$.data.items[1]"}, false},
+		{"json string value", "/", &models.HttpAssert{JSONPath: "$['data'].items[0].state", JSONValue: "ok"}, true},
+		{"json number value", "/", &models.HttpAssert{JSONPath: "$.data.items[0].count", JSONValue: "3"}, true},
+		{"json value mismatch", "/", &models.HttpAssert{JSONPath: "$.code", JSONValue: "1"}, false},
+	}
+	for _, c := range cases {
+		_, err := runHttpSpec(context.Background(), newHttpJob(srv.URL+c.path, &models.HttpSpec{Assert: c.assert}))
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err %v", c.name, err)
+		}
+	}
+}
+
+func TestHttpSpecCheck(t *testing.T) {
+	invalid := []*models.HttpSpec{
+		{Method: "CONNECT"},
+		{Body: "{{.JobID"},
+		{Auth: &models.HttpAuth{Type: "digest"}},
+		{Assert: &models.HttpAssert{StatusMin: 300, StatusMax: 200}},
+		{Assert: &models.HttpAssert{BodyRegex: "("}},
+		{Assert: &models.HttpAssert{JSONPath: "data.state"}},
+		{Assert: &models.HttpAssert{JSONValue: "ok"}},
+	}
+	for _, spec := range invalid {
+		if err := spec.Check(); err == nil || !strings.Contains(err.Error(), "http spec") {
+			t.Errorf("spec %+v: expect invalid http spec, got %v", spec, err)
+		}
+	}
+}
+
+func TestRunHttpKilled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	for _, spec := range []*models.HttpSpec{nil, {}} {
+		job := newHttpJob(srv.URL, spec)
+		job.HttpMethod = models.HttpMethodGet
+		rc := &runningCmd{done: make(chan struct{})}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			if err := rc.kill(0, time.Second); err != nil {
+				t.Error(err)
+			}
+		}()
+		start := time.Now()
+		if _, err := runHttp(job, rc); err != errors.ErrJobKilled {
+			t.Fatalf("http spec %v: expect ErrJobKilled, got %v", spec, err)
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("http spec %v: killed request returned after %s", spec, time.Since(start))
+		}
+	}
+}
+
+func TestRunHttpSharedJob(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// 同一任务的各次执行共享 job.Job, 执行时不能修改其中的超时时间和请求定义
+	job := newHttpJob(srv.URL, &models.HttpSpec{Method: " post ", Auth: &models.HttpAuth{Type: "Bearer", Token: "t"}})
+	job.Timeout = 0
+	done := make(chan error, 4)
+	for i := 0; i < cap(done); i++ {
+		go func() {
+			_, err := runHttp(job.newRun(), &runningCmd{done: make(chan struct{})})
+			done <- err
+		}()
+	}
+	for i := 0; i < cap(done); i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Timeout != 0 || job.Http.Method != " post " || job.Http.Auth.Type != "Bearer" || job.Http.Assert != nil {
+		t.Fatalf("shared job is modified: timeout %d spec %+v", job.Timeout, job.Http)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"bytes"
+	"crony/common/models"
+	"crony/common/pkg/plugin"
+	"crony/common/pkg/utils/errors"
+)
+
+// PluginHandler 是以外部可执行文件实现的处理器
+// 插件从标准输入读取 JSON 请求, 向标准输出写入 JSON 响应, 协议见 common/pkg/plugin
+type PluginHandler struct {
+	Plugin models.Plugin
+}
+
+// RegisterPlugins 为配置中的插件注册处理器
+// 插件的任务类型由 models.RegisterPlugins 注册, 节点启动时已经完成
+func RegisterPlugins(plugins []models.Plugin) {
+	for _, p := range plugins {
+		p := p
+		RegisterHandler(models.JobType(p.Type), func(*Job) Handler { return &PluginHandler{Plugin: p} })
+	}
+}
+
+// Run 方法像命令任务一样执行插件, 执行用户、超时、资源限制和终止对插件同样生效
+// 插件的标准错误追加在响应的输出之后
+func (p *PluginHandler) Run(job *Job) (string, error) {
+	req, err := plugin.NewRequest(plugin.ActionRun, job.Job, job.RunOn)
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	runErr := execCommand(job, bytes.NewReader(req), &stdout, &stderr, p.Plugin.Path, p.Plugin.Args...)
+	return pluginResult(stdout.Bytes(), stderr.Bytes(), runErr)
+}
+
+// pluginResult 根据插件的标准输出、标准错误和退出状态得出任务的输出和错误
+func pluginResult(stdout, stderr []byte, runErr error) (string, error) {
+	if runErr == errors.ErrJobKilled {
+		return string(stdout) + string(stderr), runErr
+	}
+	resp, err := plugin.ParseResponse(stdout)
+	if err != nil {
+		output := string(stdout) + string(stderr)
+		if runErr != nil {
+			return output, runErr
+		}
+		return output, err
+	}
+	output := resp.Output
+	if len(stderr) > 0 {
+		if output != "" && output[len(output)-1] != '\n' {
+			output += "\n"
+		}
+		output += string(stderr)
+	}
+	if err = resp.Err(); err != nil {
+		return output, err
+	}
+	// 响应成功但退出码不为 0 时仍然视为失败
+	return output, runErr
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"crony/common/models"
+	"crony/common/pkg/plugin"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pluginScript 是测试用的插件: 校验时要求 params 中有 target, 执行时输出 target
+const pluginScript = `#!/bin/sh
+req=$(cat)
+case "$req" in
+*'"action":"validate"'*)
+	case "$req" in
+	*'"params":{"target":'*) echo '{"success":true}' ;;
+	*) echo '{"success":false,"error":"target is required"}' ;;
+	esac ;;
+*)
+	echo "plugin log" >&2
+	target=$(echo "$req" | grep -o '"target":"[^"]*"' | cut -d'"' -f4)
+	printf '{"success":true,"output":"ran %s"}\n' "$target" ;;
+esac
+`
+
+func writePlugin(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "crony-plugin-test")
+	if err := os.WriteFile(path, []byte(pluginScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runPluginScript 按协议调用插件, 不经过 execCommand 的进程登记
+func runPluginScript(t *testing.T, path string, job *Job) (string, error) {
+	t.Helper()
+	req, err := plugin.NewRequest(plugin.ActionRun, job.Job, "node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	return pluginResult(stdout.Bytes(), stderr.Bytes(), runErr)
+}
+
+func TestPluginRun(t *testing.T) {
+	path := writePlugin(t)
+	job := &Job{Job: &models.Job{ID: 1, Name: "p", Command: "backup", Type: 100, Params: json.RawMessage(`{"target": "db1"}`)}}
+	output, err := runPluginScript(t, path, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "ran db1\nplugin log\n" {
+		t.Fatalf("output is %q", output)
+	}
+}
+
+func TestPluginResult(t *testing.T) {
+	if _, err := pluginResult([]byte(`{"success":false,"error":"boom"}`), nil, nil); err == nil || err.Error() != "boom" {
+		t.Fatalf("expect plugin error, got %v", err)
+	}
+	if output, err := pluginResult([]byte("not json"), []byte("oops"), nil); err == nil || output != "not jsonoops" {
+		t.Fatalf("expect invalid response, output %q err %v", output, err)
+	}
+	if _, err := pluginResult([]byte(`{"success":true}{"success":true}`), nil, nil); err == nil {
+		t.Fatal("expect error for more than one response")
+	}
+	if _, err := pluginResult(nil, nil, cronyErrors.ErrJobKilled); !errors.Is(err, cronyErrors.ErrJobKilled) {
+		t.Fatalf("expect ErrJobKilled, got %v", err)
+	}
+}
+
+func TestPluginValidate(t *testing.T) {
+	path := writePlugin(t)
+	p := models.Plugin{Type: 101, Name: "backup", Path: path, Validate: true}
+	if _, ok := models.GetJobType(101); !ok {
+		if err := models.RegisterPlugins([]models.Plugin{p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.RegisterPlugins([]models.Plugin{p}); !errors.Is(err, cronyErrors.ErrIllegalPlugin) {
+		t.Fatalf("expect duplicate type to be rejected, got %v", err)
+	}
+	if err := models.RegisterPlugins([]models.Plugin{{Type: int(models.JobTypeCmd), Name: "cmd2", Path: path}}); !errors.Is(err, cronyErrors.ErrIllegalPlugin) {
+		t.Fatalf("expect built-in type to be rejected, got %v", err)
+	}
+
+	job := &models.Job{Name: "p", Command: "backup", Type: 101}
+	if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalPluginParams) || !strings.Contains(err.Error(), "target is required") {
+		t.Fatalf("expect ErrIllegalPluginParams, got %v", err)
+	}
+	job.Params = json.RawMessage(`{"target":"db1"}`)
+	if err := job.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterPlugins([]models.Plugin{p})
+	h, err := CreateHandler(&Job{Job: job})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ph, ok := h.(*PluginHandler); !ok || ph.Plugin.Path != path {
+		t.Fatalf("handler is %#v", h)
+	}
+}
+
+func TestHandlerRegistry(t *testing.T) {
+	if _, err := CreateHandler(&Job{Job: &models.Job{Type: 99}}); !errors.Is(err, cronyErrors.ErrUnknownJobType) {
+		t.Fatalf("expect ErrUnknownJobType, got %v", err)
+	}
+	if _, err := CreateJob(&Job{Job: &models.Job{Type: 99}}); !errors.Is(err, cronyErrors.ErrUnknownJobType) {
+		t.Fatalf("expect ErrUnknownJobType, got %v", err)
+	}
+	if err := (&models.Job{Name: "a", Command: "ls", Type: 99}).Check(); !errors.Is(err, cronyErrors.ErrUnknownJobType) {
+		t.Fatalf("expect ErrUnknownJobType, got %v", err)
+	}
+
+	h, err := CreateHandler(&Job{Job: &models.Job{Type: models.JobTypeShell}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.(*ShellHandler); !ok {
+		t.Fatalf("handler is %#v", h)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"crony/common/models"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ShellHandler 结构体用于执行脚本类型的任务
+// 任务的 Command 是完整的脚本内容, 支持管道、重定向和多行脚本
+type ShellHandler struct{}
+
+// Run 方法将脚本写入临时文件, 使用任务指定的解释器执行, 执行结束后删除临时文件
+func (s *ShellHandler) Run(job *Job) (result string, err error) {
+	name, args, cleanup, err := prepareScript(job)
+	if err != nil {
+		return
+	}
+	defer cleanup()
+	return runCommand(job, name, args...)
+}
+
+// prepareScript 写入临时脚本文件, 返回解释器、参数和用于删除临时文件的函数
+func prepareScript(job *Job) (name string, args []string, cleanup func(), err error) {
+	interpreter, err := models.GetShellInterpreter(job.Interpreter)
+	if err != nil {
+		return
+	}
+	file, err := writeScriptFile(job, interpreter.Ext)
+	if err != nil {
+		return
+	}
+	// 以其他用户执行时, 需要让该用户能够读取脚本文件
+	if err = chownScriptFile(job, file); err != nil {
+		os.Remove(file)
+		return
+	}
+	if job.Strict {
+		args = append(args, interpreter.StrictFlags...)
+	}
+	args = append(args, file)
+	return interpreter.Path, args, func() { os.Remove(file) }, nil
+}
+
+// writeScriptFile 将任务的脚本内容写入一个只有当前用户可读写的临时文件, 返回文件路径
+func writeScriptFile(job *Job, ext string) (string, error) {
+	f, err := os.CreateTemp("", fmt.Sprintf("crony-job-%d-*%s", job.ID, ext))
+	if err != nil {
+		return "", err
+	}
+	script := job.Command
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	if _, err = f.WriteString(script); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// chownScriptFile 将脚本文件的属主改为任务的执行用户, 没有指定执行用户时不做处理
+func chownScriptFile(job *Job, file string) error {
+	cred, err := lookupCredential(job)
+	if err != nil || cred == nil {
+		return err
+	}
+	if err = cred.checkPrivilege(); err != nil {
+		return err
+	}
+	return os.Chown(file, int(cred.uid), int(cred.gid))
+}
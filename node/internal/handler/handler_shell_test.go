@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"crony/common/models"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func runScript(t *testing.T, job *Job) (string, error) {
+	t.Helper()
+	name, args, cleanup, err := prepareScript(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, runErr := exec.Command(name, args...).CombinedOutput()
+	file := args[len(args)-1]
+	cleanup()
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("script file %s is not removed", file)
+	}
+	return string(out), runErr
+}
+
+func TestShellScript(t *testing.T) {
+	job := &Job{Job: &models.Job{
+		ID:      1,
+		Type:    models.JobTypeShell,
+		Command: "printf 'a\\nb\\nab\\n' | grep a > /dev/stdout\necho done",
+	}}
+	out, err := runScript(t, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "a\nab\ndone\n" {
+		t.Fatalf("output is %q", out)
+	}
+}
+
+func TestShellScriptStrict(t *testing.T) {
+	job := &Job{Job: &models.Job{
+		ID:      2,
+		Type:    models.JobTypeShell,
+		Command: "false\necho after",
+	}}
+	// 非严格模式下失败的命令不会中断脚本
+	out, err := runScript(t, job)
+	if err != nil || !strings.Contains(out, "after") {
+		t.Fatalf("output %q err %v", out, err)
+	}
+	job.Strict = true
+	out, err = runScript(t, job)
+	if err == nil || strings.Contains(out, "after") {
+		t.Fatalf("strict script should stop at the first failure, output %q", out)
+	}
+}
+
+func TestShellInterpreter(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err == nil {
+		job := &Job{Job: &models.Job{ID: 3, Type: models.JobTypeShell, Interpreter: models.ShellBash, Strict: true,
+			Command: "false | true\necho after"}}
+		// bash 严格模式开启了 pipefail, 管道中任一命令失败即失败
+		if out, err := runScript(t, job); err == nil {
+			t.Fatalf("pipefail is not enabled, output %q", out)
+		}
+	}
+	if _, err := exec.LookPath("python3"); err == nil {
+		job := &Job{Job: &models.Job{ID: 4, Type: models.JobTypeShell, Interpreter: models.ShellPython3,
+			Command: "import sys\nprint(sys.argv[0].endswith('.py'))"}}
+		if out, err := runScript(t, job); err != nil || out != "True\n" {
+			t.Fatalf("output %q err %v", out, err)
+		}
+	}
+	job := &Job{Job: &models.Job{Name: "x", Type: models.JobTypeShell, Interpreter: "ruby", Command: "puts 1"}}
+	if err := job.Check(); err == nil {
+		t.Fatal("expect unknown interpreter error")
+	}
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/dbclient"
+	"crony/common/pkg/utils/errors"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SQLHandler 是在配置的数据源上执行 SQL 语句的处理器
+type SQLHandler struct{}
+
+// sqlExecutor 是 *sql.DB 和 *sql.Tx 共有的执行方法
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Run 方法依次执行任务的 SQL 语句, 输出每条语句影响的行数或结果集
+func (s *SQLHandler) Run(job *Job) (result string, err error) {
+	if job.SQL == nil {
+		return "", fmt.Errorf("%w: sql is required", errors.ErrIllegalSQLSpec)
+	}
+	db, err := openDatasource(job.SQL.Datasource)
+	if err != nil {
+		return
+	}
+	proc := &JobProc{
+		JobProc: &models.JobProc{
+			ID:       nextVirtualProcId(), // SQL任务没有操作系统进程ID
+			JobID:    job.ID,
+			NodeUUID: job.RunOn,
+			JobProcVal: models.JobProcVal{
+				Time: time.Now(),
+			},
+		},
+	}
+	rc := &runningCmd{done: make(chan struct{})}
+	runningCmds.Store(proc.ID, rc)
+	defer runningCmds.Delete(proc.ID)
+	if err = proc.Start(); err != nil {
+		return
+	}
+	defer proc.Stop()
+	return runSQL(db, job, rc)
+}
+
+// openDatasource 返回节点配置中指定名称的数据源
+func openDatasource(name string) (*sql.DB, error) {
+	ds, ok := config.GetConfigModels().Datasources[name]
+	if !ok {
+		return nil, fmt.Errorf("datasource %s is not configured on this node", name)
+	}
+	return dbclient.GetDatasource(name, ds.Driver, ds.Dsn, ds.MaxIdleConns, ds.MaxOpenConns)
+}
+
+// runSQL 在 db 上执行任务的语句, 负责超时控制、事务和终止处理
+func runSQL(db *sql.DB, job *Job, rc *runningCmd) (string, error) {
+	defer close(rc.done)
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if job.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(job.Timeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	// 终止时取消 context, 正在执行的语句被中断, 未提交的事务被回滚
+	rc.setStop(func(grace time.Duration) error {
+		cancel()
+		return nil
+	})
+
+	var b strings.Builder
+	err := execStatements(ctx, db, job, &b)
+	if atomic.LoadInt32(&rc.killed) == 1 {
+		return b.String(), errors.ErrJobKilled
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = &timeoutError{fmt.Errorf("sql job#%d timeout after %ds: %w", job.ID, job.Timeout, err)}
+	}
+	return b.String(), err
+}
+
+// execStatements 依次执行语句并把结果写入 b, 开启事务时任一语句失败都会回滚
+func execStatements(ctx context.Context, db *sql.DB, job *Job, b *strings.Builder) (err error) {
+	spec := job.SQL
+	var exec sqlExecutor = db
+	if spec.Transaction {
+		var tx *sql.Tx
+		if tx, err = db.BeginTx(ctx, nil); err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				_ = tx.Rollback()
+				b.WriteString("-- transaction rolled back\n")
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				err = fmt.Errorf("commit transaction: %w", err)
+				return
+			}
+			b.WriteString("-- transaction committed\n")
+		}()
+		exec = tx
+	}
+	for i, stmt := range spec.GetStatements(job.Command) {
+		if err = execStatement(ctx, exec, spec, i+1, stmt, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execStatement 执行一条语句, 查询语句输出结果集, 其他语句输出影响的行数
+func execStatement(ctx context.Context, exec sqlExecutor, spec *models.SQLSpec, n int, stmt string, b *strings.Builder) error {
+	if spec.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(spec.StatementTimeout)*time.Second)
+		defer cancel()
+	}
+	if !isQueryStatement(stmt) {
+		res, err := exec.ExecContext(ctx, stmt)
+		if err != nil {
+			return statementError(ctx, spec, n, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			fmt.Fprintf(b, "-- [%d] ok\n", n)
+			return nil
+		}
+		fmt.Fprintf(b, "-- [%d] rows affected: %d\n", n, affected)
+		return nil
+	}
+
+	rows, err := exec.QueryContext(ctx, stmt)
+	if err != nil {
+		return statementError(ctx, spec, n, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return statementError(ctx, spec, n, err)
+	}
+	var (
+		lines     []string
+		count     int
+		truncated bool
+		values    = make([]sql.NullString, len(columns))
+		dest      = make([]interface{}, len(columns))
+	)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if count == spec.MaxRows {
+			// 多读一行只用于判断是否被截断
+			truncated = true
+			break
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return statementError(ctx, spec, n, err)
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = "NULL"
+			if v.Valid {
+				cells[i] = v.String
+			}
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return statementError(ctx, spec, n, err)
+	}
+	if truncated {
+		fmt.Fprintf(b, "-- [%d] %d rows (truncated)\n", n, count)
+	} else {
+		fmt.Fprintf(b, "-- [%d] %d rows\n", n, count)
+	}
+	b.WriteString(strings.Join(columns, "\t") + "\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	return nil
+}
+
+// statementError 为语句的错误带上序号, 超过语句超时时间时说明原因
+func statementError(ctx context.Context, spec *models.SQLSpec, n int, err error) error {
+	if spec.StatementTimeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("statement %d timeout after %ds: %w", n, spec.StatementTimeout, err)
+	}
+	return fmt.Errorf("statement %d: %w", n, err)
+}
+
+// isQueryStatement 判断语句是否返回结果集
+func isQueryStatement(stmt string) bool {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimLeft(fields[0], "(")) {
+	case "SELECT", "WITH", "SHOW", "DESC", "DESCRIBE", "EXPLAIN", "VALUES", "PRAGMA":
+		return true
+	}
+	return false
+}
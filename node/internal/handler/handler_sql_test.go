@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"crony/common/models"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSQLTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err = db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, amount INTEGER, note TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newSQLJob(spec *models.SQLSpec) *Job {
+	if err := spec.Check(); err != nil {
+		panic(err)
+	}
+	return &Job{Job: &models.Job{ID: 3, Type: models.JobTypeSQL, SQL: spec}}
+}
+
+func countOrders(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM orders").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRunSQL(t *testing.T) {
+	db := newSQLTestDB(t)
+	job := newSQLJob(&models.SQLSpec{
+		Datasource: "test",
+		Statements: []string{
+			"INSERT INTO orders (amount, note) VALUES (10, 'a'), (20, NULL), (30, 'c')",
+			"UPDATE orders SET amount = amount * 2 WHERE amount > 10",
+			"SELECT id, amount, note FROM orders ORDER BY id",
+		},
+		MaxRows: 2,
+	})
+	output, err := runSQL(db, job, &runningCmd{done: make(chan struct{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "-- [1] rows affected: 3\n" +
+		"-- [2] rows affected: 2\n" +
+		"-- [3] 2 rows (truncated)\n" +
+		"id\tamount\tnote\n" +
+		"1\t10\ta\n" +
+		"2\t40\tNULL\n"
+	if output != expect {
+		t.Fatalf("output is %q", output)
+	}
+}
+
+func TestRunSQLTransaction(t *testing.T) {
+	db := newSQLTestDB(t)
+	statements := []string{
+		"INSERT INTO orders (amount) VALUES (1)",
+		"INSERT INTO no_such_table VALUES (1)",
+	}
+	output, err := runSQL(db, newSQLJob(&models.SQLSpec{Datasource: "test", Statements: statements, Transaction: true}),
+		&runningCmd{done: make(chan struct{})})
+	if err == nil || !strings.Contains(err.Error(), "statement 2") || !strings.Contains(output, "rolled back") {
+		t.Fatalf("output %q err %v", output, err)
+	}
+	if n := countOrders(t, db); n != 0 {
+		t.Fatalf("transaction is not rolled back, %d rows", n)
+	}
+
+	// 不开启事务时, 失败之前的语句已经生效
+	if _, err = runSQL(db, newSQLJob(&models.SQLSpec{Datasource: "test", Statements: statements}),
+		&runningCmd{done: make(chan struct{})}); err == nil {
+		t.Fatal("expect error")
+	}
+	if n := countOrders(t, db); n != 1 {
+		t.Fatalf("expect 1 row without transaction, got %d", n)
+	}
+}
+
+func TestRunSQLStatementTimeout(t *testing.T) {
+	db := newSQLTestDB(t)
+	job := newSQLJob(&models.SQLSpec{Datasource: "test", StatementTimeout: 1})
+	job.Command = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c"
+	_, err := runSQL(db, job, &runningCmd{done: make(chan struct{})})
+	if err == nil || !strings.Contains(err.Error(), "statement 1 timeout") {
+		t.Fatalf("expect statement timeout, got %v", err)
+	}
+}
+
+func TestSQLSpecCheck(t *testing.T) {
+	invalid := []*models.SQLSpec{
+		{},
+		{Datasource: "a", Statements: []string{" "}},
+		{Datasource: "a", StatementTimeout: -1},
+	}
+	for _, spec := range invalid {
+		if err := spec.Check(); err == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+	if err := (&models.Job{Name: "a", Command: "select 1", Type: models.JobTypeSQL}).Check(); err == nil {
+		t.Error("sql job without spec should be invalid")
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"bufio"
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strings"
+)
+
+// loadScript 从数据库读取钩子引用的预设脚本, 测试时可以替换
+var loadScript = func(id int) (*models.Script, error) {
+	script := &models.Script{ID: id}
+	if err := script.FindById(); err != nil {
+		return nil, fmt.Errorf("load script#%d: %w", id, err)
+	}
+	if err := script.Check(); err != nil {
+		return nil, fmt.Errorf("script#%d: %w", id, err)
+	}
+	return script, nil
+}
+
+// runHookCommand 执行钩子脚本的命令, 测试时可以替换为不登记进程的实现
+var runHookCommand = runCommand
+
+// runWithHooks 依次执行 env、pre 钩子、任务本身和 post 钩子
+// 钩子的输出记录在 job.hookOutput 中, 任务的输出和错误与没有钩子时相同
+func runWithHooks(h Handler, job *Job) (output string, err error) {
+	hooks := job.GetHooks()
+	if len(hooks) == 0 {
+		return h.Run(job)
+	}
+	var hb strings.Builder
+	defer func() { job.hookOutput = hb.String() }()
+
+	var env []string
+	for _, hook := range hooks {
+		if hook.Phase != models.HookPhaseEnv {
+			continue
+		}
+		out, herr := runHook(job, hook, &hb)
+		if herr != nil {
+			return "", fmt.Errorf("env hook script#%d: %w", hook.ScriptID, herr)
+		}
+		env = append(env, parseHookEnv(out)...)
+	}
+	if len(env) > 0 {
+		// 只修改本次执行的副本, 不影响调度器中的任务定义
+		jc := *job.Job
+		jc.EnvList = append(append([]string{}, jc.EnvList...), env...)
+		job.Job = &jc
+	}
+	for _, hook := range hooks {
+		if hook.Phase != models.HookPhasePre {
+			continue
+		}
+		if _, herr := runHook(job, hook, &hb); herr != nil {
+			if herr == errors.ErrJobKilled {
+				return "", herr
+			}
+			err = fmt.Errorf("pre hook script#%d: %w", hook.ScriptID, herr)
+			break
+		}
+	}
+	if err == nil {
+		output, err = h.Run(job)
+	}
+	if err == errors.ErrJobKilled {
+		// 被终止的任务不再执行 post 钩子
+		return output, err
+	}
+	for _, hook := range hooks {
+		switch {
+		case hook.Phase == models.HookPhasePost,
+			hook.Phase == models.HookPhasePostSuccess && err == nil,
+			hook.Phase == models.HookPhasePostFailure && err != nil:
+		default:
+			continue
+		}
+		// post 钩子失败只记录在钩子输出中, 不改变任务的执行结果
+		if _, herr := runHook(job, hook, &hb); herr == errors.ErrJobKilled {
+			break
+		}
+	}
+	return output, err
+}
+
+// runHook 执行一个钩子, 将其输出以 `-- [阶段] script#ID 名称: 结果` 为标题写入 hb
+// 钩子与任务使用相同的执行用户、环境变量、资源限制和终止处理, 超时时间未设置时使用任务的超时时间
+func runHook(job *Job, hook models.JobHook, hb *strings.Builder) (string, error) {
+	script, err := loadScript(hook.ScriptID)
+	if err != nil {
+		fmt.Fprintf(hb, "-- [%s] script#%d: %s\n", hook.Phase, hook.ScriptID, err.Error())
+		return "", err
+	}
+	hj := *job.Job
+	if hook.Timeout > 0 {
+		hj.Timeout = hook.Timeout
+	}
+	out, err := runHookCommand(&Job{Job: &hj}, script.Cmd[0], script.Cmd[1:]...)
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+		logger.GetLogger().Warn(fmt.Sprintf("job#%d %s hook script#%d err: %s", job.ID, hook.Phase, hook.ScriptID, result))
+	}
+	fmt.Fprintf(hb, "-- [%s] script#%d %s: %s\n", hook.Phase, hook.ScriptID, script.Name, result)
+	hb.WriteString(out)
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		hb.WriteString("\n")
+	}
+	return out, err
+}
+
+// parseHookEnv 从 env 钩子的输出中取出 KEY=VALUE 格式的行, 其他行被忽略
+func parseHookEnv(out string) []string {
+	var env []string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "export ")
+		if i := strings.IndexByte(line, '='); i > 0 && !strings.ContainsAny(line[:i], " \t#") {
+			env = append(env, line)
+		}
+	}
+	return env
+}
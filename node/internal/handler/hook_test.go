@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// funcHandler 是测试用的处理器
+type funcHandler func(job *Job) (string, error)
+
+func (f funcHandler) Run(job *Job) (string, error) {
+	return f(job)
+}
+
+// useHookScripts 用内存中的脚本和不登记进程的命令执行替换钩子的依赖, 并记录执行过的脚本
+func useHookScripts(t *testing.T, scripts map[int]string) *[]string {
+	t.Helper()
+	logger.Init(t.TempDir(), "error", "console", "", "logs", false, "", "", false)
+	var ran []string
+	oldLoad, oldRun := loadScript, runHookCommand
+	loadScript = func(id int) (*models.Script, error) {
+		command, ok := scripts[id]
+		if !ok {
+			return nil, fmt.Errorf("script#%d not found", id)
+		}
+		s := &models.Script{ID: id, Name: fmt.Sprintf("s%d", id), Command: command}
+		return s, s.Check()
+	}
+	runHookCommand = func(job *Job, name string, args ...string) (string, error) {
+		ran = append(ran, strings.Join(append([]string{name}, args...), " "))
+		cmd := exec.Command(name, args...)
+		cmd.Env = job.EnvList
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	t.Cleanup(func() { loadScript, runHookCommand = oldLoad, oldRun })
+	return &ran
+}
+
+func TestRunWithHooks(t *testing.T) {
+	ran := useHookScripts(t, map[int]string{
+		1: `sh -c "echo WARM=1; echo not env"`,
+		2: "echo warmup",
+		3: "echo cleanup",
+		4: "echo on-success",
+		5: "echo on-failure",
+	})
+	job := &Job{Job: &models.Job{ID: 1, Hooks: []models.JobHook{
+		{ScriptID: 3, Phase: models.HookPhasePost},
+		{ScriptID: 4, Phase: models.HookPhasePostSuccess},
+		{ScriptID: 5, Phase: models.HookPhasePostFailure},
+		{ScriptID: 1, Phase: models.HookPhaseEnv},
+		{ScriptID: 2, Phase: models.HookPhasePre},
+	}}}
+	var env []string
+	output, err := runWithHooks(funcHandler(func(run *Job) (string, error) {
+		env = run.EnvList
+		return "main", nil
+	}), job)
+	if err != nil || output != "main" {
+		t.Fatalf("output %q err %v", output, err)
+	}
+	if len(env) != 1 || env[0] != "WARM=1" || len(job.Job.EnvList) != 1 {
+		t.Fatalf("env is %v", env)
+	}
+	if len(*ran) != 4 || (*ran)[1] != "echo warmup" || (*ran)[3] != "echo on-success" {
+		t.Fatalf("ran %q", *ran)
+	}
+	expect := "-- [env] script#1 s1: ok\nWARM=1\nnot env\n-- [pre] script#2 s2: ok\nwarmup\n" +
+		"-- [post] script#3 s3: ok\ncleanup\n-- [post_success] script#4 s4: ok\non-success\n"
+	if job.hookOutput != expect {
+		t.Fatalf("hook output is %q", job.hookOutput)
+	}
+}
+
+func TestRunWithHooksPreFailure(t *testing.T) {
+	ran := useHookScripts(t, map[int]string{1: "false", 3: "echo cleanup", 5: "echo on-failure"})
+	job := &Job{Job: &models.Job{ID: 1, ScriptIDArray: []int{1}, Hooks: []models.JobHook{
+		{ScriptID: 3, Phase: models.HookPhasePost},
+		{ScriptID: 5, Phase: models.HookPhasePostFailure},
+	}}}
+	called := false
+	_, err := runWithHooks(funcHandler(func(*Job) (string, error) {
+		called = true
+		return "", nil
+	}), job)
+	if err == nil || !strings.Contains(err.Error(), "pre hook script#1") || called {
+		t.Fatalf("expect pre hook failure without running job, err %v called %v", err, called)
+	}
+	if len(*ran) != 3 {
+		t.Fatalf("ran %q", *ran)
+	}
+
+	// 被终止的任务不执行 post 钩子
+	*ran = nil
+	_, err = runWithHooks(funcHandler(func(*Job) (string, error) {
+		return "", cronyErrors.ErrJobKilled
+	}), &Job{Job: &models.Job{ID: 1, Hooks: []models.JobHook{{ScriptID: 3, Phase: models.HookPhasePost}}}})
+	if !errors.Is(err, cronyErrors.ErrJobKilled) || len(*ran) != 0 {
+		t.Fatalf("err %v ran %q", err, *ran)
+	}
+}
+
+func TestJobHookCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Hooks: []models.JobHook{{Phase: models.HookPhasePre}}},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Hooks: []models.JobHook{{ScriptID: 1, Phase: "before"}}},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Hooks: []models.JobHook{{ScriptID: 1, Phase: models.HookPhasePost, Timeout: -1}}},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalJobHook) {
+			t.Errorf("job %+v: expect ErrIllegalJobHook, got %v", job, err)
+		}
+	}
+	env := parseHookEnv("A=1\nexport B=2\n# C=3\nnot env\nD E=4\n")
+	if strings.Join(env, ",") != "A=1,B=2" {
+		t.Fatalf("env is %v", env)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/etcd/clientv3"
@@ -22,6 +23,15 @@ import (
 // Job 结构体用于封装models.Job
 type Job struct {
 	*models.Job
+
+	usage         *ResourceUsage // 本次执行的资源使用情况, 只在 newRun 返回的副本上设置
+	hookOutput    string         // 本次执行的钩子输出, 只在 newRun 返回的副本上设置
+	workflowRunId int            // 作为工作流步骤执行时所属的运行ID, 只在 RunStep 使用的任务上设置
+}
+
+// newRun 返回用于一次执行的副本, 并发的多次执行各自记录资源使用情况
+func (j *Job) newRun() *Job {
+	return &Job{Job: j.Job}
 }
 
 // Jobs 是一个map，用于存储一组Job，其中键是作业的ID，值是指向Job实例的指针
@@ -61,12 +71,14 @@ func GetJobAndRev(nodeUUID string, jobId int) (job *Job, rev int64, err error) {
 }
 
 // GetJobs 函数用于从etcd中获取制定节点上的所有任务
-func GetJobs(nodeUUID string) (jobs Jobs, err error) {
+// rev 为读取时 etcd 的版本号, 从它之后开始监听才不会漏掉读取之后的变化
+func GetJobs(nodeUUID string) (jobs Jobs, rev int64, err error) {
 	// 使用前缀查询获取该节点下的所有任务
 	resp, err := etcdclient.Get(fmt.Sprintf(etcdclient.KeyEtcdJobProfile, nodeUUID), clientv3.WithPrefix())
 	if err != nil {
 		return
 	}
+	rev = resp.Header.Revision
 
 	count := len(resp.Kvs)
 	jobs = make(Jobs, count)
@@ -94,7 +106,8 @@ func GetJobs(nodeUUID string) (jobs Jobs, err error) {
 }
 
 // RunWithRecovery 一个安全执行任务的方法，包含panic恢复机制
-func (j *Job) RunWithRecovery() {
+// 返回本次执行的日志ID、输出和执行错误
+func (j *Job) RunWithRecovery() (jobLogId int, result string, runErr error) {
 	defer func() {
 		// 使用defer和recover来捕获任务执行过程中的panic
 		if r := recover(); r != nil {
@@ -102,27 +115,38 @@ func (j *Job) RunWithRecovery() {
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)] // 获取panic发生时的堆栈信息
 			logger.GetLogger().Warn(fmt.Sprintf("panic running job: %v\n%s", r, buf))
+			runErr = fmt.Errorf("panic running job: %v", r)
 		}
 	}()
 	t := time.Now()
 	// 为执行创建一条日志记录
-	jobLogId, err := j.CreateJobLog()
+	jobLogId, err := j.CreateJobLog(time.Time{}, false)
 	if err != nil {
-		logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s", j.ID, j.RunOn, err.Error()))
+		logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 	}
 	// 根据任务类型创建对应的执行处理器
-	h := CreateHandler(j)
-	if h == nil {
+	h, runErr := CreateHandler(j)
+	if runErr != nil {
+		if err = j.Fail(jobLogId, t, runErr.Error(), 0); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
+		}
 		return
 	}
 	// 执行任务
-	result, runErr := h.Run(j)
-	if runErr != nil {
+	run := j.newRun()
+	result, runErr = runWithHooks(h, run)
+	run.recordAttempt(jobLogId, 0, t, result, runErr, 0)
+	if runErr == errors.ErrJobKilled {
+		// 被主动终止的任务只记录日志, 不发送失败通知
+		if err = run.Killed(jobLogId, t, result, 0); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
+		}
+	} else if runErr != nil {
 		// 如果任务执行失败
 		// 1. 更新任务日志为失败状态
-		err = j.Fail(jobLogId, t, runErr.Error(), 0)
+		err = run.Fail(jobLogId, t, runErr.Error(), 0)
 		if err != nil {
-			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s", j.ID, j.RunOn, err.Error()))
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 		}
 		// 2. 准备发送失败通知
 		node := &models.Node{UUID: j.RunOn}
@@ -154,101 +178,179 @@ func (j *Job) RunWithRecovery() {
 		go notify.Send(msg)
 	} else {
 		// 如果任务执行成功，更新日志为成功状态
-		err = j.Success(jobLogId, t, result, 0)
+		err = run.Success(jobLogId, t, result, 0)
 		if err != nil {
-			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID"))
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 		}
 	}
+	return
 }
 
 // CreateJob 函数用于将一个Job对象包装成一个cron库可以执行的`cron.FuncJob`函数
-func CreateJob(j *Job) cron.FuncJob {
-	h := CreateHandler(j)
-	if h == nil {
-		return nil
+// 任务类型没有注册处理器时返回 ErrUnknownJobType
+func CreateJob(j *Job) (cron.FuncJob, error) {
+	h, err := CreateHandler(j)
+	if err != nil {
+		return nil, err
 	}
+	sched, err := j.ParseSchedule()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu   sync.Mutex
+		prev = time.Now()
+	)
 	// 返回一个闭包函数，这个函数就是cron调度器实际执行的内容
 	jobFunc := func() {
-		logger.GetLogger().Info(fmt.Sprintf("start the job#%s#command-%s", j.Name, j.Command))
-		var execTimes int = 1
-		if j.RetryTimes > 0 {
-			// 计算总执行次数 = 1次正常执行 + N次重试
-			execTimes += j.RetryTimes
-		}
-		var i = 0
-		var output string
-		var runErr error
-		var err error
-		var jobLogId int
-		t := time.Now()
-		// 创建初始的任务日志
-		jobLogId, err = j.CreateJobLog()
-		if err != nil {
-			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job with jobId:%s nodeUUID: %s error:%s", j.ID, j.RunOn, err.Error()))
-		}
-		// 循环执行，直到成功或达到最大次数
-		for i < execTimes {
-			output, runErr = h.Run(j)
-			if runErr == nil {
-				// 执行成功，更新日志并直接返回
-				err = j.Success(jobLogId, t, output, i)
-				if err != nil {
-					logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID: %d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
-				}
+		// 调度时刻由定时表达式推算, 不取回调时的本地时间, 各节点的时钟偏差和回调延迟不会改变独占锁的 key
+		mu.Lock()
+		fireTime := scheduledFireTime(sched, prev, time.Now())
+		prev = fireTime
+		mu.Unlock()
+		j.fire(h, fireTime, false)
+	}
+	return jobFunc, nil
+}
+
+// fire 执行任务在调度时刻 fireTime 的一次调度, catchUp 表示这是节点恢复后对错过调度的补执行
+// 独占、日历和并发策略对补执行同样生效
+func (j *Job) fire(h Handler, fireTime time.Time, catchUp bool) {
+	// 记录最近一次调度时刻, 节点恢复后据此计算错过的调度
+	j.recordFire(fireTime)
+	if j.Exclusive {
+		ok, err := j.TryExclusive(fireTime)
+		if err != nil || !ok {
+			// 无法确认执行权时宁可跳过, 也不能让多个节点同时执行
+			reason := fmt.Sprintf("skipped: job#%d at %d is running on another node", j.ID, fireTime.Unix())
+			if err != nil {
+				reason = fmt.Sprintf("skipped: get exclusive lock of job#%d at %d err: %s", j.ID, fireTime.Unix(), err.Error())
 			}
-			i++
-			if i < execTimes {
-				// 如果还未达到最大次数，准备重试
-				logger.GetLogger().Warn(fmt.Sprintf("job execution failure%jobId-%d %retry %d times #output-%s#error-%v", j.ID, i, output, runErr))
-				if j.RetryInterval > 0 {
-					time.Sleep(time.Duration(j.RetryInterval) * time.Second)
-				} else {
-					// 默认的重试是递增的，每次增加1分钟
-					time.Sleep(time.Duration(i) * time.Minute)
-				}
+			logger.GetLogger().Info(reason)
+			if err = j.Skip(fireTime, catchUp, reason); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 			}
+			return
 		}
-		// 所有尝试都失败后，更新日志为失败状态
-		err = j.Fail(jobLogId, t, runErr.Error(), execTimes-1)
-		if err != nil {
-			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job with jobID:%d nodeID: %s error: %s", j.ID, j.RunOn, err.Error()))
+	}
+	// 日历规则在拿到独占执行权之后判断, 跳过记录在集群内只写一条
+	if reason := j.checkCalendars(fireTime); reason != "" {
+		logger.GetLogger().Info(reason)
+		if err := j.Skip(fireTime, catchUp, reason); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 		}
-		// 发送最终失败的通知
-		node := &models.Node{UUID: j.RunOn}
-		err = node.FindByUUID()
-		if err != nil {
-			logger.GetLogger().Warn(fmt.Sprintf("Failed to find node with jobID: %d nodeUUID: %s error:%s", j.ID, j.RunOn, err.Error()))
+		return
+	}
+	ctx, release, reason := j.applyConcurrency()
+	if reason != "" {
+		logger.GetLogger().Info(reason)
+		if err := j.Skip(fireTime, catchUp, reason); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 		}
-		var to []string
-		for _, userId := range j.NotifyToArray {
-			userModel := &models.User{ID: userId}
-			err = userModel.FindById()
+		return
+	}
+	defer release()
+	logger.GetLogger().Info(fmt.Sprintf("start the job#%s#command-%s", j.Name, j.Command))
+	policy := j.GetRetryPolicy()
+	var (
+		i        int // 已经失败的次数
+		output   string
+		runErr   error
+		err      error
+		jobLogId int
+		run      *Job
+	)
+	t := time.Now()
+	// 创建初始的任务日志
+	jobLogId, err = j.CreateJobLog(fireTime, catchUp)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job with jobId:%d nodeUUID: %s error:%s", j.ID, j.RunOn, err.Error()))
+	}
+	// 循环执行，直到成功、被终止或重试策略不再允许重试
+	for ; ; i++ {
+		run = j.newRun()
+		start := time.Now()
+		output, runErr = runWithHooks(h, run)
+		if runErr == nil {
+			// 执行成功，更新日志并直接返回
+			run.recordAttempt(jobLogId, i, start, output, nil, 0)
+			err = run.Success(jobLogId, t, output, i)
 			if err != nil {
-				continue
+				logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID: %d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 			}
-			if j.NotifyType == notify.NotifyTypeMail {
-				to = append(to, userModel.Email)
-			} else if j.NotifyType == notify.NotifyTypeWebHook && config.GetConfigModels().WebHook.Kind == "feishu" {
-				to = append(to, userModel.UserName)
+			return
+		}
+		if runErr == errors.ErrJobKilled {
+			// 被主动终止的任务不再重试, 也不发送失败通知
+			run.recordAttempt(jobLogId, i, start, output, runErr, 0)
+			err = run.Killed(jobLogId, t, output, i)
+			if err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID: %d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
 			}
+			return
 		}
-		msg := &notify.Message{
-			Type:      j.NotifyType,
-			IP:        fmt.Sprintf("%s:%s", node.IP, node.PID),
-			Subject:   fmt.Sprintf("任务[%s]执行失败", j.Name),
-			Body:      fmt.Sprintf("job[%d] run on node[%s] execute failed ,retry %d times ,output :%s, error:%v", j.ID, j.RunOn, j.RetryTimes, output, runErr),
-			To:        to,
-			OccurTime: time.Now().Format(utils.TimeFormatSecond),
+		delay, retry := nextRetry(policy, i+1, j.RetryTimes, time.Since(t), runErr)
+		run.recordAttempt(jobLogId, i, start, output, runErr, delay)
+		if !retry {
+			break
 		}
-		go notify.Send(msg)
+		// 按重试策略等待后重试
+		logger.GetLogger().Warn(fmt.Sprintf("job execution failure#jobId-%d#retry %d times after %s#output-%s#error-%v", j.ID, i+1, delay, output, runErr))
+		select {
+		case <-ctx.Done():
+			// 等待期间本次调度被终止(如 Replace 策略下被新的调度替换), 不再重试
+			err = run.Killed(jobLogId, t, output, i)
+			if err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID: %d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
+			}
+			return
+		case <-time.After(delay):
+		}
+	}
+	// 不再重试后，更新日志为失败状态
+	err = run.Fail(jobLogId, t, runErr.Error(), i)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job with jobID:%d nodeID: %s error: %s", j.ID, j.RunOn, err.Error()))
 	}
-	return jobFunc
+	// 发送最终失败的通知
+	node := &models.Node{UUID: j.RunOn}
+	err = node.FindByUUID()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("Failed to find node with jobID: %d nodeUUID: %s error:%s", j.ID, j.RunOn, err.Error()))
+	}
+	var to []string
+	for _, userId := range j.NotifyToArray {
+		userModel := &models.User{ID: userId}
+		err = userModel.FindById()
+		if err != nil {
+			continue
+		}
+		if j.NotifyType == notify.NotifyTypeMail {
+			to = append(to, userModel.Email)
+		} else if j.NotifyType == notify.NotifyTypeWebHook && config.GetConfigModels().WebHook.Kind == "feishu" {
+			to = append(to, userModel.UserName)
+		}
+	}
+	msg := &notify.Message{
+		Type:      j.NotifyType,
+		IP:        fmt.Sprintf("%s:%s", node.IP, node.PID),
+		Subject:   fmt.Sprintf("任务[%s]执行失败", j.Name),
+		Body:      fmt.Sprintf("job[%d] run on node[%s] execute failed ,retry %d times ,output :%s, error:%v", j.ID, j.RunOn, i, output, runErr),
+		To:        to,
+		OccurTime: time.Now().Format(utils.TimeFormatSecond),
+	}
+	go notify.Send(msg)
 }
 
 // WatchJobs 函数用于在etcd上为指定节点的任务创建一个监视器
-func WatchJobs(nodeUUID string) clientv3.WatchChan {
+// 从版本号 rev 之后开始监听, rev 为 0 时从当前版本开始
+func WatchJobs(nodeUUID string, rev int64) clientv3.WatchChan {
 	// 监视指定前缀下的所有键值变化
-	return etcdclient.Watch(fmt.Sprintf(etcdclient.KeyEtcdJobProfile, nodeUUID), clientv3.WithPrefix())
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	return etcdclient.Watch(fmt.Sprintf(etcdclient.KeyEtcdJobProfile, nodeUUID), opts...)
 }
 
 // GetJobIDFromKey 是一个工具函数，用于从etcd的key中解析出任务ID
@@ -267,43 +369,92 @@ func GetJobIDFromKey(key string) int {
 }
 
 // CreateJobLog 方法用于为任务的一次执行创建一个日志条目
-func (j *Job) CreateJobLog() (int, error) {
+// fireTime 为本次执行对应的调度时刻, 立即执行时为零值; catchUp 表示是否为补执行
+func (j *Job) CreateJobLog(fireTime time.Time, catchUp bool) (int, error) {
 	start := time.Now()
 	jobLog := &models.JobLog{
-		Name:      j.Name,
-		JobId:     j.ID,
-		Command:   j.Command,
-		IP:        j.Ip,
-		Hostname:  j.Hostname,
-		NodeUUID:  j.RunOn,
-		Spec:      j.Spec,
-		StartTime: start.Unix(),
+		Name:          j.Name,
+		JobId:         j.ID,
+		Command:       j.Command,
+		IP:            j.Ip,
+		Hostname:      j.Hostname,
+		NodeUUID:      j.RunOn,
+		Spec:          j.Spec,
+		TimeZone:      j.ZoneName(),
+		CatchUp:       catchUp,
+		WorkflowRunID: j.workflowRunId,
+		StartTime:     start.Unix(),
+	}
+	if !fireTime.IsZero() {
+		jobLog.FireTime = fireTime.Unix()
 	}
 	// 将日志插入数据库并返回新日志的ID
 	return jobLog.Insert()
 }
 
 // UpdateJobLog 函数用于更新制定的任务日志条目
-func UpdateJobLog(jobLogId int, start time.Time, output string, retry int, success bool) error {
+// usage 为 nil 时不记录资源使用情况, hookOutput 为钩子脚本的输出
+func UpdateJobLog(jobLogId int, start time.Time, output string, retry int, status int, usage *ResourceUsage, hookOutput string) error {
 	end := time.Now()
+	// output 超过列长度时 MySQL 严格模式下更新失败, 日志会一直停留在执行中
+	output = utils.Truncate(output, models.JobLogOutputSize)
 	jobLog := &models.JobLog{
 		ID:         jobLogId,
 		StartTime:  start.Unix(),
-		RetryTimes: retry,      // 记录重试次数
-		Success:    success,    // 记录成功或失败
-		Output:     output,     // 记录输出或错误信息
-		EndTime:    end.Unix(), // 记录结束时间
+		RetryTimes: retry,                                // 记录重试次数
+		Success:    status == models.JobLogStatusSuccess, // 记录成功或失败
+		Status:     status,                               // 记录执行状态
+		Output:     output,                               // 记录输出或错误信息
+		EndTime:    end.Unix(),                           // 记录结束时间
+		HookOutput: hookOutput,                           // 记录钩子的输出
+	}
+	if usage != nil {
+		jobLog.PeakMemory = usage.PeakMemory
+		jobLog.CpuTime = usage.CpuTime
 	}
 	// 更新数据库中的日志记录
 	return jobLog.Update()
 }
 
+// recordAttempt 为一次尝试写入一条记录, nextDelay 为下一次重试前的等待时间, 不再重试时为 0
+func (j *Job) recordAttempt(jobLogId, attempt int, start time.Time, output string, runErr error, nextDelay time.Duration) {
+	if jobLogId <= 0 {
+		return
+	}
+	a := &models.JobLogAttempt{
+		JobLogId:   jobLogId,
+		JobId:      j.ID,
+		Attempt:    attempt,
+		Status:     models.JobLogStatusSuccess,
+		Output:     output,
+		HookOutput: j.hookOutput,
+		StartTime:  start.Unix(),
+		Duration:   time.Since(start).Milliseconds(),
+		NextDelay:  nextDelay.Milliseconds(),
+	}
+	if runErr != nil {
+		a.Status = models.JobLogStatusFail
+		if runErr == errors.ErrJobKilled {
+			a.Status = models.JobLogStatusKilled
+		}
+		a.Error = runErr.Error()
+	}
+	if err := a.Insert(); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log attempt with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
+	}
+}
+
 // Success 是一个辅助方法，用于将任务日志标记为成功
 func (j *Job) Success(jobLogId int, start time.Time, output string, retry int) error {
-	return UpdateJobLog(jobLogId, start, output, retry, true)
+	return UpdateJobLog(jobLogId, start, output, retry, models.JobLogStatusSuccess, j.usage, j.hookOutput)
 }
 
 // Fail 是一个辅助方法，用于将任务日志标记为失败
 func (j *Job) Fail(jobLogId int, start time.Time, errMsg string, retry int) error {
-	return UpdateJobLog(jobLogId, start, errMsg, retry, false)
+	return UpdateJobLog(jobLogId, start, errMsg, retry, models.JobLogStatusFail, j.usage, j.hookOutput)
+}
+
+// Killed 是一个辅助方法，用于将任务日志标记为被终止
+func (j *Job) Killed(jobLogId int, start time.Time, output string, retry int) error {
+	return UpdateJobLog(jobLogId, start, output, retry, models.JobLogStatusKilled, j.usage, j.hookOutput)
 }
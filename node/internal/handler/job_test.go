@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWatchJobsFromRev(t *testing.T) {
+	startEmbedEtcd(t)
+	job := &models.Job{ID: 1, Name: "a", Command: "ls", Type: models.JobTypeCmd, Spec: "0 * * * * *"}
+	b, _ := json.Marshal(job)
+	if _, err := etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdJob, "node", 1), string(b)); err != nil {
+		t.Fatal(err)
+	}
+	jobs, rev, err := GetJobs("node")
+	if err != nil || len(jobs) != 1 || rev == 0 {
+		t.Fatalf("jobs %v rev %d err %v", jobs, rev, err)
+	}
+	// 读取之后、开始监听之前写入的任务同样能收到
+	job.ID = 2
+	b, _ = json.Marshal(job)
+	if _, err = etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdJob, "node", 2), string(b)); err != nil {
+		t.Fatal(err)
+	}
+	rch := WatchJobs("node", rev)
+	select {
+	case wresp := <-rch:
+		if len(wresp.Events) != 1 || GetJobIDFromKey(string(wresp.Events[0].Kv.Key)) != 2 {
+			t.Fatalf("events %v", wresp.Events)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job written after rev is not watched")
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/schedule"
+	"crony/common/pkg/utils"
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jakecoffman/cron"
+)
+
+// maxMisfireScan 是计算错过的调度时最多遍历的调度时刻数, 防止间隔很短的表达式在长时间宕机后遍历过久
+const maxMisfireScan = 100000
+
+// fireKey 返回记录任务最近一次调度时刻的 key
+func fireKey(jobId int) string {
+	return fmt.Sprintf(etcdclient.KeyEtcdFire, jobId)
+}
+
+// ParseSchedule 按任务的时区和夏令时处理方式解析定时表达式
+func (j *Job) ParseSchedule() (cron.Schedule, error) {
+	loc, err := j.Location()
+	if err != nil {
+		return nil, err
+	}
+	return schedule.Parse(j.Spec, loc, j.DstGap == models.DstGapSkip)
+}
+
+// scheduledFireTime 返回 prev 之后、不晚于 now 的最后一个调度时刻, 即调度器本次回调对应的调度时刻
+// 回调晚了不止一个调度周期时取其中最近的一个; 回调早于调度时刻时取 prev 之后的第一个
+func scheduledFireTime(sched cron.Schedule, prev, now time.Time) time.Time {
+	fireTime := sched.Next(prev)
+	if fireTime.IsZero() {
+		return now.Truncate(time.Second)
+	}
+	for {
+		next := sched.Next(fireTime)
+		if next.IsZero() || next.After(now) {
+			return fireTime
+		}
+		fireTime = next
+	}
+}
+
+// recordFire 把 fireTime 写入 /crony/fire/<job_id>
+// 补执行与调度器的触发可能交错, 只有比已记录的时刻更晚时才写入, 避免记录回退
+func (j *Job) recordFire(fireTime time.Time) {
+	key := fireKey(j.ID)
+	for i := 0; i < 3; i++ {
+		resp, err := etcdclient.Get(key)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("get last fire of job#%d err: %s", j.ID, err.Error()))
+			return
+		}
+		var rev int64
+		if resp.Count > 0 {
+			last, _ := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+			if last >= fireTime.Unix() {
+				return
+			}
+			rev = resp.Kvs[0].ModRevision
+		}
+		_, err = etcdclient.PutWithModRev(key, strconv.FormatInt(fireTime.Unix(), 10), rev)
+		if err != errors.ErrValueMayChanged {
+			if err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("record fire of job#%d err: %s", j.ID, err.Error()))
+			}
+			return
+		}
+	}
+}
+
+// LastFire 返回任务最近一次调度时刻
+// 优先使用 /crony/fire/<job_id> 中的记录, 没有时使用最近一次执行成功的作业日志的开始时间, 都没有时返回零值
+func (j *Job) LastFire() (time.Time, error) {
+	resp, err := etcdclient.Get(fireKey(j.ID))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if resp.Count > 0 {
+		last, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+		if err == nil {
+			return time.Unix(last, 0), nil
+		}
+	}
+	jobLog := &models.JobLog{JobId: j.ID}
+	if err = jobLog.FindLastSuccess(); err != nil {
+		// 任务从未执行成功过, 没有可以参照的时刻
+		return time.Time{}, nil
+	}
+	return time.Unix(jobLog.StartTime, 0), nil
+}
+
+// MissedFires 返回 (last, now] 之间错过的调度时刻, 按时间顺序排列, 最多遍历 maxMisfireScan 个调度时刻
+func (j *Job) MissedFires(last, now time.Time) ([]time.Time, error) {
+	if last.IsZero() || j.Spec == "" {
+		return nil, nil
+	}
+	s, err := j.ParseSchedule()
+	if err != nil {
+		return nil, err
+	}
+	var fires []time.Time
+	t := last
+	for i := 0; i < maxMisfireScan; i++ {
+		if t = s.Next(t); t.IsZero() || t.After(now) {
+			break
+		}
+		fires = append(fires, t)
+	}
+	return fires, nil
+}
+
+// CatchUp 按任务的 misfire 策略补执行 now 之前错过的调度, now 为任务加入调度器的时刻
+// 错过的调度多于策略允许的次数时只补执行最近的几次, 其余的合并记录为一条跳过日志
+// 补执行依次进行, 每次都记录为一条 catch_up 为 true 的作业日志
+func (j *Job) CatchUp(now time.Time) {
+	last, err := j.LastFire()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("get last fire of job#%d err: %s", j.ID, err.Error()))
+		return
+	}
+	fires, err := j.MissedFires(last, now)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("get missed fires of job#%d err: %s", j.ID, err.Error()))
+		return
+	}
+	if len(fires) == 0 {
+		return
+	}
+	if n := len(fires) - j.MisfireLimit(); n > 0 {
+		skipped := fires[n-1]
+		reason := fmt.Sprintf("skipped: job#%d missed %d runs from %s to %s, misfire policy is %s", j.ID, n,
+			fires[0].In(j.location()).Format(utils.TimeFormatSecond+" MST"),
+			skipped.In(j.location()).Format(utils.TimeFormatSecond+" MST"), j.misfirePolicy())
+		logger.GetLogger().Info(reason)
+		// 独占任务的多个节点同时恢复时, 只由拿到执行权的节点写入跳过记录
+		if ok, _ := j.tryExclusiveOrLocal(skipped); ok {
+			if err = j.Skip(skipped, true, reason); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("Failed to write to job log with jobID:%d nodeUUID: %s error: %s", j.ID, j.RunOn, err.Error()))
+			}
+		}
+		// 推进记录的调度时刻, 下次恢复时不再重复计算这些调度
+		j.recordFire(skipped)
+		fires = fires[n:]
+	}
+	if len(fires) == 0 {
+		return
+	}
+	h, err := CreateHandler(j)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("catch up job#%d err: %s", j.ID, err.Error()))
+		return
+	}
+	for _, f := range fires {
+		logger.GetLogger().Info(fmt.Sprintf("catch up job#%d missed at %s", j.ID, f.In(j.location()).Format(utils.TimeFormatSecond+" MST")))
+		j.fire(h, f, true)
+	}
+}
+
+// tryExclusiveOrLocal 独占任务尝试获取 fireTime 的执行权, 非独占任务直接返回 true
+func (j *Job) tryExclusiveOrLocal(fireTime time.Time) (bool, error) {
+	if !j.Exclusive {
+		return true, nil
+	}
+	return j.TryExclusive(fireTime)
+}
+
+// misfirePolicy 返回任务错过调度时的处理方式, 未设置时为 ignore
+func (j *Job) misfirePolicy() string {
+	if j.Misfire == "" {
+		return models.MisfireIgnore
+	}
+	return j.Misfire
+}
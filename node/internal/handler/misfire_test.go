@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMissedFires(t *testing.T) {
+	job := &Job{Job: &models.Job{ID: 1, Spec: "0 0 * * * *", TimeZone: "UTC"}}
+	last := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	fires, err := job.MissedFires(last, time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上一次调度不算错过, now 本身的调度算作错过
+	expect := []int{11, 12, 13, 14}
+	if len(fires) != len(expect) {
+		t.Fatalf("missed fires %v, expect hours %v", fires, expect)
+	}
+	for i, f := range fires {
+		if f.UTC().Hour() != expect[i] {
+			t.Fatalf("missed fires %v, expect hours %v", fires, expect)
+		}
+	}
+	if fires, _ = job.MissedFires(time.Time{}, last); len(fires) != 0 {
+		t.Fatalf("job without last fire should not catch up, got %v", fires)
+	}
+}
+
+func TestMisfireCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Misfire: "sometimes"},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Misfire: models.MisfireRunAll, MisfireCap: -1},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, Misfire: models.MisfireRunAll, MisfireCap: models.MaxMisfireCap + 1},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalMisfire) {
+			t.Errorf("job %+v: expect ErrIllegalMisfire, got %v", job, err)
+		}
+	}
+	cases := []struct {
+		misfire string
+		cap     int
+		limit   int
+	}{
+		{"", 5, 0},
+		{models.MisfireIgnore, 0, 0},
+		{models.MisfireRunOnce, 5, 1},
+		{models.MisfireRunAll, 0, models.DefaultMisfireCap},
+		{models.MisfireRunAll, 5, 5},
+	}
+	for _, c := range cases {
+		job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, Misfire: c.misfire, MisfireCap: c.cap}
+		if err := job.Check(); err != nil {
+			t.Fatal(err)
+		}
+		if limit := job.MisfireLimit(); limit != c.limit {
+			t.Errorf("misfire %q cap %d: limit is %d, expect %d", c.misfire, c.cap, limit, c.limit)
+		}
+	}
+}
+
+func TestScheduledFireTime(t *testing.T) {
+	job := &Job{Job: &models.Job{ID: 1, Spec: "0 */5 * * * *", TimeZone: "UTC"}}
+	sched, err := job.ParseSchedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	expect := time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC)
+	// 各节点回调的时刻不同, 得到的调度时刻相同
+	for _, now := range []time.Time{expect, expect.Add(900 * time.Millisecond), expect.Add(2 * time.Second), expect.Add(-300 * time.Millisecond)} {
+		if got := scheduledFireTime(sched, prev, now); !got.Equal(expect) {
+			t.Fatalf("fire time at %s is %s, expect %s", now, got, expect)
+		}
+	}
+	// 回调晚了不止一个周期时取最近的调度时刻
+	if got := scheduledFireTime(sched, prev, expect.Add(11*time.Minute)); !got.Equal(expect.Add(10 * time.Minute)) {
+		t.Fatalf("fire time of late callback is %s", got)
+	}
+}
@@ -1,11 +1,23 @@
 package handler
 
 import (
+	"crony/common/models"
 	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/utils"
+	"crony/common/pkg/utils/errors"
+	"encoding/json"
+	"fmt"
 
 	"github.com/coreos/etcd/clientv3"
 )
 
+// OnceResultTtl 是一次性执行结果在 etcd 中的保留时长(秒), 供等待方读取, 与触发 key 的租约时长相同
+const OnceResultTtl = models.OnceTtl
+
+// MaxResultOutput 是写回 etcd 的执行结果中输出和错误信息的最大长度(字节)
+// 一次性执行和工作流步骤的结果都写入 etcd, 完整的输出过大时会超过 etcd 的请求大小限制
+const MaxResultOutput = 64 * 1024
+
 // WatchOnce 函数用于创建一个etcd的watch通道，专门用于监听一次性任务
 func WatchOnce() clientv3.WatchChan {
 	// 调用etcd客户端的Watch方法，监听预定义的“一次性任务”的key前缀
@@ -13,3 +25,56 @@ func WatchOnce() clientv3.WatchChan {
 	// clientv3.WithPrefix() 用于监听所有以此key为前缀的键值对的变化
 	return etcdclient.Watch(etcdclient.KeyEtcdOnceProfile, clientv3.WithPrefix())
 }
+
+// TryOnce 函数在目标为 "any" 时争抢一次触发的执行权, 同一次触发只有一个节点能拿到
+func TryOnce(jobId int, triggerRev int64) (bool, error) {
+	lease, err := etcdclient.Grant(OnceResultTtl)
+	if err != nil {
+		return false, err
+	}
+	ok, err := etcdclient.GetLock(fmt.Sprintf("once-%d-%d", jobId, triggerRev), lease.ID)
+	if err != nil || !ok {
+		_, _ = etcdclient.Revoke(lease.ID)
+	}
+	return ok, err
+}
+
+// PutOnceResult 函数将一次性执行的结果写入 /crony/once-result/<job_id>/<node_uuid>
+// 输出和错误信息超过 MaxResultOutput 时截断
+func PutOnceResult(result *models.JobOnceResult) error {
+	result.Output = utils.Truncate(result.Output, MaxResultOutput)
+	result.Error = utils.Truncate(result.Error, MaxResultOutput)
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = etcdclient.PutWithTtl(fmt.Sprintf(etcdclient.KeyEtcdOnceResult, result.JobID, result.NodeUUID), string(b), OnceResultTtl)
+	return err
+}
+
+// FinishOnce 函数在一次触发的全部目标节点都写回结果后删除触发 key
+// 删除时比较 ModRevision, 不会误删在此期间重新写入的触发
+func FinishOnce(jobId int, triggerRev int64, targets []string) error {
+	if !models.IsOnceTargetAny(targets) {
+		resp, err := etcdclient.Get(fmt.Sprintf(etcdclient.KeyEtcdJobOnceResultProfile, jobId), clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		done := 0
+		for _, kv := range resp.Kvs {
+			var result models.JobOnceResult
+			if err = json.Unmarshal(kv.Value, &result); err == nil && result.TriggerRev == triggerRev {
+				done++
+			}
+		}
+		if done < len(targets) {
+			return nil
+		}
+	}
+	err := etcdclient.DeleteWithModRev(fmt.Sprintf(etcdclient.KeyEtcdOnce, jobId), triggerRev)
+	if err == errors.ErrValueMayChanged {
+		// 触发 key 已被其他节点删除, 或已被重新写入
+		return nil
+	}
+	return err
+}
@@ -1,14 +1,13 @@
 package handler
 
 import (
+	"context"
 	"crony/common/models"
 	"crony/common/pkg/config"
 	"crony/common/pkg/etcdclient"
 	"crony/common/pkg/logger"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"sync/atomic"
 
 	"github.com/coreos/etcd/clientv3"
@@ -17,44 +16,28 @@ import (
 // JobProc 结构体代表一个正在执行的任务的信息
 type JobProc struct {
 	*models.JobProc
+
+	leaseId clientv3.LeaseID   // 进程记录绑定的租约
+	cancel  context.CancelFunc // 停止租约续约
+}
+
+// virtualProcSeq 用于生成没有操作系统进程的任务(容器、SQL)的进程ID
+// 这类任务使用负数序号登记进程记录, 避免与命令任务的进程ID冲突
+var virtualProcSeq int64
+
+// nextVirtualProcId 返回下一个虚拟进程ID
+func nextVirtualProcId() int {
+	return -int(atomic.AddInt64(&virtualProcSeq, 1))
 }
 
 // GetProcFromKey 函数从一个etcd的key字符串中解析出JobProc的信息
-func GetProcFromKey(key string) (proc *JobProc, err error) {
-	// 通过”/“分割etcd key字符串
-	// 预期的 key 格式应为： /crony/proc/{nodeUUID}/{jobId}/{procId}
-	ss := strings.Split(key, "/")
-	var sslen = len(ss)
-	if sslen < 5 { // 根据与其的key格式，分割后的长度至少为5
-		err = fmt.Errorf("invalid proc key [%s]", key)
-		return
-	}
-	// 从分割后的切片末尾解析出进程ID
-	id, err := strconv.Atoi(ss[sslen-1])
+// 预期的 key 格式为： /crony/proc/{nodeUUID}/{jobId}/{procId}
+func GetProcFromKey(key string) (*JobProc, error) {
+	proc, err := models.ParseProcKey(key)
 	if err != nil {
-		return
-	}
-	// 从倒数第二个位置解析出作业ID
-	jobId, err := strconv.Atoi(ss[sslen-2])
-	if err != nil {
-		return
+		return nil, err
 	}
-	// 创建JobProc实例并填充解析出的值
-	proc = &JobProc{
-		JobProc: &models.JobProc{
-			ID:       id,
-			JobID:    jobId,
-			NodeUUID: ss[sslen-3], // 使用 ss[sslen-3] 来获取 {nodeUUID}
-		},
-	}
-	return
-}
-
-// Key 方法为JobProc实例生成一个唯一的etcd key
-// 这个key用于在 etcd 中存储该进程的运行信息
-func (p *JobProc) Key() string {
-	// 使用预定义的etcd key格式模板来生成 key 字符串
-	return fmt.Sprintf(etcdclient.KeyEtcdProc, p.NodeUUID, p.JobID, p.ID)
+	return &JobProc{JobProc: proc}, nil
 }
 
 // del 是一个内部方法，用于从etcd中删除该进程的key
@@ -85,10 +68,26 @@ func (p *JobProc) Start() error {
 	// 将进程信息写入etcd，并设置一个租约TTL
 	// 这是一种心跳机制：如果节点崩溃，无法续约，该key会在TTL到期后被etcd自动删除
 	// 这可以有效防止etcd中出现僵尸进程记录
-	_, err = etcdclient.PutWithTtl(p.Key(), string(b), config.GetConfigModels().System.JobProcTtl)
+	leaseRsp, err := etcdclient.Grant(config.GetConfigModels().System.JobProcTtl)
+	if err != nil {
+		return err
+	}
+	if _, err = etcdclient.Put(p.Key(), string(b), clientv3.WithLease(leaseRsp.ID)); err != nil {
+		return err
+	}
+	// 进程运行期间持续续约, 保证执行时间超过TTL的任务也能被并发策略看到
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := etcdclient.GetEtcdClient().KeepAlive(ctx, leaseRsp.ID)
 	if err != nil {
+		cancel()
 		return err
 	}
+	go func() {
+		for range ch {
+		}
+	}()
+	p.leaseId = leaseRsp.ID
+	p.cancel = cancel
 	return nil
 }
 
@@ -113,6 +112,13 @@ func (p *JobProc) Stop() {
 		// 如果删除失败，记录一条警告日志
 		logger.GetLogger().Warn(fmt.Sprintf("proc del[%s] err: %s", p.Key(), err.Error()))
 	}
+	// 停止续约并撤销租约
+	if p.cancel != nil {
+		p.cancel()
+		if _, err := etcdclient.Revoke(p.leaseId); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("proc revoke lease[%x] err: %s", p.leaseId, err.Error()))
+		}
+	}
 }
 
 // WatchProc 函数创建一个etcd watch通道，用于监听指定节点上所有进程的变化
@@ -122,3 +128,77 @@ func WatchProc(nodeUUID string) clientv3.WatchChan {
 	// clientv3.WithPrefix() 表示监听所有以此key为前缀的键值对的变化
 	return etcdclient.Watch(keyPrefix, clientv3.WithPrefix())
 }
+
+// GetJobProcs 函数返回集群内指定任务正在执行的全部进程, 以及读取时 etcd 的版本号
+// 进程记录按节点组织, 这里需要遍历所有节点的记录后按任务ID过滤
+func GetJobProcs(jobId int) (procs []*JobProc, rev int64, err error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdProcProfile, clientv3.WithPrefix())
+	if err != nil {
+		return
+	}
+	rev = resp.Header.Revision
+	for _, kv := range resp.Kvs {
+		proc, e := models.ParseProc(string(kv.Key), kv.Value)
+		if proc == nil || proc.JobID != jobId {
+			continue
+		}
+		if e != nil {
+			logger.GetLogger().Warn(e.Error())
+		}
+		procs = append(procs, &JobProc{JobProc: proc})
+	}
+	return
+}
+
+// WaitJobProcs 函数阻塞直到集群内指定任务没有正在执行的进程, 或 ctx 结束
+func WaitJobProcs(ctx context.Context, jobId int) error {
+	for {
+		procs, rev, err := GetJobProcs(jobId)
+		if err != nil {
+			return err
+		}
+		if len(procs) == 0 {
+			return nil
+		}
+		// 从读取时的版本号之后开始监听, 任一进程记录被删除后重新检查
+		if err = waitProcDelete(ctx, jobId, rev+1); err != nil {
+			return err
+		}
+	}
+}
+
+// waitProcDelete 等待指定任务的任意一条进程记录被删除
+func waitProcDelete(ctx context.Context, jobId int, rev int64) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rch := etcdclient.GetEtcdClient().Watch(wctx, etcdclient.KeyEtcdProcProfile, clientv3.WithPrefix(), clientv3.WithRev(rev), clientv3.WithFilterPut())
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case wresp, ok := <-rch:
+			if !ok {
+				return ctx.Err()
+			}
+			if err := wresp.Err(); err != nil {
+				return err
+			}
+			for _, ev := range wresp.Events {
+				if proc, err := GetProcFromKey(string(ev.Kv.Key)); err == nil && proc.JobID == jobId {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Kill 方法将进程记录标记为需要终止, 由进程所在的节点监听到后执行终止操作
+func (p *JobProc) Kill() error {
+	val, err := p.MarkKilled()
+	if err != nil {
+		return err
+	}
+	// 保留原有租约, 进程所在节点崩溃时记录仍会按时过期
+	_, err = etcdclient.Put(p.Key(), val, clientv3.WithIgnoreLease())
+	return err
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package handler
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让命令在独立的进程组中运行, 终止时可以连同其子进程一起结束
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup 向命令所在的整个进程组发送信号
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	// pid 取负数表示发送给进程组
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// setCredential 设置命令的执行用户和用户组
+// 非 root 进程没有权限设置附加组, 此时保持附加组不变
+func setCredential(cmd *exec.Cmd, cred *credential) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:         cred.uid,
+		Gid:         cred.gid,
+		Groups:      cred.groups,
+		NoSetGroups: os.Geteuid() != 0,
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package handler
+
+import (
+	"crony/common/pkg/utils/errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 在 windows 上不做处理
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup 在 windows 上不支持信号, 直接结束进程
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// setCredential 在 windows 上不支持
+func setCredential(cmd *exec.Cmd, cred *credential) error {
+	return fmt.Errorf("%w: run as user is not supported on windows", errors.ErrRunAsNotPermitted)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bufio"
+	"crony/common/pkg/config"
+	"crony/common/pkg/logger"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroup v2 的默认挂载点和节点使用的默认 slice
+const (
+	DefaultCgroupRoot  = "/sys/fs/cgroup"
+	DefaultCgroupSlice = "crony.slice"
+)
+
+// cpuMaxPeriod 是写入 cpu.max 的调度周期, 单位微秒
+const cpuMaxPeriod = 100000
+
+// ResourceUsage 是任务一次执行的资源使用情况
+type ResourceUsage struct {
+	PeakMemory int64 // 峰值内存, 单位字节
+	CpuTime    int64 // CPU 时间(用户态 + 内核态), 单位毫秒
+}
+
+// cgroupSliceDir 返回节点存放任务 cgroup 的目录
+func cgroupSliceDir() string {
+	root, slice := DefaultCgroupRoot, DefaultCgroupSlice
+	if c := config.GetConfigModels(); c != nil {
+		if c.System.CgroupRoot != "" {
+			root = c.System.CgroupRoot
+		}
+		if c.System.CgroupSlice != "" {
+			slice = c.System.CgroupSlice
+		}
+	}
+	return filepath.Join(root, slice)
+}
+
+// cgroupLimits 返回任务资源限制对应的 cgroup v2 接口文件和写入的值
+func cgroupLimits(job *Job) map[string]string {
+	limits := make(map[string]string)
+	if job.CpuQuota > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", job.CpuQuota*cpuMaxPeriod/100, cpuMaxPeriod)
+	}
+	if job.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(job.MemoryMax<<20, 10)
+	}
+	if job.PidsMax > 0 {
+		limits["pids.max"] = strconv.Itoa(job.PidsMax)
+	}
+	if job.IoWeight > 0 {
+		limits["io.weight"] = fmt.Sprintf("default %d", job.IoWeight)
+	}
+	return limits
+}
+
+// cgroupControllers 返回任务资源限制需要启用的控制器
+func cgroupControllers(job *Job) []string {
+	controllers := make([]string, 0, 4)
+	if job.CpuQuota > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if job.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if job.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	if job.IoWeight > 0 {
+		controllers = append(controllers, "io")
+	}
+	return controllers
+}
+
+// parseCpuStat 从 cpu.stat 的内容中解析 usage_usec, 单位微秒
+func parseCpuStat(data string) (int64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("usage_usec not found in cpu.stat")
+}
+
+// limitWithoutCgroup 在 cgroup 不可用时通过 rlimit 限制命令的内存和进程数, rlimit 在 exec 任务命令之前设置
+// 内存上限按进程计算, 总是设置; RLIMIT_NPROC 统计执行用户的全部进程, 只有任务以专用用户执行时才设置, 否则记录警告
+func limitWithoutCgroup(cmd *exec.Cmd, job *Job, cred *credential) {
+	if job.CpuQuota > 0 || job.IoWeight > 0 {
+		logger.GetLogger().Warn(fmt.Sprintf("job#%d cpu quota and io weight are not enforced without cgroup", job.ID))
+	}
+	nproc := job.PidsMax > 0 && cred.dedicated()
+	if job.PidsMax > 0 && !nproc {
+		logger.GetLogger().Warn(fmt.Sprintf("job#%d pids max is not enforced without cgroup unless run_as_user is a dedicated user", job.ID))
+	}
+	if job.MemoryMax <= 0 && !nproc {
+		return
+	}
+	if err := wrapRlimits(cmd, job, nproc); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("job#%d memory max and pids max are not enforced, set rlimit err: %s", job.ID, err.Error()))
+	}
+}
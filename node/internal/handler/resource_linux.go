@@ -0,0 +1,168 @@
+//go:build linux
+
+package handler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroup 是任务一次执行使用的临时 cgroup
+type cgroup struct {
+	dir string
+	fd  *os.File // cgroup 目录的文件描述符, 用于在创建子进程时直接将其放入该 cgroup
+}
+
+// createCgroup 在 sliceDir 下为任务的一次执行创建临时 cgroup, 并写入资源限制
+// sliceDir 的上级目录必须是 cgroup v2 的目录, 且节点对其有写权限
+func createCgroup(sliceDir string, job *Job) (*cgroup, error) {
+	parent := filepath.Dir(sliceDir)
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%s is not a cgroup v2 directory", parent)
+	}
+	if err := os.Mkdir(sliceDir, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	controllers := cgroupControllers(job)
+	for _, dir := range []string{parent, sliceDir} {
+		if err := enableControllers(dir, controllers); err != nil {
+			return nil, err
+		}
+	}
+	cg := &cgroup{dir: filepath.Join(sliceDir, fmt.Sprintf("job-%d-%d", job.ID, time.Now().UnixNano()))}
+	if err := os.Mkdir(cg.dir, 0755); err != nil {
+		return nil, err
+	}
+	for file, value := range cgroupLimits(job) {
+		if err := os.WriteFile(filepath.Join(cg.dir, file), []byte(value), 0); err != nil {
+			cg.destroy()
+			return nil, fmt.Errorf("write %s: %w", file, err)
+		}
+	}
+	fd, err := os.Open(cg.dir)
+	if err != nil {
+		cg.destroy()
+		return nil, err
+	}
+	cg.fd = fd
+	return cg, nil
+}
+
+// enableControllers 在 dir 的 cgroup.subtree_control 中启用子 cgroup 需要的控制器
+func enableControllers(dir string, controllers []string) error {
+	file := filepath.Join(dir, "cgroup.subtree_control")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	enabled := strings.Fields(string(data))
+	for _, c := range controllers {
+		if containsField(enabled, c) {
+			continue
+		}
+		if err = os.WriteFile(file, []byte("+"+c), 0); err != nil {
+			return fmt.Errorf("enable controller %s in %s: %w", c, dir, err)
+		}
+	}
+	return nil
+}
+
+// apply 让命令启动时直接进入该 cgroup, 避免启动后再迁移时漏掉已经创建的子进程
+func (cg *cgroup) apply(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// usage 读取 cgroup 中所有进程的峰值内存和 CPU 时间
+// 内核不支持 memory.peak 时使用子进程的 rusage
+func (cg *cgroup) usage(state *os.ProcessState) *ResourceUsage {
+	usage := processUsage(state)
+	if usage == nil {
+		usage = new(ResourceUsage)
+	}
+	if data, err := os.ReadFile(filepath.Join(cg.dir, "cpu.stat")); err == nil {
+		if usec, err := parseCpuStat(string(data)); err == nil {
+			usage.CpuTime = usec / 1000
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(cg.dir, "memory.peak")); err == nil {
+		if peak, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			usage.PeakMemory = peak
+		}
+	}
+	return usage
+}
+
+// destroy 结束 cgroup 中残留的进程并删除 cgroup
+func (cg *cgroup) destroy() {
+	if cg.fd != nil {
+		cg.fd.Close()
+	}
+	// cgroup.kill 需要 5.14 以上的内核, 不支持时残留的进程会导致删除失败
+	_ = os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0)
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(cg.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// rlimitScript 返回在 exec 任务命令之前设置 rlimit 的 shell 语句
+// 内存上限对应 RLIMIT_DATA 而不是 RLIMIT_AS, 只统计实际可写的内存, 预留大量地址空间的 Go、JVM 程序不受影响
+// 进程数上限对应 RLIMIT_NPROC, 按执行用户统计, 只在 nproc 为 true 时设置; bash 使用 ulimit -u, dash 使用 ulimit -p
+func rlimitScript(job *Job, nproc bool) string {
+	var limits []string
+	if job.MemoryMax > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -d %d", job.MemoryMax<<10))
+	}
+	if nproc && job.PidsMax > 0 {
+		limits = append(limits, fmt.Sprintf("{ ulimit -u %d 2>/dev/null || ulimit -p %d; }", job.PidsMax, job.PidsMax))
+	}
+	return strings.Join(limits, " && ")
+}
+
+// wrapRlimits 通过 /bin/sh 设置 rlimit 后再 exec 原命令, 限制在任务命令开始执行之前就已生效
+func wrapRlimits(cmd *exec.Cmd, job *Job, nproc bool) error {
+	script := rlimitScript(job, nproc)
+	if script == "" {
+		return nil
+	}
+	cmd.Args = append([]string{"/bin/sh", "-c", script + ` && exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
+// processUsage 从子进程的 rusage 中读取峰值内存和 CPU 时间
+func processUsage(state *os.ProcessState) *ResourceUsage {
+	if state == nil {
+		return nil
+	}
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	return &ResourceUsage{
+		PeakMemory: ru.Maxrss << 10, // Linux 上 ru_maxrss 的单位是 KB
+		CpuTime:    (time.Duration(ru.Utime.Nano()) + time.Duration(ru.Stime.Nano())).Milliseconds(),
+	}
+}
+
+// containsField 判断 fields 中是否包含 s
+func containsField(fields []string, s string) bool {
+	for _, f := range fields {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package handler
+
+import (
+	"bytes"
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartCommandWithoutCgroup(t *testing.T) {
+	logger.Init(t.TempDir(), "error", "console", "", "logs", false, "", "", false)
+	// 普通目录不是 cgroup, 直接在其中创建进程会失败, 与内核不支持 clone3 时的表现相同
+	dir := filepath.Join(t.TempDir(), "job-1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg := &cgroup{dir: dir, fd: fd}
+
+	var b bytes.Buffer
+	newCmd := func() (*exec.Cmd, error) {
+		cmd := exec.Command("echo", "ok")
+		cmd.Stdout = &b
+		return cmd, nil
+	}
+	cmd, _ := newCmd()
+	cg.apply(cmd)
+	job := &Job{Job: &models.Job{ID: 1, PidsMax: 8}}
+	cmd, cg, err = startCommand(job, nil, newCmd, cmd, cg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cg != nil {
+		t.Fatal("cgroup should be dropped after start in it failed")
+	}
+	if err = cmd.Wait(); err != nil || b.String() != "ok\n" {
+		t.Fatalf("output %q err %v", b.String(), err)
+	}
+}
+
+func TestRlimitScript(t *testing.T) {
+	expect := "ulimit -d 1024 && { ulimit -u 8 2>/dev/null || ulimit -p 8; }"
+	if script := rlimitScript(&Job{Job: &models.Job{MemoryMax: 1, PidsMax: 8}}, true); script != expect {
+		t.Fatalf("script is %q", script)
+	}
+	// 不是专用用户时只限制内存
+	if script := rlimitScript(&Job{Job: &models.Job{MemoryMax: 1, PidsMax: 8}}, false); script != "ulimit -d 1024" {
+		t.Fatalf("script is %q", script)
+	}
+	if script := rlimitScript(&Job{Job: &models.Job{CpuQuota: 50}}, true); script != "" {
+		t.Fatalf("script is %q", script)
+	}
+}
+
+func TestLimitWithoutCgroup(t *testing.T) {
+	logger.Init(t.TempDir(), "error", "console", "", "logs", false, "", "", false)
+	// 以节点自身的用户执行时, 内存上限仍然在 exec 前设置
+	cmd := exec.Command("cat", "/proc/self/limits")
+	limitWithoutCgroup(cmd, &Job{Job: &models.Job{ID: 1, MemoryMax: 512, PidsMax: 32}}, nil)
+	data, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Max data size") && strings.Fields(line)[3] != "536870912" {
+			t.Fatalf("data size limit: %s", line)
+		}
+	}
+	if !strings.Contains(string(data), "536870912") {
+		t.Fatalf("memory max is not applied:\n%s", data)
+	}
+}
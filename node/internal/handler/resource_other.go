@@ -0,0 +1,38 @@
+//go:build !linux
+
+package handler
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// errResourceUnsupported 表示当前平台不支持资源限制
+var errResourceUnsupported = errors.New("resource limits are only supported on linux")
+
+// cgroup 在非 Linux 平台上不可用
+type cgroup struct{}
+
+// createCgroup 在非 Linux 平台上总是返回错误
+func createCgroup(sliceDir string, job *Job) (*cgroup, error) {
+	return nil, errResourceUnsupported
+}
+
+func (cg *cgroup) apply(cmd *exec.Cmd) {}
+
+func (cg *cgroup) usage(state *os.ProcessState) *ResourceUsage {
+	return processUsage(state)
+}
+
+func (cg *cgroup) destroy() {}
+
+// wrapRlimits 在非 Linux 平台上总是返回错误
+func wrapRlimits(cmd *exec.Cmd, job *Job, nproc bool) error {
+	return errResourceUnsupported
+}
+
+// processUsage 在非 Linux 平台上不统计资源使用情况
+func processUsage(state *os.ProcessState) *ResourceUsage {
+	return nil
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"crony/common/models"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	job := &Job{Job: &models.Job{CpuQuota: 50, MemoryMax: 256, PidsMax: 64, IoWeight: 200}}
+	limits := cgroupLimits(job)
+	expect := map[string]string{
+		"cpu.max":    "50000 100000",
+		"memory.max": "268435456",
+		"pids.max":   "64",
+		"io.weight":  "default 200",
+	}
+	for file, value := range expect {
+		if limits[file] != value {
+			t.Errorf("%s is %q, expect %q", file, limits[file], value)
+		}
+	}
+	if controllers := cgroupControllers(job); len(controllers) != 4 {
+		t.Errorf("controllers are %v", controllers)
+	}
+	if limits = cgroupLimits(&Job{Job: &models.Job{PidsMax: 8}}); len(limits) != 1 {
+		t.Errorf("limits are %v", limits)
+	}
+}
+
+func TestParseCpuStat(t *testing.T) {
+	usec, err := parseCpuStat("usage_usec 123456\nuser_usec 100000\nsystem_usec 23456\n")
+	if err != nil || usec != 123456 {
+		t.Fatalf("usec %d err %v", usec, err)
+	}
+	if _, err = parseCpuStat("user_usec 1\n"); err == nil {
+		t.Fatal("expect error without usage_usec")
+	}
+}
+
+func TestResourceLimitsCheck(t *testing.T) {
+	invalid := []*models.Job{
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, CpuQuota: -1},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, MemoryMax: -1},
+		{Name: "a", Command: "ls", Type: models.JobTypeCmd, IoWeight: 10001},
+	}
+	for _, job := range invalid {
+		if err := job.Check(); err == nil {
+			t.Errorf("job %+v should be invalid", job)
+		}
+	}
+}
+
+func TestRlimitFallback(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("rlimit fallback is only implemented on linux")
+	}
+	job := &Job{Job: &models.Job{ID: 1, MemoryMax: 512, PidsMax: 32}}
+	// 不是 cgroup v2 目录时创建失败, 由调用方退化为 setrlimit
+	if _, err := createCgroup(t.TempDir()+"/crony.slice", job); err == nil {
+		t.Fatal("expect error for non cgroup directory")
+	}
+
+	// 包装进程在 exec 原命令之前设置 rlimit, 原命令读到的是自己的限制
+	cmd := exec.Command("cat", "/proc/self/limits")
+	if err := wrapRlimits(cmd, job, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checked int
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "Max data size"):
+			checked++
+			if fields[3] != "536870912" {
+				t.Errorf("data size limit: %s", line)
+			}
+		case strings.HasPrefix(line, "Max address space"):
+			if fields[3] != "unlimited" {
+				t.Errorf("address space should not be limited: %s", line)
+			}
+		case strings.HasPrefix(line, "Max processes"):
+			checked++
+			if fields[2] != "32" {
+				t.Errorf("processes limit: %s", line)
+			}
+		}
+	}
+	if checked != 2 {
+		t.Fatalf("limits of wrapped command:\n%s", data)
+	}
+}
+
+func TestProcessUsage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process usage is only collected on linux")
+	}
+	cmd := exec.Command("/bin/sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	usage := processUsage(cmd.ProcessState)
+	if usage == nil || usage.PeakMemory <= 0 {
+		t.Fatalf("usage is %+v", usage)
+	}
+}
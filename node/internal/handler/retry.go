@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"crony/common/models"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"time"
+)
+
+// timeoutError 表示任务因超过超时时间而失败
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string { return e.err.Error() }
+func (e *timeoutError) Unwrap() error { return e.err }
+func (e *timeoutError) Timeout() bool { return true }
+
+// exitCodeError 表示容器以非零退出码结束
+type exitCodeError struct {
+	what string
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("%s exited with code %d", e.what, e.code)
+}
+
+// httpStatusError 表示 HTTP 响应的状态码不满足断言
+type httpStatusError struct {
+	status   int
+	min, max int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("response status code %d is not in [%d, %d]", e.status, e.min, e.max)
+}
+
+// classifyFailure 根据错误判断失败的类别, 用于决定是否重试
+func classifyFailure(err error) models.Failure {
+	f := models.Failure{ExitCode: -1}
+	var (
+		exitErr   *exec.ExitError
+		codeErr   *exitCodeError
+		statusErr *httpStatusError
+		timeout   interface{ Timeout() bool }
+	)
+	if errors.As(err, &exitErr) {
+		f.ExitCode = exitErr.ExitCode()
+	} else if errors.As(err, &codeErr) {
+		f.ExitCode = codeErr.code
+	}
+	if errors.As(err, &statusErr) {
+		f.HttpStatus = statusErr.status
+	}
+	// context.DeadlineExceeded、net/http 的超时错误和 timeoutError 都实现了 Timeout
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		f.Timeout = true
+	}
+	return f
+}
+
+// nextRetry 判断第 n 次(从 1 开始)重试是否进行, 返回重试前的等待时间
+// 超过最大重试次数、失败不可重试或等待后会超过 max_elapsed 时不再重试
+func nextRetry(policy *models.RetryPolicy, n, maxRetries int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if n > maxRetries || !policy.Retryable(classifyFailure(err)) {
+		return 0, false
+	}
+	delay := policy.NextDelay(n, rand.Float64())
+	if policy.MaxElapsed > 0 && elapsed+delay > time.Duration(policy.MaxElapsed)*time.Second {
+		return 0, false
+	}
+	return delay, true
+}
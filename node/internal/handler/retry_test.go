@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"crony/common/models"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNextDelay(t *testing.T) {
+	cases := []struct {
+		policy models.RetryPolicy
+		n      int
+		expect time.Duration
+	}{
+		{models.RetryPolicy{Backoff: models.BackoffFixed, Delay: 5}, 3, 5 * time.Second},
+		{models.RetryPolicy{Backoff: models.BackoffLinear, Delay: 5}, 3, 15 * time.Second},
+		{models.RetryPolicy{Backoff: models.BackoffExponential, Delay: 2}, 4, 16 * time.Second},
+		{models.RetryPolicy{Backoff: models.BackoffExponential, Delay: 1, Multiplier: 3}, 3, 9 * time.Second},
+		{models.RetryPolicy{Backoff: models.BackoffExponential, Delay: 2, MaxDelay: 10}, 10, 10 * time.Second},
+	}
+	for _, c := range cases {
+		if d := c.policy.NextDelay(c.n, 0.5); d != c.expect {
+			t.Errorf("policy %+v retry %d: delay %s, expect %s", c.policy, c.n, d, c.expect)
+		}
+	}
+	p := &models.RetryPolicy{Backoff: models.BackoffFixed, Delay: 10, Jitter: 0.5}
+	if lo, hi := p.NextDelay(1, 0), p.NextDelay(1, 0.999); lo != 5*time.Second || hi < 14*time.Second || hi > 15*time.Second {
+		t.Fatalf("jitter range is [%s, %s]", lo, hi)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := &models.RetryPolicy{RetryOn: &models.RetryOn{
+		ExitCodes:  []int{75},
+		HttpStatus: []string{"5xx", "429"},
+		Timeout:    models.RetryTimeoutNever,
+	}}
+	cases := []struct {
+		f      models.Failure
+		expect bool
+	}{
+		{models.Failure{ExitCode: 75}, true},
+		{models.Failure{ExitCode: 1}, false},
+		{models.Failure{ExitCode: -1, HttpStatus: 503}, true},
+		{models.Failure{ExitCode: -1, HttpStatus: 429}, true},
+		{models.Failure{ExitCode: -1, HttpStatus: 404}, false},
+		{models.Failure{ExitCode: -1, Timeout: true}, false},
+		{models.Failure{ExitCode: -1}, true},
+	}
+	for _, c := range cases {
+		if got := p.Retryable(c.f); got != c.expect {
+			t.Errorf("failure %+v: retryable %v, expect %v", c.f, got, c.expect)
+		}
+	}
+	only := &models.RetryPolicy{RetryOn: &models.RetryOn{Timeout: models.RetryTimeoutOnly}}
+	if only.Retryable(models.Failure{ExitCode: 1}) || !only.Retryable(models.Failure{ExitCode: -1, Timeout: true}) {
+		t.Fatal("timeout only policy should only retry timeouts")
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if f := classifyFailure(fmt.Errorf("wrapped: %w", err)); f.ExitCode != 3 || f.Timeout {
+		t.Fatalf("failure is %+v", f)
+	}
+	if f := classifyFailure(&exitCodeError{what: "container", code: 2}); f.ExitCode != 2 {
+		t.Fatalf("failure is %+v", f)
+	}
+	if f := classifyFailure(&httpStatusError{status: 502, min: 200, max: 299}); f.HttpStatus != 502 || f.ExitCode != -1 {
+		t.Fatalf("failure is %+v", f)
+	}
+	if f := classifyFailure(&timeoutError{errors.New("job#1 timeout after 1s")}); !f.Timeout {
+		t.Fatalf("failure is %+v", f)
+	}
+	if f := classifyFailure(fmt.Errorf("statement 1: %w", context.DeadlineExceeded)); !f.Timeout {
+		t.Fatalf("failure is %+v", f)
+	}
+	if f := classifyFailure(errors.New("boom")); f.Timeout || f.ExitCode != -1 || f.HttpStatus != 0 {
+		t.Fatalf("failure is %+v", f)
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	p := &models.RetryPolicy{Backoff: models.BackoffFixed, Delay: 10, MaxElapsed: 30}
+	if d, ok := nextRetry(p, 1, 3, 0, errors.New("boom")); !ok || d != 10*time.Second {
+		t.Fatalf("delay %s retry %v", d, ok)
+	}
+	if _, ok := nextRetry(p, 4, 3, 0, errors.New("boom")); ok {
+		t.Fatal("should not retry more than retry_times")
+	}
+	if _, ok := nextRetry(p, 2, 3, 25*time.Second, errors.New("boom")); ok {
+		t.Fatal("should not retry beyond max_elapsed")
+	}
+	p.RetryOn = &models.RetryOn{Timeout: models.RetryTimeoutOnly}
+	if _, ok := nextRetry(p, 1, 3, 0, errors.New("boom")); ok {
+		t.Fatal("should not retry non-timeout failure")
+	}
+}
+
+func TestRetryPolicyCheck(t *testing.T) {
+	invalid := []*models.RetryPolicy{
+		{Backoff: "random"},
+		{Delay: -1},
+		{Backoff: models.BackoffExponential, Multiplier: 0.5},
+		{Jitter: 1.5},
+		{RetryOn: &models.RetryOn{HttpStatus: []string{"6xx"}}},
+		{RetryOn: &models.RetryOn{Timeout: "sometimes"}},
+	}
+	for _, p := range invalid {
+		job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd, RetryTimes: 1, Retry: p}
+		if err := job.Check(); !errors.Is(err, cronyErrors.ErrIllegalRetryPolicy) {
+			t.Errorf("policy %+v: expect ErrIllegalRetryPolicy, got %v", p, err)
+		}
+	}
+
+	// RetryInterval 为 0 时不再把 RetryTimes 改为 1
+	job := &models.Job{Name: "a", Command: "ls", Type: models.JobTypeCmd}
+	if err := job.Check(); err != nil || job.RetryTimes != 0 {
+		t.Fatalf("retry times %d err %v", job.RetryTimes, err)
+	}
+	if p := job.GetRetryPolicy(); p.Backoff != models.BackoffLinear || p.NextDelay(2, 0) != 2*time.Minute {
+		t.Fatalf("legacy policy is %+v", p)
+	}
+	job.RetryInterval = -1
+	if p := job.GetRetryPolicy(); p.NextDelay(3, 0) != 0 {
+		t.Fatalf("legacy immediate policy is %+v", p)
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/utils"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// GetSteps 读取 /crony/step/ 下已经写入的步骤触发, 同时返回读取时的版本号
+func GetSteps() ([]*mvccpb.KeyValue, int64, error) {
+	resp, err := etcdclient.Get(etcdclient.KeyEtcdStepProfile, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Kvs, resp.Header.Revision, nil
+}
+
+// WatchSteps 从版本号 rev 之后监听 /crony/step/ 下工作流步骤的触发, rev 为 0 时从当前版本开始
+func WatchSteps(rev int64) clientv3.WatchChan {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	return etcdclient.Watch(etcdclient.KeyEtcdStepProfile, opts...)
+}
+
+// HasStepResult 判断步骤的这一次执行是否已经写回结果
+func HasStepResult(trigger *models.WorkflowStepTrigger) (bool, error) {
+	resp, err := etcdclient.Get(fmt.Sprintf(etcdclient.KeyEtcdStepResult, trigger.RunID, trigger.Step))
+	if err != nil || resp.Count == 0 {
+		return false, err
+	}
+	result := new(models.WorkflowStepResult)
+	if err = json.Unmarshal(resp.Kvs[0].Value, result); err != nil {
+		return false, err
+	}
+	return result.Attempt == trigger.Attempt, nil
+}
+
+// TryStep 在目标为 "any" 时争抢步骤一次执行的执行权, 同一次执行只有一个节点能拿到
+func TryStep(trigger *models.WorkflowStepTrigger) (bool, error) {
+	lease, err := etcdclient.Grant(OnceResultTtl)
+	if err != nil {
+		return false, err
+	}
+	ok, err := etcdclient.GetLock(fmt.Sprintf("step-%d-%s-%d", trigger.RunID, trigger.Step, trigger.Attempt), lease.ID)
+	if err != nil || !ok {
+		_, _ = etcdclient.Revoke(lease.ID)
+	}
+	return ok, err
+}
+
+// PutStepResult 将步骤的执行结果写入 /crony/step-result/<run_id>/<step>
+// 结果不设置租约, 由 admin 处理后删除, admin 暂时没有领导者时也不会丢失; 输出和错误信息超过 MaxResultOutput 时截断
+func PutStepResult(result *models.WorkflowStepResult) error {
+	result.Output = utils.Truncate(result.Output, MaxResultOutput)
+	result.Error = utils.Truncate(result.Error, MaxResultOutput)
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdStepResult, result.RunID, result.Step), string(b))
+	return err
+}
+
+// RunStep 执行工作流运行 runId 中的一个步骤, 任务日志的 workflow_run_id 为 runId
+// 与立即执行一样不受日历和并发策略限制, 失败时不按任务的重试策略重试, 由工作流的重试处理
+func (j *Job) RunStep(runId int) (jobLogId int, result string, runErr error) {
+	j.workflowRunId = runId
+	return j.RunWithRecovery()
+}
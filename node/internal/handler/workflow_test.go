@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/etcdclient"
+	cronyErrors "crony/common/pkg/utils/errors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDag 返回 extract 扇出到 a、b, a、b 汇聚到 load, extract 失败时执行 alert 的工作流
+func testDag() *models.WorkflowDag {
+	return &models.WorkflowDag{
+		Steps: []models.WorkflowStep{
+			{Name: "extract", JobID: 1}, {Name: "a", JobID: 2}, {Name: "b", JobID: 3},
+			{Name: "load", JobID: 4}, {Name: "alert", JobID: 5},
+		},
+		Edges: []models.WorkflowEdge{
+			{From: "extract", To: "a"}, {From: "extract", To: "b"},
+			{From: "a", To: "load"}, {From: "b", To: "load"},
+			{From: "extract", To: "alert", On: models.WorkflowOnFailure},
+		},
+	}
+}
+
+func TestWorkflowDagCheck(t *testing.T) {
+	if err := testDag().Check(); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []*models.WorkflowDag{
+		{},
+		{Steps: []models.WorkflowStep{{Name: "a/b", JobID: 1}}},
+		{Steps: []models.WorkflowStep{{Name: "a", JobID: 1}, {Name: "a", JobID: 2}}},
+		{Steps: []models.WorkflowStep{{Name: "a"}}},
+		{Steps: []models.WorkflowStep{{Name: "a", JobID: 1}}, Edges: []models.WorkflowEdge{{From: "a", To: "b"}}},
+		{Steps: []models.WorkflowStep{{Name: "a", JobID: 1}}, Edges: []models.WorkflowEdge{{From: "a", To: "a"}}},
+		{
+			Steps: []models.WorkflowStep{{Name: "a", JobID: 1}, {Name: "b", JobID: 2}},
+			Edges: []models.WorkflowEdge{{From: "a", To: "b"}, {From: "a", To: "b", On: models.WorkflowOnAlways}},
+		},
+		{
+			Steps: []models.WorkflowStep{{Name: "a", JobID: 1}, {Name: "b", JobID: 2}},
+			Edges: []models.WorkflowEdge{{From: "a", To: "b", On: "sometimes"}},
+		},
+		{
+			Steps: []models.WorkflowStep{{Name: "a", JobID: 1}, {Name: "b", JobID: 2}, {Name: "c", JobID: 3}},
+			Edges: []models.WorkflowEdge{{From: "a", To: "b"}, {From: "b", To: "c"}, {From: "c", To: "b"}},
+		},
+	}
+	for i, dag := range invalid {
+		if err := dag.Check(); !errors.Is(err, cronyErrors.ErrIllegalWorkflow) {
+			t.Fatalf("dag#%d expect ErrIllegalWorkflow, got %v", i, err)
+		}
+	}
+}
+
+func TestWorkflowDagResolve(t *testing.T) {
+	dag := testDag()
+	status := map[string]int{}
+	run, skip := dag.Resolve(status)
+	if !reflect.DeepEqual(run, []string{"extract"}) || len(skip) != 0 {
+		t.Fatalf("first resolve run %v skip %v", run, skip)
+	}
+
+	// extract 成功: 扇出到 a、b, alert 的条件不满足被跳过
+	status["extract"] = models.WorkflowStatusSuccess
+	run, skip = dag.Resolve(status)
+	if !reflect.DeepEqual(run, []string{"a", "b"}) || !reflect.DeepEqual(skip, []string{"alert"}) {
+		t.Fatalf("after extract run %v skip %v", run, skip)
+	}
+
+	// 汇聚: b 结束前 load 不会被判断
+	status["a"] = models.WorkflowStatusSuccess
+	if run, skip = dag.Resolve(status); len(run) != 0 || len(skip) != 0 {
+		t.Fatalf("load should wait for b, run %v skip %v", run, skip)
+	}
+	if done, _ := dag.Finished(status); done {
+		t.Fatal("workflow should not be finished")
+	}
+	status["b"] = models.WorkflowStatusSuccess
+	if run, _ = dag.Resolve(status); !reflect.DeepEqual(run, []string{"load"}) {
+		t.Fatalf("after a and b run %v", run)
+	}
+	status["load"] = models.WorkflowStatusSuccess
+	if done, success := dag.Finished(status); !done || !success {
+		t.Fatalf("finished %v success %v", done, success)
+	}
+}
+
+func TestWorkflowDagResolveFailure(t *testing.T) {
+	dag := testDag()
+	status := map[string]int{"extract": models.WorkflowStatusFailed}
+	run, skip := dag.Resolve(status)
+	// extract 失败: 执行 alert, 跳过沿连线传递到 load
+	sort.Strings(skip)
+	if !reflect.DeepEqual(run, []string{"alert"}) || !reflect.DeepEqual(skip, []string{"a", "b", "load"}) {
+		t.Fatalf("after failure run %v skip %v", run, skip)
+	}
+	status["alert"] = models.WorkflowStatusSuccess
+	if done, success := dag.Finished(status); !done || success {
+		t.Fatalf("finished %v success %v, expect failed", done, success)
+	}
+}
+
+func TestWorkflowDagDescendants(t *testing.T) {
+	dag := testDag()
+	got := dag.Descendants([]string{"a"})
+	expect := map[string]bool{"a": true, "load": true}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("descendants of a %v, expect %v", got, expect)
+	}
+	if got = dag.Descendants([]string{"extract"}); len(got) != len(dag.Steps) {
+		t.Fatalf("descendants of extract %v, expect all steps", got)
+	}
+}
+
+func TestGetStepsBeforeWatch(t *testing.T) {
+	startEmbedEtcd(t)
+	trigger := &models.WorkflowStepTrigger{RunID: 1, Step: "extract", JobID: 1, Attempt: 2, Target: models.OnceTargetAny}
+	b, _ := json.Marshal(trigger)
+	if _, err := etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdStep, trigger.RunID, trigger.Step), string(b)); err != nil {
+		t.Fatal(err)
+	}
+	kvs, rev, err := GetSteps()
+	if err != nil || len(kvs) != 1 || rev == 0 {
+		t.Fatalf("steps %v rev %d err %v", kvs, rev, err)
+	}
+	if done, err := HasStepResult(trigger); err != nil || done {
+		t.Fatalf("step without result: done %v err %v", done, err)
+	}
+	// 上一次执行的结果不算作这一次执行的结果
+	if err = PutStepResult(&models.WorkflowStepResult{RunID: 1, Step: "extract", Attempt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := HasStepResult(trigger); err != nil || done {
+		t.Fatalf("step with result of last attempt: done %v err %v", done, err)
+	}
+	if err = PutStepResult(&models.WorkflowStepResult{RunID: 1, Step: "extract", Attempt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := HasStepResult(trigger); err != nil || !done {
+		t.Fatalf("step with result: done %v err %v", done, err)
+	}
+
+	// 从读取时的版本号之后监听, 只收到之后写入的触发
+	rch := WatchSteps(rev)
+	if _, err = etcdclient.Put(fmt.Sprintf(etcdclient.KeyEtcdStep, 2, "load"), string(b)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case wresp := <-rch:
+		if len(wresp.Events) != 1 || string(wresp.Events[0].Kv.Key) != fmt.Sprintf(etcdclient.KeyEtcdStep, 2, "load") {
+			t.Fatalf("events %v", wresp.Events)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("step trigger written after rev is not watched")
+	}
+}
+
+func TestPutResultTruncated(t *testing.T) {
+	startEmbedEtcd(t)
+	long := strings.Repeat("x", MaxResultOutput+1)
+	if err := PutStepResult(&models.WorkflowStepResult{RunID: 1, Step: "extract", Output: long, Error: long}); err != nil {
+		t.Fatal(err)
+	}
+	if err := PutOnceResult(&models.JobOnceResult{JobID: 1, NodeUUID: "node", Output: long, Error: long}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{fmt.Sprintf(etcdclient.KeyEtcdStepResult, 1, "extract"), fmt.Sprintf(etcdclient.KeyEtcdOnceResult, 1, "node")} {
+		resp, err := etcdclient.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Count != 1 {
+			t.Fatalf("%s is not written", key)
+		}
+		var result struct {
+			Output string `json:"output"`
+			Error  string `json:"error"`
+		}
+		if err = json.Unmarshal(resp.Kvs[0].Value, &result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Output) != MaxResultOutput || len(result.Error) != MaxResultOutput {
+			t.Fatalf("%s: output %d bytes, error %d bytes", key, len(result.Output), len(result.Error))
+		}
+	}
+}
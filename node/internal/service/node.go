@@ -0,0 +1,384 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/config"
+	"crony/common/pkg/etcdclient"
+	"crony/common/pkg/logger"
+	"crony/common/pkg/schedule"
+	"crony/common/pkg/utils"
+	"crony/node/internal/handler"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/jakecoffman/cron"
+)
+
+// NodeUUIDFile 是节点持久化自身 UUID 的文件路径
+// 节点重启后沿用同一个 UUID, 才能继续认领 /crony/job/<node_uuid>/ 下的任务
+const NodeUUIDFile = "node/.uuid"
+
+// NodeServer 是工作节点的核心服务
+// 它把节点信息、cron 调度器和当前节点上的任务集合组合在一起
+type NodeServer struct {
+	*etcdclient.ServerReg
+	*models.Node
+	*cron.Cron
+
+	jobs handler.Jobs  // 当前节点已加载到调度器中的任务, key 为任务 ID
+	stop chan struct{} // 用于通知各个 watch goroutine 退出
+}
+
+// NewNodeServer 是 NodeServer 的构造函数, 负责收集本机信息
+func NewNodeServer() (*NodeServer, error) {
+	uuid, err := utils.LoadOrCreateUUID(NodeUUIDFile)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	ip, err := utils.LocalIP()
+	if err != nil {
+		return nil, err
+	}
+	return &NodeServer{
+		ServerReg: etcdclient.NewServerReg(config.GetConfigModels().System.NodeTtl),
+		Node: &models.Node{
+			UUID:     uuid,
+			PID:      strconv.Itoa(os.Getpid()),
+			IP:       ip,
+			Hostname: hostname,
+			Version:  config.GetConfigModels().System.Version,
+			Status:   models.NodeConnSuccess,
+			LabelMap: config.GetConfigModels().System.NodeLabels,
+		},
+		Cron: cron.New(),
+		jobs: make(handler.Jobs),
+		stop: make(chan struct{}),
+	}, nil
+}
+
+// Register 将节点信息写入 MySQL, 并以 System.NodeTtl 为租约写入 etcd
+// 节点进程退出或失联时, 租约最多在一个 TTL 后过期, 其他组件据此感知节点下线
+func (srv *NodeServer) Register() error {
+	srv.UpTime = time.Now().Unix()
+	srv.DownTime = 0
+	if err := srv.Node.Marshal(); err != nil {
+		return err
+	}
+	// 同一个 UUID 的节点已经存在时只更新, 否则新建一条记录
+	exist := &models.Node{UUID: srv.UUID}
+	if err := exist.FindByUUID(); err == nil {
+		srv.ID = exist.ID
+		if err = srv.Node.Update(); err != nil {
+			return err
+		}
+	} else if _, err = srv.Node.Insert(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(srv.Node)
+	if err != nil {
+		return err
+	}
+	return srv.ServerReg.Register(fmt.Sprintf(etcdclient.KeyEtcdNode, srv.UUID), string(b))
+}
+
+// Run 加载节点上的全部任务, 启动调度器, 并开始监听任务变化
+// 任务和日历都从加载时的版本之后开始监听, 加载到开始监听之间的变化不会丢失
+func (srv *NodeServer) Run() error {
+	// 任务的日历规则依赖日历, 先于任务加载
+	calendarRev, err := handler.LoadCalendars()
+	if err != nil {
+		return err
+	}
+	jobRev, err := srv.loadJobs()
+	if err != nil {
+		return err
+	}
+	srv.Cron.Start()
+	go srv.watchJobs(jobRev, calendarRev)
+	go srv.watchProcs()
+	go srv.watchOnce()
+	go srv.watchSteps()
+	return nil
+}
+
+// Stop 停止调度器, 撤销节点租约, 并将节点标记为下线
+func (srv *NodeServer) Stop() {
+	close(srv.stop)
+	srv.Cron.Stop()
+	// 撤销租约后 /crony/node/<node_uuid> 会被 etcd 立即删除
+	if err := srv.ServerReg.Stop(); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("revoke lease of %s err: %s", srv.String(), err.Error()))
+	}
+	srv.Status = models.NodeConnFail
+	srv.DownTime = time.Now().Unix()
+	if err := srv.Node.Update(); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("update %s down status err: %s", srv.String(), err.Error()))
+	}
+	logger.GetLogger().Info(fmt.Sprintf("%s stopped", srv.String()))
+}
+
+// loadJobs 从 etcd 中读取分配给当前节点的全部任务, 与调度器中已有的任务对比后新增、替换或删除
+// 返回读取时 etcd 的版本号; 新加入调度器的任务按 misfire 策略补执行
+func (srv *NodeServer) loadJobs() (int64, error) {
+	jobs, rev, err := handler.GetJobs(srv.UUID)
+	if err != nil {
+		return 0, err
+	}
+	for id := range srv.jobs {
+		if _, ok := jobs[id]; !ok {
+			srv.delJob(id)
+		}
+	}
+	for _, job := range jobs {
+		if _, ok := srv.jobs[job.ID]; ok {
+			srv.modJob(job)
+		} else {
+			srv.addJob(job, true)
+		}
+	}
+	return rev, nil
+}
+
+// reloadCalendars 重新读取全部日历, 并重新调度引用了日历的任务, 返回读取时 etcd 的版本号
+func (srv *NodeServer) reloadCalendars() (int64, error) {
+	rev, err := handler.LoadCalendars()
+	if err != nil {
+		return 0, err
+	}
+	var affected []*handler.Job
+	for _, job := range srv.jobs {
+		if len(job.Calendars) > 0 {
+			affected = append(affected, job)
+		}
+	}
+	for _, job := range affected {
+		srv.modJob(job)
+	}
+	return rev, nil
+}
+
+// watchJobs 持续消费 etcd 中任务的 PUT/DELETE 事件, 并同步到调度器
+// 日历的变化也在这里处理, 保证 srv.jobs 只由一个 goroutine 修改
+// watch 通道被关闭(例如需要的版本已被 etcd 压缩)时, 重新加载后从新的版本继续监听
+func (srv *NodeServer) watchJobs(jobRev, calendarRev int64) {
+	rch := handler.WatchJobs(srv.UUID, jobRev)
+	cch := handler.WatchCalendars(calendarRev)
+	for {
+		select {
+		case <-srv.stop:
+			return
+		case wresp, ok := <-rch:
+			if !ok {
+				logger.GetLogger().Warn(fmt.Sprintf("watch jobs of %s is closed, reload and watch again", srv.String()))
+				rch = srv.rewatch(func() (clientv3.WatchChan, error) {
+					rev, err := srv.loadJobs()
+					if err != nil {
+						return nil, err
+					}
+					return handler.WatchJobs(srv.UUID, rev), nil
+				})
+				continue
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch jobs of %s err: %s", srv.String(), err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				srv.applyJobEvent(ev)
+			}
+		case wresp, ok := <-cch:
+			if !ok {
+				logger.GetLogger().Warn(fmt.Sprintf("watch calendars of %s is closed, reload and watch again", srv.String()))
+				cch = srv.rewatch(func() (clientv3.WatchChan, error) {
+					rev, err := srv.reloadCalendars()
+					if err != nil {
+						return nil, err
+					}
+					return handler.WatchCalendars(rev), nil
+				})
+				continue
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch calendars of %s err: %s", srv.String(), err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				srv.applyCalendarEvent(ev)
+			}
+		}
+	}
+}
+
+// rewatch 每隔一秒重试 reload, 直到成功后返回新的 watch 通道; 节点停止时返回 nil
+func (srv *NodeServer) rewatch(reload func() (clientv3.WatchChan, error)) clientv3.WatchChan {
+	for {
+		select {
+		case <-srv.stop:
+			return nil
+		case <-time.After(time.Second):
+		}
+		ch, err := reload()
+		if err == nil {
+			return ch
+		}
+		logger.GetLogger().Warn(fmt.Sprintf("reload of %s err: %s", srv.String(), err.Error()))
+	}
+}
+
+// applyCalendarEvent 更新已加载的日历, 并重新调度引用了该日历的任务, 使顺延的调度时刻按新的日历计算
+func (srv *NodeServer) applyCalendarEvent(ev *clientv3.Event) {
+	id := handler.GetJobIDFromKey(string(ev.Kv.Key))
+	switch ev.Type {
+	case mvccpb.PUT:
+		if _, err := handler.PutCalendar(ev.Kv.Value); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("calendar[%s] is invalid: %s", string(ev.Kv.Key), err.Error()))
+			return
+		}
+	case mvccpb.DELETE:
+		handler.DeleteCalendar(id)
+	}
+	// modJob 会删除并重新写入 srv.jobs, 先取出需要重新调度的任务
+	var affected []*handler.Job
+	for _, job := range srv.jobs {
+		if job.UsesCalendar(id) {
+			affected = append(affected, job)
+		}
+	}
+	for _, job := range affected {
+		srv.modJob(job)
+	}
+}
+
+// watchProcs 监听当前节点上的进程记录, 记录被标记为终止时结束对应的命令
+func (srv *NodeServer) watchProcs() {
+	rch := handler.WatchProc(srv.UUID)
+	for {
+		select {
+		case <-srv.stop:
+			return
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch procs of %s err: %s", srv.String(), err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				srv.applyProcEvent(ev)
+			}
+		}
+	}
+}
+
+// applyProcEvent 处理一条进程记录的更新
+func (srv *NodeServer) applyProcEvent(ev *clientv3.Event) {
+	proc, err := handler.GetProcFromKey(string(ev.Kv.Key))
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("proc[%s] is invalid: %s", string(ev.Kv.Key), err.Error()))
+		return
+	}
+	if err = json.Unmarshal(ev.Kv.Value, &proc.JobProcVal); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("proc[%s] unmarshal err: %s", string(ev.Kv.Key), err.Error()))
+		return
+	}
+	if !proc.Killed {
+		return
+	}
+	if err = handler.KillCmd(proc.ID); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("kill job#%d pid[%d] err: %s", proc.JobID, proc.ID, err.Error()))
+		return
+	}
+	logger.GetLogger().Info(fmt.Sprintf("%s killed job#%d pid[%d]", srv.String(), proc.JobID, proc.ID))
+}
+
+// applyJobEvent 将一个 etcd 事件转换为调度器上的新增、替换或删除操作
+func (srv *NodeServer) applyJobEvent(ev *clientv3.Event) {
+	switch ev.Type {
+	case mvccpb.PUT:
+		job := new(handler.Job)
+		if err := json.Unmarshal(ev.Kv.Value, job); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job[%s] unmarshal err: %s", string(ev.Kv.Key), err.Error()))
+			return
+		}
+		if err := job.Check(); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("job[%s] is invalid: %s", string(ev.Kv.Key), err.Error()))
+			return
+		}
+		if ev.IsCreate() {
+			// 新分配到本节点的任务可能是从下线的节点转移过来的, 同样需要补执行
+			srv.addJob(job, true)
+		} else {
+			srv.modJob(job)
+		}
+	case mvccpb.DELETE:
+		srv.delJob(handler.GetJobIDFromKey(string(ev.Kv.Key)))
+	}
+}
+
+// addJob 将任务加入调度器, catchUp 为 true 时按任务的 misfire 策略补执行加入之前错过的调度
+func (srv *NodeServer) addJob(job *handler.Job, catchUp bool) {
+	// 在加入调度器之前取当前时刻, 此后的调度由调度器触发, 之前错过的由补执行处理
+	now := time.Now()
+	job.InitNodeInfo(models.JobStatusAssigned, srv.UUID, srv.Hostname, srv.IP)
+	cmd, err := handler.CreateJob(job)
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("add job#%d err: %s", job.ID, err.Error()))
+		return
+	}
+	if err = srv.schedule(job, cmd, jobEntryName(job.ID)); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("add job#%d spec[%s] time zone[%s] err: %s", job.ID, job.Spec, job.ZoneName(), err.Error()))
+		return
+	}
+	srv.jobs[job.ID] = job
+	logger.GetLogger().Info(fmt.Sprintf("%s add job#%d spec[%s] time zone[%s]", srv.String(), job.ID, job.Spec, job.ZoneName()))
+	if catchUp {
+		go job.CatchUp(now)
+	}
+}
+
+// modJob 用新的任务定义替换调度器中已有的任务
+func (srv *NodeServer) modJob(job *handler.Job) {
+	srv.delJob(job.ID)
+	srv.addJob(job, false)
+}
+
+// delJob 从调度器中移除任务
+func (srv *NodeServer) delJob(id int) {
+	if _, ok := srv.jobs[id]; !ok {
+		return
+	}
+	srv.Cron.RemoveJob(jobEntryName(id))
+	delete(srv.jobs, id)
+	logger.GetLogger().Info(fmt.Sprintf("%s delete job#%d", srv.String(), id))
+}
+
+// schedule 按任务的时区解析定时表达式, 并将任务加入调度器
+func (srv *NodeServer) schedule(job *handler.Job, cmd cron.Job, name string) error {
+	sched, err := job.ParseSchedule()
+	if err != nil {
+		return err
+	}
+	if job.HasShift() {
+		sched = schedule.Shift(sched, job.ShiftFire)
+	}
+	srv.Cron.Schedule(sched, cmd, name)
+	return nil
+}
+
+// jobEntryName 返回任务在调度器中的名称
+func jobEntryName(id int) string {
+	return strconv.Itoa(id)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	"crony/node/internal/handler"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// watchOnce 监听 /crony/once/<job_id>, 由目标节点立即执行一次任务
+// key 的值为 "any" 或以逗号分隔的节点 UUID
+func (srv *NodeServer) watchOnce() {
+	rch := handler.WatchOnce()
+	for {
+		select {
+		case <-srv.stop:
+			return
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch once of %s err: %s", srv.String(), err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				go srv.runOnce(ev.Kv)
+			}
+		}
+	}
+}
+
+// runOnce 处理一次触发: 判断是否由当前节点执行, 执行后写回结果并在全部目标完成后删除触发 key
+func (srv *NodeServer) runOnce(kv *mvccpb.KeyValue) {
+	jobId := handler.GetJobIDFromKey(string(kv.Key))
+	if jobId <= 0 {
+		logger.GetLogger().Warn(fmt.Sprintf("once key[%s] is invalid", string(kv.Key)))
+		return
+	}
+	targets := models.ParseOnceTargets(string(kv.Value))
+	if models.IsOnceTargetAny(targets) {
+		ok, err := handler.TryOnce(jobId, kv.ModRevision)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("try once job#%d err: %s", jobId, err.Error()))
+			return
+		}
+		if !ok {
+			return
+		}
+	} else if !containsString(targets, srv.UUID) {
+		return
+	}
+
+	result := &models.JobOnceResult{
+		JobID:      jobId,
+		NodeUUID:   srv.UUID,
+		TriggerRev: kv.ModRevision,
+		StartTime:  time.Now().Unix(),
+	}
+	job, err := srv.loadOnceJob(jobId)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		logger.GetLogger().Info(fmt.Sprintf("%s run job#%d once", srv.String(), jobId))
+		var runErr error
+		result.JobLogID, result.Output, runErr = job.RunWithRecovery()
+		if runErr != nil {
+			result.Error = runErr.Error()
+		}
+		result.Success = runErr == nil
+	}
+	result.EndTime = time.Now().Unix()
+
+	if err = handler.PutOnceResult(result); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("put once result of job#%d err: %s", jobId, err.Error()))
+	}
+	if err = handler.FinishOnce(jobId, kv.ModRevision, targets); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("finish once of job#%d err: %s", jobId, err.Error()))
+	}
+}
+
+// loadOnceJob 从 MySQL 中读取任务定义
+// 一次性执行的目标节点不一定是任务的运行节点, 因此不能依赖本节点已加载的任务
+func (srv *NodeServer) loadOnceJob(jobId int) (*handler.Job, error) {
+	job := &handler.Job{Job: &models.Job{ID: jobId}}
+	if err := job.FindById(); err != nil {
+		return nil, err
+	}
+	if err := job.Unmarshal(); err != nil {
+		return nil, err
+	}
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	job.InitNodeInfo(models.JobStatusAssigned, srv.UUID, srv.Hostname, srv.IP)
+	return job, nil
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crony/common/models"
+	"crony/common/pkg/logger"
+	"crony/node/internal/handler"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// watchSteps 监听 /crony/step/<run_id>/<step>, 由目标节点执行工作流的步骤
+// 开始监听前先处理节点启动前已经写入的触发, 再从读取时的版本号之后开始监听, 重启期间写入的触发不会丢失
+func (srv *NodeServer) watchSteps() {
+	rev, err := srv.loadSteps()
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("load steps of %s err: %s", srv.String(), err.Error()))
+	}
+	rch := handler.WatchSteps(rev)
+	for {
+		select {
+		case <-srv.stop:
+			return
+		case wresp, ok := <-rch:
+			if !ok {
+				return
+			}
+			if err := wresp.Err(); err != nil {
+				logger.GetLogger().Warn(fmt.Sprintf("watch steps of %s err: %s", srv.String(), err.Error()))
+				continue
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				go srv.runStep(ev.Kv)
+			}
+		}
+	}
+}
+
+// loadSteps 执行已经写入、还没有结果的步骤触发, 返回读取时的版本号
+// 已经写回结果的触发等待 admin 处理, 不会重复执行
+func (srv *NodeServer) loadSteps() (int64, error) {
+	kvs, rev, err := handler.GetSteps()
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range kvs {
+		trigger := new(models.WorkflowStepTrigger)
+		if err = json.Unmarshal(kv.Value, trigger); err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("step[%s] unmarshal err: %s", string(kv.Key), err.Error()))
+			continue
+		}
+		if trigger.Target != models.OnceTargetAny && trigger.Target != srv.UUID {
+			continue
+		}
+		done, err := handler.HasStepResult(trigger)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("get result of step %s of workflow run#%d err: %s", trigger.Step, trigger.RunID, err.Error()))
+			continue
+		}
+		if !done {
+			go srv.runStep(kv)
+		}
+	}
+	return rev, nil
+}
+
+// runStep 处理一次步骤的触发: 判断是否由当前节点执行, 执行后写回结果
+// 触发和结果 key 由 admin 处理结果后删除
+func (srv *NodeServer) runStep(kv *mvccpb.KeyValue) {
+	trigger := new(models.WorkflowStepTrigger)
+	if err := json.Unmarshal(kv.Value, trigger); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("step[%s] unmarshal err: %s", string(kv.Key), err.Error()))
+		return
+	}
+	if trigger.Target == models.OnceTargetAny {
+		ok, err := handler.TryStep(trigger)
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("try step %s of workflow run#%d err: %s", trigger.Step, trigger.RunID, err.Error()))
+			return
+		}
+		if !ok {
+			return
+		}
+	} else if trigger.Target != srv.UUID {
+		return
+	}
+
+	result := &models.WorkflowStepResult{
+		RunID:     trigger.RunID,
+		Step:      trigger.Step,
+		Attempt:   trigger.Attempt,
+		NodeUUID:  srv.UUID,
+		StartTime: time.Now().Unix(),
+	}
+	job, err := srv.loadOnceJob(trigger.JobID)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		logger.GetLogger().Info(fmt.Sprintf("%s run step %s(job#%d) of workflow run#%d", srv.String(), trigger.Step, trigger.JobID, trigger.RunID))
+		var runErr error
+		result.JobLogID, result.Output, runErr = job.RunStep(trigger.RunID)
+		if runErr != nil {
+			result.Error = runErr.Error()
+		}
+		result.Success = runErr == nil
+	}
+	result.EndTime = time.Now().Unix()
+
+	if err = handler.PutStepResult(result); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("put result of step %s of workflow run#%d err: %s", trigger.Step, trigger.RunID, err.Error()))
+	}
+}